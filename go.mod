@@ -10,7 +10,10 @@ require (
 	github.com/philippgille/chromem-go v0.7.0
 )
 
-require github.com/gen2brain/go-fitz v1.24.14
+require (
+	github.com/gen2brain/go-fitz v1.24.14
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/ebitengine/purego v0.8.0 // indirect
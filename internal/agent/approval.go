@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/tool"
+)
+
+// ApprovalConfig 定义了需要审批的工具调用如何等待决定
+type ApprovalConfig struct {
+	Timeout   time.Duration  // 等待审批的时间，为零时一直等待直到任务被取消
+	OnTimeout ApprovalAction // 超时后的处理方式，只能是approve或reject，默认reject
+}
+
+// ApprovalAction 定义了审批决定的类型
+type ApprovalAction string
+
+// 预定义审批决定
+const (
+	ApprovalApprove ApprovalAction = "approve" // 按提议的参数执行
+	ApprovalReject  ApprovalAction = "reject"  // 拒绝执行，工具调用返回ErrApprovalRejected
+	ApprovalEdit    ApprovalAction = "edit"    // 按修改后的参数执行
+)
+
+// ApprovalRequest 是一个等待审批的工具调用
+type ApprovalRequest struct {
+	ID          string
+	AgentID     string
+	TaskID      string
+	ToolID      string
+	Params      map[string]interface{} // 模型提议的参数
+	RequestedAt time.Time
+	ExpiresAt   time.Time // 为零表示不会超时
+}
+
+// ApprovalDecision 是对工具调用的审批决定
+type ApprovalDecision struct {
+	Action ApprovalAction
+	Params map[string]interface{} // Action为edit时使用的参数
+	Reason string                 // 决定的原因，拒绝时会回传给模型
+}
+
+// pendingApproval 是等待决定的审批请求
+type pendingApproval struct {
+	request  ApprovalRequest
+	decision chan ApprovalDecision
+}
+
+// approvalRegistry 保存所有等待决定的审批请求
+type approvalRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+func newApprovalRegistry() *approvalRegistry {
+	return &approvalRegistry{pending: make(map[string]*pendingApproval)}
+}
+
+// add 登记审批请求
+func (g *approvalRegistry) add(request ApprovalRequest) *pendingApproval {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := &pendingApproval{request: request, decision: make(chan ApprovalDecision, 1)}
+	g.pending[request.ID] = p
+	return p
+}
+
+// remove 移除审批请求
+func (g *approvalRegistry) remove(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.pending, id)
+}
+
+// resolve 将决定交给等待中的工具调用，每个请求只能决定一次
+func (g *approvalRegistry) resolve(id string, decision ApprovalDecision) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.pending[id]
+	if !ok {
+		return ErrApprovalNotFound
+	}
+	delete(g.pending, id)
+	p.decision <- decision
+	return nil
+}
+
+// list 按请求时间返回等待决定的审批请求，agentID为空时返回全部
+func (g *approvalRegistry) list(agentID string) []ApprovalRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var requests []ApprovalRequest
+	for _, p := range g.pending {
+		if agentID == "" || p.request.AgentID == agentID {
+			requests = append(requests, p.request)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedAt.Before(requests[j].RequestedAt)
+	})
+	return requests
+}
+
+// validateApprovalDecision 检查审批决定是否有效
+func validateApprovalDecision(decision ApprovalDecision) error {
+	switch decision.Action {
+	case ApprovalApprove, ApprovalReject:
+		return nil
+	case ApprovalEdit:
+		if decision.Params == nil {
+			return fmt.Errorf("%w: edit decision requires params", ErrInvalidConfig)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown approval action %q", ErrInvalidConfig, decision.Action)
+	}
+}
+
+// requiresApproval 判断调用工具前是否需要审批
+func (r *Runtime) requiresApproval(t tool.Tool) bool {
+	for _, config := range r.agent.config.Tools {
+		if config.ID == t.ID() && config.RequireApproval {
+			return true
+		}
+	}
+	mp, ok := t.(tool.MetadataProvider)
+	return ok && mp.Metadata().RequiresApproval
+}
+
+// awaitApproval 挂起任务直到工具调用得到审批决定、超时或任务被取消，
+// 返回批准执行时使用的参数
+func (r *Runtime) awaitApproval(ctx context.Context, t tool.Tool, params map[string]interface{}) (map[string]interface{}, error) {
+	config := r.agent.config.Approval
+	taskID, _ := ctx.Value("task_id").(string)
+
+	request := ApprovalRequest{
+		ID:          uuid.New().String(),
+		AgentID:     r.agent.id,
+		TaskID:      taskID,
+		ToolID:      t.ID(),
+		Params:      params,
+		RequestedAt: time.Now(),
+	}
+	var timeout <-chan time.Time
+	if config.Timeout > 0 {
+		request.ExpiresAt = request.RequestedAt.Add(config.Timeout)
+		timer := time.NewTimer(config.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	pending := r.approvals.add(request)
+	defer r.approvals.remove(request.ID)
+
+	if r.onApproval != nil && taskID != "" {
+		r.onApproval(taskID, true)
+		defer r.onApproval(taskID, false)
+	}
+	r.recordEvent(ctx, "approval_required", map[string]interface{}{
+		"approval_id": request.ID,
+		"task_id":     taskID,
+		"tool_id":     request.ToolID,
+		"params":      params,
+		"expires_at":  request.ExpiresAt,
+	})
+
+	var decision ApprovalDecision
+	timedOut := false
+	select {
+	case decision = <-pending.decision:
+	case <-timeout:
+		timedOut = true
+		decision = ApprovalDecision{Action: config.OnTimeout, Reason: "approval timed out"}
+		if decision.Action != ApprovalApprove {
+			decision.Action = ApprovalReject
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.recordEvent(ctx, "approval_resolved", map[string]interface{}{
+		"approval_id": request.ID,
+		"task_id":     taskID,
+		"tool_id":     request.ToolID,
+		"action":      string(decision.Action),
+		"reason":      decision.Reason,
+		"timed_out":   timedOut,
+	})
+
+	switch decision.Action {
+	case ApprovalApprove:
+		return params, nil
+	case ApprovalEdit:
+		if err := t.Validate(decision.Params); err != nil {
+			return nil, fmt.Errorf("invalid edited parameters: %w", err)
+		}
+		return decision.Params, nil
+	default:
+		if timedOut {
+			return nil, fmt.Errorf("%w after %s", ErrApprovalTimeout, config.Timeout)
+		}
+		if decision.Reason != "" {
+			return nil, fmt.Errorf("%w: %s", ErrApprovalRejected, decision.Reason)
+		}
+		return nil, ErrApprovalRejected
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/memory"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+func TestApprovalGate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	action := "Action: repeat\nAction Input: {\"word\": \"rm\", \"times\": 1}"
+	provider := newFakeProvider(action, "Final Answer: edited", action, "Final Answer: rejected")
+	service := llm.NewService()
+	if err := service.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+	toolMgr := tool.NewManager()
+	repeat := &fakeTool{id: "repeat"}
+	if err := toolMgr.RegisterTool(ctx, repeat); err != nil {
+		t.Fatalf("注册工具失败: %v", err)
+	}
+	mgr := NewManager(toolMgr, memory.NewManager(), nil, service, nil, nil)
+
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:  "Guarded",
+		Model: ModelConfig{Type: "fake-model"},
+		Tools: []ToolConfig{{ID: "repeat", RequireApproval: true}},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: agentID, Types: []string{"approval_required"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	// awaitApproval 等待审批请求，并检查任务已挂起
+	awaitApproval := func(taskID string) ApprovalRequest {
+		t.Helper()
+		select {
+		case <-sub.Events():
+		case <-ctx.Done():
+			t.Fatal("未收到审批请求事件")
+		}
+		pending, err := mgr.PendingApprovals(ctx, agentID)
+		if err != nil || len(pending) != 1 {
+			t.Fatalf("期望1个待审批请求，实际为 %v，错误 %v", pending, err)
+		}
+		if status, _ := mgr.GetTaskStatus(ctx, taskID); status.Status != "awaiting_approval" {
+			t.Errorf("期望任务等待审批，实际为 %s", status.Status)
+		}
+		return pending[0]
+	}
+
+	// 审批时修改参数，工具按修改后的参数执行
+	task := types.Task{ID: "guarded-1", Type: "conversation", Parameters: map[string]interface{}{"input": "clean up"}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	request := awaitApproval(task.ID)
+	if request.ToolID != "repeat" || request.Params["word"] != "rm" || request.TaskID != task.ID {
+		t.Errorf("审批请求不正确: %+v", request)
+	}
+	if err := mgr.ResolveApproval(ctx, request.ID, ApprovalDecision{Action: ApprovalEdit, Params: map[string]interface{}{"word": "ls", "times": 2}}); err != nil {
+		t.Fatalf("审批失败: %v", err)
+	}
+	if status, err := mgr.WaitTask(ctx, task.ID); err != nil || status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际为 %s %v", status.Status, err)
+	}
+	if len(repeat.calls) != 1 || repeat.calls[0]["word"] != "ls" {
+		t.Errorf("期望按修改后的参数执行工具，实际为 %+v", repeat.calls)
+	}
+	if err := mgr.ResolveApproval(ctx, request.ID, ApprovalDecision{Action: ApprovalApprove}); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("期望重复审批返回ErrApprovalNotFound，实际得到 %v", err)
+	}
+
+	// 拒绝时工具不执行，拒绝原因作为观察结果回传给模型
+	task.ID = "guarded-2"
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	request = awaitApproval(task.ID)
+	if err := mgr.ResolveApproval(ctx, request.ID, ApprovalDecision{Action: ApprovalReject, Reason: "too risky"}); err != nil {
+		t.Fatalf("审批失败: %v", err)
+	}
+	if status, err := mgr.WaitTask(ctx, task.ID); err != nil || status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际为 %s %v", status.Status, err)
+	}
+	messages := provider.lastRequest().Messages
+	if observation := messages[len(messages)-1].Content; !strings.Contains(observation, "tool call rejected: too risky") || len(repeat.calls) != 1 {
+		t.Errorf("拒绝原因未回传给模型: %q", observation)
+	}
+}
+
+func TestApprovalTimeout(t *testing.T) {
+	provider := newFakeProvider()
+	repeat := &fakeTool{id: "repeat"}
+	runtime := newTestRuntime(t, provider, []tool.Tool{repeat}, nil)
+	runtime.agent.config.Tools = []ToolConfig{{ID: "repeat", RequireApproval: true}}
+	runtime.agent.config.Approval = ApprovalConfig{Timeout: 20 * time.Millisecond}
+
+	params := map[string]interface{}{"word": "go", "times": 2}
+	if _, err := runtime.callTool(context.Background(), "repeat", params); !errors.Is(err, ErrApprovalTimeout) {
+		t.Errorf("期望审批超时，实际得到 %v", err)
+	}
+
+	// 超时策略为批准时按原参数执行
+	runtime.agent.config.Approval.OnTimeout = ApprovalApprove
+	if result, err := runtime.callTool(context.Background(), "repeat", params); err != nil || result != "gogo" {
+		t.Errorf("期望超时后执行工具，实际为 %v，错误 %v", result, err)
+	}
+	if len(repeat.calls) != 1 {
+		t.Errorf("期望工具执行1次，实际为 %d 次", len(repeat.calls))
+	}
+}
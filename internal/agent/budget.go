@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// usageMeter 统计运行时的模型调用用量，并按预算检查Agent和任务的用量
+type usageMeter struct {
+	mu     sync.Mutex
+	budget BudgetConfig
+	total  types.ResourceStats
+	tasks  map[string]*taskUsage // 尚未结束的任务，重试和放回队列后沿用已有用量
+}
+
+// taskUsage 是单个任务的用量和预算
+type taskUsage struct {
+	stats  types.ResourceStats
+	budget *types.Budget // 为空时使用Agent的默认任务预算
+}
+
+// newUsageMeter 创建按给定预算检查用量的计量器
+func newUsageMeter(budget BudgetConfig) *usageMeter {
+	return &usageMeter{
+		budget: budget,
+		tasks:  make(map[string]*taskUsage),
+	}
+}
+
+// begin 开始统计任务的用量，重试或重新执行的任务沿用之前的用量
+func (m *usageMeter) begin(task types.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tasks[task.ID]; !ok {
+		m.tasks[task.ID] = &taskUsage{budget: task.Budget}
+	}
+}
+
+// release 结束统计任务的用量，在任务进入终止状态时调用
+func (m *usageMeter) release(taskID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tasks, taskID)
+}
+
+// record 将一次模型调用的用量累加到Agent和任务
+func (m *usageMeter) record(taskID string, usage types.ResourceStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addResources(&m.total, usage)
+	if t, ok := m.tasks[taskID]; ok {
+		addResources(&t.stats, usage)
+	}
+}
+
+// check 检查Agent和任务的用量是否超出预算，total表示超出的是Agent的累计预算。
+// 调用模型前用量达到预算即视为超出，调用模型后用量大于预算才视为超出，
+// 使恰好用完预算的任务可以正常结束
+func (m *usageMeter) check(taskID string, beforeCall bool) (total bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if reason := overBudget(m.total, m.budget.Total, beforeCall); reason != "" {
+		return true, fmt.Errorf("%w: agent %s", ErrBudgetExceeded, reason)
+	}
+
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return false, nil
+	}
+	budget := m.budget.Task
+	if t.budget != nil {
+		budget = *t.budget
+	}
+	if reason := overBudget(t.stats, budget, beforeCall); reason != "" {
+		return false, fmt.Errorf("%w: task %s %s", ErrBudgetExceeded, taskID, reason)
+	}
+	return false, nil
+}
+
+// totals 返回Agent的累计用量
+func (m *usageMeter) totals() types.ResourceStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// setBudget 替换预算，已有的用量保持不变
+func (m *usageMeter) setBudget(budget BudgetConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget = budget
+}
+
+// currentBudget 返回当前生效的预算
+func (m *usageMeter) currentBudget() BudgetConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.budget
+}
+
+// action 返回超出预算时的处理方式
+func (m *usageMeter) action() BudgetAction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.budget.OnExceeded == "" {
+		return BudgetFail
+	}
+	return m.budget.OnExceeded
+}
+
+// overBudget 返回超出预算的原因，未超出时返回空字符串
+func overBudget(stats types.ResourceStats, budget types.Budget, inclusive bool) string {
+	exceeds := func(used, limit float64) bool {
+		if limit <= 0 {
+			return false
+		}
+		return used > limit || inclusive && used == limit
+	}
+
+	if exceeds(float64(stats.Tokens), float64(budget.MaxTokens)) {
+		return fmt.Sprintf("used %d of %d tokens", stats.Tokens, budget.MaxTokens)
+	}
+	if exceeds(stats.Cost, budget.MaxCost) {
+		return fmt.Sprintf("used %.4f of %.4f cost", stats.Cost, budget.MaxCost)
+	}
+	return ""
+}
+
+// addResources 累加资源用量
+func addResources(total *types.ResourceStats, usage types.ResourceStats) {
+	total.Tokens += usage.Tokens
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.LLMCalls += usage.LLMCalls
+	total.Cost += usage.Cost
+	total.APILatency += usage.APILatency
+}
+
+// validateBudget 检查预算配置，返回发现的问题
+func validateBudget(budget BudgetConfig) []string {
+	var problems []string
+	if budget.Total.MaxTokens < 0 || budget.Total.MaxCost < 0 || budget.Task.MaxTokens < 0 || budget.Task.MaxCost < 0 {
+		problems = append(problems, "budget limits must not be negative")
+	}
+	switch budget.OnExceeded {
+	case "", BudgetFail, BudgetPause:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown budget action %q", budget.OnExceeded))
+	}
+	return problems
+}
+
+// meterUsage 计量一次模型调用的用量，费用按模型定价计算
+func (r *Runtime) meterUsage(ctx context.Context, provider string, usage types.Usage, latency time.Duration) {
+	pricing := r.modelPricing(ctx, provider)
+
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	stats := types.ResourceStats{
+		Tokens:           tokens,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		LLMCalls:         1,
+		Cost:             float64(usage.PromptTokens)*pricing.PricingPerInputToken + float64(usage.CompletionTokens)*pricing.PricingPerOutputToken,
+		APILatency:       latency,
+	}
+
+	taskID, _ := ctx.Value("task_id").(string)
+	r.meter.record(taskID, stats)
+	if r.onUsage != nil && taskID != "" {
+		r.onUsage(taskID, stats)
+	}
+}
+
+// modelPricing 返回模型定价，只缓存成功获取的结果。
+// 获取失败时发布pricing_unavailable事件，本次调用按零定价计算
+func (r *Runtime) modelPricing(ctx context.Context, provider string) types.ModelInfo {
+	r.pricingMu.Lock()
+	defer r.pricingMu.Unlock()
+
+	if r.pricing != nil {
+		return *r.pricing
+	}
+	model, err := r.llm.GetModel(context.WithoutCancel(ctx), provider, r.agent.config.Model.Type)
+	if err != nil {
+		r.recordEvent(ctx, "pricing_unavailable", map[string]interface{}{
+			"provider": provider,
+			"model":    r.agent.config.Model.Type,
+			"error":    err.Error(),
+		})
+		return types.ModelInfo{}
+	}
+	r.pricing = &model
+	return model
+}
+
+// enforceBudget 检查预算，超出时按配置使任务失败，或暂停Agent并将任务放回队列。
+// 只有Agent的累计预算可以通过SetBudget提高，超出任务自身预算的任务总是失败
+func (r *Runtime) enforceBudget(ctx context.Context, beforeCall bool) error {
+	taskID, _ := ctx.Value("task_id").(string)
+	total, err := r.meter.check(taskID, beforeCall)
+	if err == nil {
+		return nil
+	}
+
+	action := BudgetFail
+	if total {
+		action = r.meter.action()
+	}
+	r.recordEvent(ctx, "budget_exceeded", map[string]interface{}{
+		"task_id": taskID,
+		"action":  string(action),
+		"error":   err.Error(),
+	})
+
+	if action == BudgetPause {
+		// 其他正在执行的任务在下一次调用模型时各自放回队列
+		r.runningMu.Lock()
+		if rt, ok := r.running[taskID]; ok {
+			rt.checkpointed = true
+		}
+		r.runningMu.Unlock()
+
+		r.agent.setStatus("paused")
+		r.Pause(false)
+	}
+	return err
+}
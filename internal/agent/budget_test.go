@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// runConversation 分配一个对话任务并等待其结束
+func runConversation(t *testing.T, mgr Manager, agentID string, task types.Task) types.TaskStatus {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	task.Type = "conversation"
+	if task.Parameters == nil {
+		task.Parameters = map[string]interface{}{"input": "hello"}
+	}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	status, err := mgr.WaitTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+	return status
+}
+
+func TestBudgetMetering(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeProvider("one", "two", "three", "four")
+	mgr := newTestManager(t, provider)
+
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:   "Metered",
+		Model:  ModelConfig{Type: "fake-model"},
+		Budget: BudgetConfig{Total: types.Budget{MaxTokens: 40}},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+
+	// 每次调用15个token，费用按定价为 10*0.001 + 5*0.002
+	status := runConversation(t, mgr, agentID, types.Task{ID: "metered-1"})
+	if status.Status != "completed" || status.Resources.Tokens != 15 || status.Resources.LLMCalls != 1 || math.Abs(status.Resources.Cost-0.02) > 1e-9 {
+		t.Fatalf("任务用量不正确: %s %+v", status.Status, status.Resources)
+	}
+
+	// 任务预算可以单独指定
+	status = runConversation(t, mgr, agentID, types.Task{ID: "metered-2", Budget: &types.Budget{MaxTokens: 10}})
+	if status.Status != "failed" || !errors.Is(status.Error, ErrBudgetExceeded) || status.Resources.Tokens != 15 {
+		t.Errorf("期望任务超出自身预算而失败，实际为 %s %v", status.Status, status.Error)
+	}
+
+	// Agent累计用量超出预算后，任务不再调用模型
+	runConversation(t, mgr, agentID, types.Task{ID: "metered-3"})
+	status = runConversation(t, mgr, agentID, types.Task{ID: "metered-4"})
+	if status.Status != "failed" || !errors.Is(status.Error, ErrBudgetExceeded) || status.Resources.LLMCalls != 0 {
+		t.Errorf("期望预算用完后任务直接失败，实际为 %s %+v", status.Status, status.Resources)
+	}
+	if n := len(provider.history()); n != 3 {
+		t.Errorf("期望调用模型3次，实际为 %d 次", n)
+	}
+
+	resources := agent.Status().Resources
+	if resources.Tokens != 45 || resources.PromptTokens != 30 || resources.LLMCalls != 3 {
+		t.Errorf("Agent累计用量不正确: %+v", resources)
+	}
+}
+
+func TestBudgetPause(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("one", "two"))
+
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:   "Paused",
+		Model:  ModelConfig{Type: "fake-model"},
+		Budget: BudgetConfig{Total: types.Budget{MaxTokens: 15}, OnExceeded: BudgetPause},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+
+	// 恰好用完预算的任务正常完成
+	if status := runConversation(t, mgr, agentID, types.Task{ID: "pause-1"}); status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际为 %s %v", status.Status, status.Error)
+	}
+
+	// 下一个任务暂停Agent并放回队列
+	task := types.Task{ID: "pause-2", Type: "conversation", Parameters: map[string]interface{}{"input": "hello"}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for agent.Status().Status != "paused" {
+		if time.Now().After(deadline) {
+			t.Fatalf("期望Agent因超出预算暂停，实际状态 %s", agent.Status().Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status, _ := mgr.GetTaskStatus(ctx, task.ID); isTerminalStatus(status.Status) {
+		t.Fatalf("期望任务等待恢复，实际为 %s", status.Status)
+	}
+
+	// 提高预算并恢复后任务继续执行
+	if err := mgr.SetBudget(ctx, agentID, BudgetConfig{Total: types.Budget{MaxTokens: 100}}); err != nil {
+		t.Fatalf("设置预算失败: %v", err)
+	}
+	if err := mgr.ResumeAgent(ctx, agentID); err != nil {
+		t.Fatalf("恢复Agent失败: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	status, err := mgr.WaitTask(waitCtx, task.ID)
+	if err != nil || status.Status != "completed" {
+		t.Errorf("期望任务在恢复后完成，实际为 %s %v", status.Status, err)
+	}
+
+	if err := mgr.SetBudget(ctx, agentID, BudgetConfig{OnExceeded: "ignore"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("期望拒绝未知的处理方式，实际得到 %v", err)
+	}
+}
+
+func TestBudgetAcrossRetries(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("one", "two", "three"))
+
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:   "Retried",
+		Model:  ModelConfig{Type: "fake-model"},
+		Budget: BudgetConfig{Task: types.Budget{MaxTokens: 20}, OnExceeded: BudgetPause},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+	runtime := agent.(*baseAgent).runtime
+
+	// 每次执行调用一次模型，第一次执行以可重试的错误失败
+	attempts := 0
+	handler := NewTaskHandler(nil, func(ctx context.Context, task types.Task) (types.Result, error) {
+		attempts++
+		if _, err := runtime.chat(ctx, []types.Message{{Role: types.RoleUser, Content: "hi"}}); err != nil {
+			return types.Result{}, err
+		}
+		if attempts == 1 {
+			return types.Result{}, types.ErrRateLimited
+		}
+		return types.Result{Data: "done"}, nil
+	})
+	if err := mgr.RegisterTaskHandler(ctx, agentID, "flaky", handler); err != nil {
+		t.Fatalf("注册处理器失败: %v", err)
+	}
+
+	task := types.Task{ID: "retried-1", Type: "flaky", Retry: &types.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	status, err := mgr.WaitTask(waitCtx, task.ID)
+	if err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+
+	// 任务预算覆盖所有重试，超出任务预算时任务失败而不是暂停Agent
+	if status.Status != "failed" || !errors.Is(status.Error, ErrBudgetExceeded) || status.Resources.Tokens != 30 {
+		t.Errorf("期望第二次执行超出任务预算而失败，实际为 %s %v %+v", status.Status, status.Error, status.Resources)
+	}
+	if agent.Status().Status == "paused" {
+		t.Errorf("超出任务预算不应暂停Agent")
+	}
+}
+
+// unpricedProvider 在前几次获取模型信息时失败
+type unpricedProvider struct {
+	*fakeProvider
+	failures int
+}
+
+func (p *unpricedProvider) GetModel(ctx context.Context, modelID string) (types.ModelInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return types.ModelInfo{}, types.ErrLLMNotAvailable
+	}
+	return types.ModelInfo{Name: modelID, PricingPerInputToken: 0.001, PricingPerOutputToken: 0.002}, nil
+}
+
+func TestBudgetPricingUnavailable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mgr := newTestManager(t, &unpricedProvider{fakeProvider: newFakeProvider("one", "two"), failures: 1})
+	agentID := createTestAgent(t, mgr)
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: agentID, Types: []string{"pricing_unavailable"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	// 获取定价失败时发布事件并按零定价计算，下次调用重新获取
+	if status := runConversation(t, mgr, agentID, types.Task{ID: "unpriced-1"}); status.Resources.Cost != 0 {
+		t.Errorf("期望无法获取定价时费用为0，实际为 %v", status.Resources.Cost)
+	}
+	select {
+	case <-sub.Events():
+	case <-ctx.Done():
+		t.Fatal("期望收到pricing_unavailable事件")
+	}
+	if status := runConversation(t, mgr, agentID, types.Task{ID: "unpriced-2"}); math.Abs(status.Resources.Cost-0.02) > 1e-9 {
+		t.Errorf("期望重新获取定价后计算费用，实际为 %v", status.Resources.Cost)
+	}
+}
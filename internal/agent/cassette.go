@@ -0,0 +1,458 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// cassetteVersion 是当前录像带文件格式的版本
+const cassetteVersion = 1
+
+// CassetteMode 定义了录像带的工作模式
+type CassetteMode string
+
+// 预定义录像带模式
+const (
+	CassetteRecord CassetteMode = "record" // 调用真实的提供者和工具并记录结果
+	CassetteReplay CassetteMode = "replay" // 不调用提供者和工具，按请求返回录制的结果
+)
+
+// Interaction 是录像带中的一次模型调用或工具执行
+type Interaction struct {
+	Kind     string          `json:"kind"` // chat、complete、embed、get_model、list_models或tool
+	Name     string          `json:"name"` // 提供者名称或工具ID
+	Model    string          `json:"model,omitempty"`
+	TaskID   string          `json:"task_id,omitempty"` // 发起调用的任务，仅用于排查
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// ErrorCode 标识错误包装的已知哨兵错误，回放时据此恢复错误类型，使重试判断与录制时一致
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// cassetteErrors 是录制时按代码保存的已知错误，按顺序匹配
+var cassetteErrors = []struct {
+	code string
+	err  error
+}{
+	{"rate_limited", types.ErrRateLimited},
+	{"request_timeout", types.ErrRequestTimeout},
+	{"llm_not_available", types.ErrLLMNotAvailable},
+	{"invalid_request", types.ErrInvalidRequest},
+	{"context_canceled", context.Canceled},
+	{"deadline_exceeded", context.DeadlineExceeded},
+}
+
+// errorCode 返回err包装的已知错误的代码，未知错误返回空字符串
+func errorCode(err error) string {
+	for _, known := range cassetteErrors {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	return ""
+}
+
+// recordedError 是回放的错误，消息与录制时相同，并包装录制时的已知错误
+type recordedError struct {
+	message string
+	err     error
+}
+
+func (e *recordedError) Error() string {
+	return e.message
+}
+
+func (e *recordedError) Unwrap() error {
+	return e.err
+}
+
+// replayError 根据录制的消息和代码重建错误
+func replayError(message, code string) error {
+	for _, known := range cassetteErrors {
+		if known.code == code {
+			return &recordedError{message: message, err: known.err}
+		}
+	}
+	return errors.New(message)
+}
+
+// chatStreamResponse 是流式聊天的录制结果。Deltas之外的字段与ChatResponse相同，
+// 因此流式和非流式的调用可以互相回放
+type chatStreamResponse struct {
+	types.ChatResponse
+	Deltas []string `json:"deltas,omitempty"`
+}
+
+// key 返回回放时匹配请求所用的键，请求按紧凑格式比较，不受文件缩进影响
+func (i Interaction) key() string {
+	var request bytes.Buffer
+	if err := json.Compact(&request, i.Request); err != nil {
+		request.Write(i.Request)
+	}
+	return i.Kind + "\x00" + i.Name + "\x00" + i.Model + "\x00" + request.String()
+}
+
+// cassetteFile 是录像带的文件格式
+type cassetteFile struct {
+	Version      int               `json:"version"`
+	EmbedModels  map[string]string `json:"embed_models,omitempty"` // 提供者名称 -> 嵌入模型
+	Interactions []Interaction     `json:"interactions"`
+}
+
+// Cassette 记录运行过程中的模型调用和工具执行，用于离线重放同一任务。
+// 录制时用RecordProvider和WrapTool包装真实的提供者和工具后注册；
+// 回放时用ReplayProvider代替提供者，工具仍需用WrapTool包装以提供元数据和参数校验。
+// 回放按请求内容匹配录制结果，相同请求按录制顺序依次返回，因此并发任务也能正确回放
+type Cassette struct {
+	mode         CassetteMode
+	mu           sync.Mutex
+	embedModels  map[string]string
+	interactions []Interaction
+	queues       map[string][]int // 回放时每个请求键尚未返回的录制结果
+	played       []bool
+}
+
+// NewCassette 创建一个录制模式的录像带
+func NewCassette() *Cassette {
+	return &Cassette{
+		mode:        CassetteRecord,
+		embedModels: make(map[string]string),
+	}
+}
+
+// LoadCassette 读取录像带文件，返回回放模式的录像带
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	if file.Version != cassetteVersion {
+		return nil, fmt.Errorf("invalid cassette %s: unsupported version %d", path, file.Version)
+	}
+
+	c := &Cassette{
+		mode:         CassetteReplay,
+		embedModels:  file.EmbedModels,
+		interactions: file.Interactions,
+		queues:       make(map[string][]int),
+		played:       make([]bool, len(file.Interactions)),
+	}
+	for i, interaction := range file.Interactions {
+		key := interaction.key()
+		c.queues[key] = append(c.queues[key], i)
+	}
+	return c, nil
+}
+
+// Mode 返回录像带的工作模式
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Save 将录制的内容写入文件
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	file := cassetteFile{
+		Version:      cassetteVersion,
+		EmbedModels:  c.embedModels,
+		Interactions: c.interactions,
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Unplayed 返回回放模式下尚未被请求过的录制结果，用于确认回放走完了录制时的全部路径
+func (c *Cassette) Unplayed() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var unplayed []Interaction
+	for i, played := range c.played {
+		if !played {
+			unplayed = append(unplayed, c.interactions[i])
+		}
+	}
+	return unplayed
+}
+
+// RecordProvider 包装提供者，录制经过它的所有调用
+func (c *Cassette) RecordProvider(provider types.Provider) types.Provider {
+	c.mu.Lock()
+	c.embedModels[provider.Name()] = provider.GetEmbedModel()
+	c.mu.Unlock()
+
+	return &cassetteProvider{cassette: c, name: provider.Name(), inner: provider}
+}
+
+// ReplayProvider 返回按录制结果响应的提供者，name须与录制时的提供者名称一致
+func (c *Cassette) ReplayProvider(name string) types.Provider {
+	return &cassetteProvider{cassette: c, name: name}
+}
+
+// WrapTool 包装工具，录制模式下记录执行结果，回放模式下返回录制的结果而不执行工具
+func (c *Cassette) WrapTool(t tool.Tool) tool.Tool {
+	return &cassetteTool{Tool: t, cassette: c}
+}
+
+// exchange 完成一次调用。录制模式下执行call并记录请求和response；
+// 回放模式下查找相同请求的录制结果并解码到response
+func (c *Cassette) exchange(ctx context.Context, kind, name, model string, request, response interface{}, call func() error) error {
+	requestData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", kind, err)
+	}
+	interaction := Interaction{Kind: kind, Name: name, Model: model, Request: requestData}
+
+	if c.mode == CassetteReplay {
+		return c.replay(interaction, response)
+	}
+
+	callErr := call()
+	if callErr != nil {
+		interaction.Error = callErr.Error()
+		interaction.ErrorCode = errorCode(callErr)
+	} else if interaction.Response, err = json.Marshal(response); err != nil {
+		return fmt.Errorf("failed to encode %s response: %w", kind, err)
+	}
+	interaction.TaskID, _ = ctx.Value("task_id").(string)
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.mu.Unlock()
+
+	return callErr
+}
+
+// replay 返回与请求匹配的下一个录制结果
+func (c *Cassette) replay(interaction Interaction, response interface{}) error {
+	c.mu.Lock()
+	key := interaction.key()
+	queue := c.queues[key]
+	if len(queue) == 0 {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %s %s", ErrCassetteMismatch, interaction.Kind, interaction.Name)
+	}
+	recorded := c.interactions[queue[0]]
+	c.played[queue[0]] = true
+	c.queues[key] = queue[1:]
+	c.mu.Unlock()
+
+	if recorded.Error != "" {
+		return replayError(recorded.Error, recorded.ErrorCode)
+	}
+	if err := json.Unmarshal(recorded.Response, response); err != nil {
+		return fmt.Errorf("failed to decode recorded %s response: %w", recorded.Kind, err)
+	}
+	return nil
+}
+
+// cassetteProvider 是录制或回放调用的提供者
+type cassetteProvider struct {
+	cassette *Cassette
+	name     string
+	inner    types.Provider // 回放时为空
+}
+
+// errNoProvider 表示录制模式下没有可调用的真实提供者
+var errNoProvider = errors.New("replay provider cannot record calls")
+
+func (p *cassetteProvider) Name() string {
+	return p.name
+}
+
+func (p *cassetteProvider) ListModels(ctx context.Context) ([]types.ModelInfo, error) {
+	var models []types.ModelInfo
+	err := p.cassette.exchange(ctx, "list_models", p.name, "", nil, &models, func() error {
+		if p.inner == nil {
+			return errNoProvider
+		}
+		var err error
+		models, err = p.inner.ListModels(ctx)
+		return err
+	})
+	return models, err
+}
+
+func (p *cassetteProvider) GetModel(ctx context.Context, modelID string) (types.ModelInfo, error) {
+	var model types.ModelInfo
+	err := p.cassette.exchange(ctx, "get_model", p.name, modelID, nil, &model, func() error {
+		if p.inner == nil {
+			return errNoProvider
+		}
+		var err error
+		model, err = p.inner.GetModel(ctx, modelID)
+		return err
+	})
+	return model, err
+}
+
+func (p *cassetteProvider) Complete(ctx context.Context, modelID string, request types.CompletionRequest) (types.CompletionResponse, error) {
+	var response types.CompletionResponse
+	err := p.cassette.exchange(ctx, "complete", p.name, modelID, request, &response, func() error {
+		if p.inner == nil {
+			return errNoProvider
+		}
+		var err error
+		response, err = p.inner.Complete(ctx, modelID, request)
+		return err
+	})
+	return response, err
+}
+
+func (p *cassetteProvider) Chat(ctx context.Context, modelID string, request types.ChatRequest) (types.ChatResponse, error) {
+	var response types.ChatResponse
+	err := p.cassette.exchange(ctx, "chat", p.name, modelID, request, &response, func() error {
+		if p.inner == nil {
+			return errNoProvider
+		}
+		var err error
+		response, err = p.inner.Chat(ctx, modelID, request)
+		return err
+	})
+	return response, err
+}
+
+// ChatStream 执行流式聊天补全。录制时转发并记录生成的每段文本，回放时按录制顺序发送。
+// 被包装的提供者不支持流式输出时，完整回复作为一段文本发送
+func (p *cassetteProvider) ChatStream(ctx context.Context, modelID string, request types.ChatRequest, onDelta func(delta string) error) (types.ChatResponse, error) {
+	var response chatStreamResponse
+	err := p.cassette.exchange(ctx, "chat", p.name, modelID, request, &response, func() error {
+		if p.inner == nil {
+			return errNoProvider
+		}
+		streaming, ok := p.inner.(types.StreamingProvider)
+		if !ok {
+			var err error
+			response.ChatResponse, err = p.inner.Chat(ctx, modelID, request)
+			return err
+		}
+
+		var err error
+		response.ChatResponse, err = streaming.ChatStream(ctx, modelID, request, func(delta string) error {
+			response.Deltas = append(response.Deltas, delta)
+			if onDelta != nil {
+				return onDelta(delta)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return types.ChatResponse{}, err
+	}
+
+	// 录制时文本已经转发，非流式提供者的回复和回放的文本在此发送
+	if onDelta != nil && (p.cassette.mode == CassetteReplay || len(response.Deltas) == 0) {
+		deltas := response.Deltas
+		if len(deltas) == 0 && response.Message.Content != "" {
+			deltas = []string{response.Message.Content}
+		}
+		for _, delta := range deltas {
+			if err := onDelta(delta); err != nil {
+				return types.ChatResponse{}, err
+			}
+		}
+	}
+	return response.ChatResponse, nil
+}
+
+func (p *cassetteProvider) Embed(ctx context.Context, modelID string, request types.EmbeddingRequest) (types.EmbeddingResponse, error) {
+	var response types.EmbeddingResponse
+	err := p.cassette.exchange(ctx, "embed", p.name, modelID, request, &response, func() error {
+		if p.inner == nil {
+			return errNoProvider
+		}
+		var err error
+		response, err = p.inner.Embed(ctx, modelID, request)
+		return err
+	})
+	return response, err
+}
+
+func (p *cassetteProvider) GetEmbedModel() string {
+	if p.inner != nil {
+		return p.inner.GetEmbedModel()
+	}
+
+	p.cassette.mu.Lock()
+	defer p.cassette.mu.Unlock()
+	return p.cassette.embedModels[p.name]
+}
+
+// cassetteTool 是录制或回放执行结果的工具
+type cassetteTool struct {
+	tool.Tool
+	cassette *Cassette
+}
+
+// Execute 执行工具。结果以JSON录制，回放时字符串结果原样返回，
+// 其他结果以json.RawMessage返回，序列化后与录制时的结果一致
+func (t *cassetteTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	var result interface{}
+	var raw json.RawMessage
+	err := t.cassette.exchange(ctx, "tool", t.ID(), "", params, &raw, func() error {
+		var err error
+		if result, err = t.Tool.Execute(ctx, params); err != nil {
+			return err
+		}
+		raw, err = json.Marshal(result)
+		return err
+	})
+	if err != nil || t.cassette.mode == CassetteRecord {
+		return result, err
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+	return raw, nil
+}
+
+// Metadata 返回被包装工具的元数据
+func (t *cassetteTool) Metadata() tool.ToolMetadata {
+	if mp, ok := t.Tool.(tool.MetadataProvider); ok {
+		return mp.Metadata()
+	}
+	return tool.ToolMetadata{ID: t.ID(), Name: t.Name(), Description: t.Description(), Version: t.Version()}
+}
+
+// ConfigSchema 返回被包装工具的配置规格
+func (t *cassetteTool) ConfigSchema() []tool.ParameterSpec {
+	if c, ok := t.Tool.(tool.Configurable); ok {
+		return c.ConfigSchema()
+	}
+	return nil
+}
+
+// WithConfig 配置被包装的工具，并继续录制或回放其执行结果
+func (t *cassetteTool) WithConfig(config map[string]interface{}) (tool.Tool, error) {
+	c, ok := t.Tool.(tool.Configurable)
+	if !ok {
+		return nil, fmt.Errorf("tool %s does not accept configuration", t.ID())
+	}
+	configured, err := c.WithConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return t.cassette.WrapTool(configured), nil
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/memory"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// runRecordedTask 使用给定的提供者和工具执行一个对话任务，返回任务状态和事件类型序列
+func runRecordedTask(t *testing.T, provider types.Provider, repeat tool.Tool, input string) (types.TaskStatus, []string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	service := llm.NewService()
+	if err := service.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+	toolMgr := tool.NewManager()
+	if err := toolMgr.RegisterTool(ctx, repeat); err != nil {
+		t.Fatalf("注册工具失败: %v", err)
+	}
+	mgr := NewManager(toolMgr, memory.NewManager(), nil, service, nil, nil)
+
+	if _, err := mgr.CreateAgent(ctx, AgentConfig{
+		ID:    "recorded",
+		Name:  "Recorded",
+		Model: ModelConfig{Type: "fake-model"},
+		Tools: []ToolConfig{{ID: "repeat"}},
+	}); err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: "recorded"})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	status := runConversation(t, mgr, "recorded", types.Task{ID: "recorded-1", Parameters: map[string]interface{}{"input": input}})
+
+	var events []string
+	for event := range sub.Events() {
+		events = append(events, event.Type)
+		if event.Type == "task_completed" || event.Type == "task_failed" {
+			break
+		}
+	}
+	return status, events
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+
+	// 录制：调用真实的提供者和工具
+	provider := newFakeProvider(
+		"Action: repeat\nAction Input: {\"word\": \"go\", \"times\": 2}",
+		"Final Answer: gogo",
+	)
+	recorder := NewCassette()
+	recordedTool := &fakeTool{id: "repeat"}
+	recorded, recordedEvents := runRecordedTask(t, recorder.RecordProvider(provider), recorder.WrapTool(recordedTool), "hello")
+	if recorded.Status != "completed" {
+		t.Fatalf("录制的任务失败: %v", recorded.Error)
+	}
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("保存录像带失败: %v", err)
+	}
+
+	// 回放：不调用提供者和工具，得到相同的结果和事件
+	player, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("读取录像带失败: %v", err)
+	}
+	replayedTool := &fakeTool{id: "repeat"}
+	replayed, replayedEvents := runRecordedTask(t, player.ReplayProvider("fake"), player.WrapTool(replayedTool), "hello")
+	if replayed.Status != "completed" {
+		t.Fatalf("回放的任务失败: %v", replayed.Error)
+	}
+
+	want := recorded.Result.(types.Result).Data
+	got := replayed.Result.(types.Result).Data
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("回放结果不一致:\n录制 %v\n回放 %v", want, got)
+	}
+	if fmt.Sprint(replayedEvents) != fmt.Sprint(recordedEvents) {
+		t.Errorf("回放事件不一致:\n录制 %v\n回放 %v", recordedEvents, replayedEvents)
+	}
+	if len(replayedTool.calls) != 0 || len(player.Unplayed()) != 0 {
+		t.Errorf("期望回放不执行工具且用完录制结果，实际执行 %d 次，剩余 %d 条", len(replayedTool.calls), len(player.Unplayed()))
+	}
+
+	// 请求与录制时不同时任务失败
+	player, _ = LoadCassette(path)
+	status, _ := runRecordedTask(t, player.ReplayProvider("fake"), player.WrapTool(&fakeTool{id: "repeat"}), "something else")
+	if status.Status != "failed" || !errors.Is(status.Error, ErrCassetteMismatch) {
+		t.Errorf("期望请求不匹配时失败，实际为 %s %v", status.Status, status.Error)
+	}
+}
+
+func TestCassetteReplayErrorsAndStreams(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "run.json")
+	request := types.ChatRequest{Messages: []types.Message{{Role: "user", Content: "hi"}}}
+
+	// 录制一次限流错误和一次流式回复
+	recorder := NewCassette()
+	provider := recorder.RecordProvider(&flakyProvider{
+		fakeProvider: *newFakeProvider("Hello there, Alice."),
+		failures:     1,
+		err:          fmt.Errorf("429 too many requests: %w", types.ErrRateLimited),
+	})
+	if _, err := provider.Chat(ctx, "fake-model", request); !errors.Is(err, types.ErrRateLimited) {
+		t.Fatalf("期望录制时得到限流错误，实际得到 %v", err)
+	}
+	streaming := recorder.RecordProvider(&streamingProvider{newFakeProvider("Hello there, Alice.")})
+	var recorded []string
+	if _, err := streaming.(types.StreamingProvider).ChatStream(ctx, "fake-model", request, func(delta string) error {
+		recorded = append(recorded, delta)
+		return nil
+	}); err != nil {
+		t.Fatalf("录制流式回复失败: %v", err)
+	}
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("保存录像带失败: %v", err)
+	}
+
+	player, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("读取录像带失败: %v", err)
+	}
+	replay := player.ReplayProvider("fake").(types.StreamingProvider)
+
+	// 回放的错误保持录制时的消息和类型，重试判断与录制时一致
+	_, err = replay.Chat(ctx, "fake-model", request)
+	if !errors.Is(err, types.ErrRateLimited) || err.Error() != "429 too many requests: llm rate limit exceeded" {
+		t.Errorf("回放的错误不一致: %v", err)
+	}
+
+	// 流式回复按录制时的分段回放
+	var replayed []string
+	response, err := replay.ChatStream(ctx, "fake-model", request, func(delta string) error {
+		replayed = append(replayed, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("回放流式回复失败: %v", err)
+	}
+	if len(recorded) < 2 || fmt.Sprint(replayed) != fmt.Sprint(recorded) || response.Message.Content != "Hello there, Alice." {
+		t.Errorf("回放的分段不一致:\n录制 %q\n回放 %q", recorded, replayed)
+	}
+}
@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+const (
+	defaultConversationID      = "default"
+	conversationHistoryLimit   = 10 // 注入提示的最大历史轮数
+	conversationKnowledgeLimit = 3  // 注入提示的最大知识条数
+	conversationMemoryKind     = "conversation_turn"
+	defaultSystemPrompt        = "You are a helpful assistant."
+)
+
+// conversationTurn 代表一轮对话（用户输入和助手回复）
+type conversationTurn struct {
+	Input    string
+	Response string
+}
+
+// chat 使用Agent的模型配置调用LLM服务，生成的文本全部作为任务输出发布
+func (r *Runtime) chat(ctx context.Context, messages []types.Message) (types.ChatResponse, error) {
+	return r.sendChat(ctx, types.ChatRequest{Messages: messages}, tokensAll)
+}
+
+// sendChat 补全请求中的模型参数并经中间件发送给LLM服务，同时计量用量并检查预算。
+// 生成的文本按mode作为任务的增量输出发布
+func (r *Runtime) sendChat(ctx context.Context, request types.ChatRequest, mode tokenMode) (types.ChatResponse, error) {
+	if r.llm == nil {
+		return types.ChatResponse{}, types.ErrLLMNotAvailable
+	}
+
+	provider, err := r.resolveProvider()
+	if err != nil {
+		return types.ChatResponse{}, err
+	}
+
+	// 预算已用完时不再调用模型
+	if err := r.enforceBudget(ctx, true); err != nil {
+		return types.ChatResponse{}, err
+	}
+
+	modelConfig := r.agent.config.Model
+	request.MaxTokens = modelConfig.MaxTokens
+	request.Temperature = modelConfig.Temperature
+
+	// 中间件可以在发送前修改请求
+	mws := r.middlewares()
+	err = r.runBefore(ctx, StageModel, mws, func(mw Middleware) error {
+		if mw.BeforeModel == nil {
+			return nil
+		}
+		return mw.BeforeModel(ctx, &request)
+	})
+	if err != nil {
+		notifyError(ctx, StageModel, mws, err)
+		return types.ChatResponse{}, err
+	}
+
+	tokens := r.newTokenStream(ctx, mode, mws)
+	start := time.Now()
+	response, err := r.llm.ChatStream(ctx, provider, modelConfig.Type, request, tokens.write)
+	if err != nil {
+		notifyError(ctx, StageModel, mws, err)
+		return response, err
+	}
+	r.meterUsage(ctx, provider, response.Usage, time.Since(start))
+
+	if err := r.enforceBudget(ctx, false); err != nil {
+		return types.ChatResponse{}, err
+	}
+
+	err = r.runAfter(ctx, StageModel, mws, func(mw Middleware) error {
+		if mw.AfterModel == nil {
+			return nil
+		}
+		return mw.AfterModel(ctx, request, &response)
+	})
+	if err != nil {
+		notifyError(ctx, StageModel, mws, err)
+		return types.ChatResponse{}, err
+	}
+	tokens.flush(response.Message.Content)
+	return response, nil
+}
+
+// resolveProvider 确定要使用的LLM提供者
+func (r *Runtime) resolveProvider() (string, error) {
+	if provider := r.agent.config.Model.Provider; provider != "" {
+		return provider, nil
+	}
+
+	// 未指定提供者时，仅在只注册了一个提供者的情况下自动选择
+	providers := r.llm.ListProviders()
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+
+	return "", fmt.Errorf("model provider not specified and %d providers registered", len(providers))
+}
+
+// loadConversationHistory 从记忆中获取对话历史，按时间先后排列
+func (r *Runtime) loadConversationHistory(ctx context.Context, conversationID string, limit int) ([]conversationTurn, error) {
+	if r.memory == nil {
+		return nil, nil
+	}
+
+	memories, err := r.retrieveMemory(ctx, types.MemoryQuery{
+		Context: map[string]interface{}{
+			"agent_id":        r.agent.id,
+			"conversation_id": conversationID,
+			"kind":            conversationMemoryKind,
+		},
+		Limit: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 检索结果按最新优先排列，需要反转为时间顺序
+	turns := make([]conversationTurn, 0, len(memories))
+	for i := len(memories) - 1; i >= 0; i-- {
+		content, ok := memories[i].Content.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		input, _ := content["input"].(string)
+		response, _ := content["response"].(string)
+		turns = append(turns, conversationTurn{Input: input, Response: response})
+	}
+
+	return turns, nil
+}
+
+// lookupKnowledge 检索与输入相关的知识，检索失败时不影响对话
+func (r *Runtime) lookupKnowledge(ctx context.Context, input string, limit int) []types.Knowledge {
+	if r.knowledge == nil {
+		return nil
+	}
+
+	results, err := r.getRelevantKnowledge(ctx, input, limit)
+	if err != nil {
+		r.recordEvent(ctx, "knowledge_retrieval_failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+
+	return results
+}
+
+// buildConversationMessages 构建发送给LLM的消息列表
+func (r *Runtime) buildConversationMessages(history []conversationTurn, knowledge []types.Knowledge, input string) []types.Message {
+	systemPrompt := r.agent.config.Model.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = defaultSystemPrompt
+	}
+
+	// 将检索到的知识注入系统提示
+	if len(knowledge) > 0 {
+		var sb strings.Builder
+		sb.WriteString(systemPrompt)
+		sb.WriteString("\n\nRelevant knowledge:")
+		for _, k := range knowledge {
+			sb.WriteString("\n- ")
+			sb.WriteString(fmt.Sprintf("%v", k.Content))
+		}
+		systemPrompt = sb.String()
+	}
+
+	messages := make([]types.Message, 0, len(history)*2+2)
+	messages = append(messages, types.Message{Role: types.RoleSystem, Content: systemPrompt})
+	for _, turn := range history {
+		messages = append(messages,
+			types.Message{Role: types.RoleUser, Content: turn.Input},
+			types.Message{Role: types.RoleAssistant, Content: turn.Response},
+		)
+	}
+	messages = append(messages, types.Message{Role: types.RoleUser, Content: input})
+
+	return messages
+}
+
+// saveConversationTurn 将本轮对话写回记忆
+func (r *Runtime) saveConversationTurn(ctx context.Context, conversationID, input, response string) {
+	if r.memory == nil {
+		return
+	}
+
+	mem := types.Memory{
+		ID:   uuid.New().String(),
+		Type: types.ShortTerm,
+		Content: map[string]interface{}{
+			"input":    input,
+			"response": response,
+		},
+		Importance: 0.6,
+		Context: map[string]interface{}{
+			"agent_id":        r.agent.id,
+			"conversation_id": conversationID,
+			"kind":            conversationMemoryKind,
+		},
+		Timestamp: time.Now(),
+	}
+
+	if err := r.memory.Store(ctx, mem); err != nil {
+		r.recordEvent(ctx, "memory_store_failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule 是解析后的cron表达式，每个字段用位集合表示允许的取值
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // 日期和星期字段是否为*
+}
+
+// cronBounds 定义了cron字段的取值范围
+type cronBounds struct {
+	min, max int
+}
+
+var (
+	minuteBounds = cronBounds{0, 59}
+	hourBounds   = cronBounds{0, 23}
+	domBounds    = cronBounds{1, 31}
+	monthBounds  = cronBounds{1, 12}
+	dowBounds    = cronBounds{0, 7} // 0和7都表示星期日
+)
+
+// cronShortcuts 是预定义的cron表达式
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron 解析标准的5字段cron表达式（分 时 日 月 星期），
+// 支持*、列表、范围、步长以及@daily等预定义表达式
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if shortcut, ok := cronShortcuts[expr]; ok {
+		expr = shortcut
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: cron expression %q must have 5 fields", ErrInvalidSchedule, expr)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+	return &s, nil
+}
+
+// parseCronField 解析一个cron字段
+func parseCronField(field string, bounds cronBounds) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%w: invalid step in %q", ErrInvalidSchedule, part)
+			}
+		}
+
+		start, end := bounds.min, bounds.max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			lo, hi, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			start, err1 = strconv.Atoi(lo)
+			end, err2 = strconv.Atoi(hi)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("%w: invalid range %q", ErrInvalidSchedule, part)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid value %q", ErrInvalidSchedule, part)
+			}
+			start = value
+			if !hasStep {
+				end = value
+			}
+		}
+
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("%w: %q out of range [%d, %d]", ErrInvalidSchedule, part, bounds.min, bounds.max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// next 返回t之后第一个满足表达式的时间，精确到分钟，五年内没有匹配时返回零值
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches 判断日期是否匹配。日期和星期字段都有限制时，满足其一即可
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,243 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+const defaultEventBuffer = 100
+
+// DropPolicy 决定订阅者缓冲区已满时如何处理新事件
+type DropPolicy int
+
+const (
+	// DropNewest 丢弃新到达的事件（默认）
+	DropNewest DropPolicy = iota
+	// DropOldest 丢弃缓冲区中最旧的事件，为新事件腾出空间
+	DropOldest
+	// BlockPublisher 阻塞发布者直到订阅者取走事件或取消订阅，
+	// 慢订阅者会拖慢所有事件的发布，仅适用于不能丢失事件的场景
+	BlockPublisher
+)
+
+// SubscribeOptions 配置一个事件订阅
+type SubscribeOptions struct {
+	AgentID    string     // 只接收该Agent的事件，为空时接收所有Agent的事件
+	Types      []string   // 只接收这些类型的事件，为空时接收所有类型
+	BufferSize int        // 订阅者缓冲区大小，默认100
+	DropPolicy DropPolicy // 缓冲区已满时的处理策略
+}
+
+// Subscription 是事件总线上的一个订阅
+type Subscription struct {
+	bus     *EventBus
+	opts    SubscribeOptions
+	types   map[string]bool
+	ch      chan Event
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// Events 返回接收事件的通道，取消订阅后通道被关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped 返回因缓冲区已满被丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe 取消订阅并关闭事件通道，可重复调用
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		// 先唤醒阻塞在该订阅上的发布者，再在写锁内关闭通道，
+		// 保证关闭后不会再有发布者向通道发送事件
+		close(s.done)
+
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		close(s.ch)
+		s.bus.mu.Unlock()
+	})
+}
+
+// matches 判断事件是否符合订阅条件
+func (s *Subscription) matches(event Event) bool {
+	if s.opts.AgentID != "" && s.opts.AgentID != event.AgentID {
+		return false
+	}
+	return len(s.types) == 0 || s.types[event.Type]
+}
+
+// deliver 按丢弃策略将事件放入订阅者缓冲区
+func (s *Subscription) deliver(event Event) {
+	switch s.opts.DropPolicy {
+	case BlockPublisher:
+		select {
+		case s.ch <- event:
+		case <-s.done:
+		}
+	case DropOldest:
+		select {
+		case s.ch <- event:
+			return
+		default:
+		}
+		// 缓冲区已满，丢弃最旧的事件后重试
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+		select {
+		case s.ch <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	default:
+		select {
+		case s.ch <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// EventBus 是支持多订阅者的事件总线，每个事件会分发给所有符合条件的订阅者
+type EventBus struct {
+	mu      sync.RWMutex
+	subs    map[*Subscription]struct{}
+	journal EventJournal
+	seq     atomic.Uint64
+}
+
+// NewEventBus 创建一个新的事件总线。journal不为空时，
+// 每个事件在分发前先写入事件日志，并由日志分配序号
+func NewEventBus(journal EventJournal) *EventBus {
+	return &EventBus{
+		subs:    make(map[*Subscription]struct{}),
+		journal: journal,
+	}
+}
+
+// Subscribe 创建一个订阅，ctx结束时自动取消订阅
+func (b *EventBus) Subscribe(ctx context.Context, opts SubscribeOptions) *Subscription {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultEventBuffer
+	}
+
+	sub := &Subscription{
+		bus:  b,
+		opts: opts,
+		ch:   make(chan Event, opts.BufferSize),
+		done: make(chan struct{}),
+	}
+	if len(opts.Types) > 0 {
+		sub.types = make(map[string]bool, len(opts.Types))
+		for _, t := range opts.Types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				sub.Unsubscribe()
+			case <-sub.done:
+			}
+		}()
+	}
+
+	return sub
+}
+
+// Publish 将事件写入事件日志并分发给所有符合条件的订阅者。
+// 写入日志失败时事件仍会分发，并返回写入错误
+func (b *EventBus) Publish(event Event) error {
+	if event.TaskID == "" {
+		event.TaskID = eventTaskID(event.Data)
+	}
+
+	var err error
+	if b.journal != nil {
+		if err = b.journal.Append(context.Background(), &event); err != nil {
+			err = fmt.Errorf("failed to journal event %s: %w", event.Type, err)
+		}
+	} else {
+		event.Seq = b.seq.Add(1)
+	}
+
+	b.broadcast(event)
+	return err
+}
+
+// emit 发布事件，写入事件日志失败时向订阅者广播journal_write_failed事件。
+// 该事件不写入事件日志，避免事件日志不可用时反复失败
+func (b *EventBus) emit(event Event) {
+	err := b.Publish(event)
+	if err == nil {
+		return
+	}
+
+	failed := NewEvent(uuid.New().String(), "journal_write_failed", map[string]interface{}{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"error":      err.Error(),
+	})
+	failed.AgentID = event.AgentID
+	failed.TaskID = event.TaskID
+	if failed.TaskID == "" {
+		failed.TaskID = eventTaskID(event.Data)
+	}
+	b.broadcast(*failed)
+}
+
+// broadcast 将事件分发给所有符合条件的订阅者，不写入事件日志也不分配序号。
+// 用于任务增量输出这类数量大、无需重放的事件
+func (b *EventBus) broadcast(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if sub.matches(event) {
+			sub.deliver(event)
+		}
+	}
+}
+
+// eventTaskID 从事件数据中取出关联的任务ID
+func eventTaskID(data interface{}) string {
+	if fields, ok := data.(map[string]interface{}); ok {
+		if taskID, ok := fields["task_id"].(string); ok {
+			return taskID
+		}
+	}
+	return ""
+}
+
+// closeAgent 取消所有只订阅了指定Agent的订阅，订阅所有Agent的订阅不受影响
+func (b *EventBus) closeAgent(agentID string) {
+	b.mu.RLock()
+	var subs []*Subscription
+	for sub := range b.subs {
+		if sub.opts.AgentID == agentID {
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+}
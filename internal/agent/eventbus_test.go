@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+func TestEventBusFanOut(t *testing.T) {
+	bus := NewEventBus(nil)
+	ctx := context.Background()
+
+	first := bus.Subscribe(ctx, SubscribeOptions{AgentID: "a"})
+	second := bus.Subscribe(ctx, SubscribeOptions{AgentID: "a", Types: []string{"task_completed"}})
+	global := bus.Subscribe(ctx, SubscribeOptions{})
+
+	bus.Publish(Event{AgentID: "a", Type: "task_started"})
+	bus.Publish(Event{AgentID: "a", Type: "task_completed"})
+	bus.Publish(Event{AgentID: "b", Type: "task_completed"})
+
+	// 每个订阅者都收到各自符合条件的全部事件，互不抢占
+	if n := len(first.Events()); n != 2 {
+		t.Errorf("期望Agent订阅收到2个事件，实际收到 %d 个", n)
+	}
+	if n := len(second.Events()); n != 1 {
+		t.Errorf("期望类型过滤后收到1个事件，实际收到 %d 个", n)
+	}
+	if n := len(global.Events()); n != 3 {
+		t.Errorf("期望全局订阅收到3个事件，实际收到 %d 个", n)
+	}
+
+	// 关闭Agent只结束该Agent的订阅
+	bus.closeAgent("a")
+	for range first.Events() {
+	}
+	for range second.Events() {
+	}
+	bus.Publish(Event{AgentID: "b", Type: "task_started"})
+	if n := len(global.Events()); n != 4 {
+		t.Errorf("全局订阅不应受关闭Agent影响，实际收到 %d 个事件", n)
+	}
+}
+
+func TestEventBusDropPolicy(t *testing.T) {
+	bus := NewEventBus(nil)
+	ctx := context.Background()
+
+	newest := bus.Subscribe(ctx, SubscribeOptions{BufferSize: 2, DropPolicy: DropNewest})
+	oldest := bus.Subscribe(ctx, SubscribeOptions{BufferSize: 2, DropPolicy: DropOldest})
+	for _, id := range []string{"1", "2", "3"} {
+		bus.Publish(Event{ID: id})
+	}
+
+	testCases := []struct {
+		name string
+		sub  *Subscription
+		want []string
+	}{
+		{name: "丢弃新事件", sub: newest, want: []string{"1", "2"}},
+		{name: "丢弃旧事件", sub: oldest, want: []string{"2", "3"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.sub.Dropped() != 1 {
+				t.Errorf("期望丢弃1个事件，实际丢弃 %d 个", tc.sub.Dropped())
+			}
+			for _, want := range tc.want {
+				if event := <-tc.sub.Events(); event.ID != want {
+					t.Errorf("期望事件 %s，实际为 %s", want, event.ID)
+				}
+			}
+		})
+	}
+
+	// 阻塞策略下发布者等待订阅者取走事件，取消订阅后解除阻塞
+	blocking := bus.Subscribe(ctx, SubscribeOptions{BufferSize: 1, DropPolicy: BlockPublisher})
+	bus.Publish(Event{ID: "4"})
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(Event{ID: "5"})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("缓冲区已满时发布者应被阻塞")
+	case <-time.After(20 * time.Millisecond):
+	}
+	blocking.Unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("取消订阅后发布者仍被阻塞")
+	}
+}
+
+func TestManagerSubscribe(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong"))
+
+	subCtx, cancel := context.WithCancel(ctx)
+	global, err := mgr.Subscribe(subCtx, SubscribeOptions{Types: []string{"agent_created", "task_started", "task_finished"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	agentID := createTestAgent(t, mgr)
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	if _, err := mgr.WaitTask(ctx, task.ID); err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+
+	// 运行时产生的任务事件也经由事件总线发布
+	want := []string{"agent_created", "task_started", "task_finished"}
+	for _, eventType := range want {
+		select {
+		case event := <-global.Events():
+			if event.Type != eventType || event.AgentID != agentID {
+				t.Errorf("期望Agent %s 的 %s 事件，实际为 %s 的 %s 事件", agentID, eventType, event.AgentID, event.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("等待 %s 事件超时", eventType)
+		}
+	}
+
+	// 取消ctx后订阅结束
+	cancel()
+	waitFor(t, func() bool {
+		select {
+		case _, ok := <-global.Events():
+			return !ok
+		default:
+			return false
+		}
+	})
+
+	if _, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: "missing"}); err != ErrAgentNotFound {
+		t.Errorf("期望Agent不存在错误，实际得到 %v", err)
+	}
+}
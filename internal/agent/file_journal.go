@@ -0,0 +1,301 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSegmentSize = 16 << 20
+	segmentPrefix      = "events-"
+	segmentSuffix      = ".jsonl"
+)
+
+// journalSegment 是事件日志的一个分段文件，文件名包含其第一个事件的序号
+type journalSegment struct {
+	firstSeq uint64
+	path     string
+}
+
+// FileEventJournal 是基于文件的事件日志。事件按JSON行追加写入目录下的分段文件，
+// 当前分段超过大小上限时滚动到新分段，并按保留数量删除最旧的分段
+type FileEventJournal struct {
+	mu          sync.Mutex
+	dir         string
+	maxSize     int64
+	maxSegments int
+	segments    []journalSegment
+	file        *os.File
+	size        int64
+	seq         uint64
+	closed      bool
+}
+
+// NewFileEventJournal 打开或创建指定目录下的事件日志。
+// maxSize为单个分段的大小上限，不大于0时使用16MB；
+// maxSegments为保留的分段数量，不大于0时保留全部分段
+func NewFileEventJournal(dir string, maxSize int64, maxSegments int) (*FileEventJournal, error) {
+	if maxSize <= 0 {
+		maxSize = defaultSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event journal directory: %w", err)
+	}
+
+	j := &FileEventJournal{
+		dir:         dir,
+		maxSize:     maxSize,
+		maxSegments: maxSegments,
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load 查找已有分段，并从最后一个分段恢复序号
+func (j *FileEventJournal) load() error {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read event journal directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		firstSeq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		j.segments = append(j.segments, journalSegment{firstSeq: firstSeq, path: filepath.Join(j.dir, name)})
+	}
+	sort.Slice(j.segments, func(a, b int) bool {
+		return j.segments[a].firstSeq < j.segments[b].firstSeq
+	})
+
+	if len(j.segments) == 0 {
+		return nil
+	}
+
+	last := j.segments[len(j.segments)-1]
+	// 进程崩溃时最后一行可能只写入了一部分，截掉它，否则之后追加的事件会与之拼成无法解析的一行
+	if err := truncatePartialLine(last.path); err != nil {
+		return err
+	}
+	j.seq = last.firstSeq - 1
+	if err := readSegment(last.path, func(event Event) bool {
+		j.seq = event.Seq
+		return true
+	}); err != nil {
+		return err
+	}
+
+	j.file, err = os.OpenFile(last.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event journal: %w", err)
+	}
+	info, err := j.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat event journal: %w", err)
+	}
+	j.size = info.Size()
+	return nil
+}
+
+// Append 追加事件。事件写入操作系统缓冲后即返回，关闭日志时同步到磁盘
+func (j *FileEventJournal) Append(ctx context.Context, event *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return fmt.Errorf("event journal is closed")
+	}
+
+	event.Seq = j.seq + 1
+	line, err := json.Marshal(event)
+	if err != nil {
+		// 事件数据无法编码时保留其文本形式，保证日志不缺失序号
+		copied := *event
+		copied.Data = fmt.Sprintf("%v", event.Data)
+		if line, err = json.Marshal(copied); err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+	}
+	line = append(line, '\n')
+
+	if j.file == nil || (j.size > 0 && j.size+int64(len(line)) > j.maxSize) {
+		if err := j.rotate(event.Seq); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write event journal: %w", err)
+	}
+	j.seq = event.Seq
+	return nil
+}
+
+// rotate 关闭当前分段并创建以firstSeq命名的新分段，调用方需持有锁
+func (j *FileEventJournal) rotate(firstSeq uint64) error {
+	if j.file != nil {
+		j.file.Sync()
+		j.file.Close()
+		j.file = nil
+	}
+
+	path := filepath.Join(j.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, firstSeq, segmentSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create event journal segment: %w", err)
+	}
+	j.file = file
+	j.size = 0
+	j.segments = append(j.segments, journalSegment{firstSeq: firstSeq, path: path})
+
+	// 删除超出保留数量的旧分段
+	if j.maxSegments > 0 && len(j.segments) > j.maxSegments {
+		expired := j.segments[:len(j.segments)-j.maxSegments]
+		for _, segment := range expired {
+			os.Remove(segment.path)
+		}
+		j.segments = append([]journalSegment(nil), j.segments[len(expired):]...)
+	}
+	return nil
+}
+
+// Replay 返回符合条件的事件，只读取可能包含所需序号的分段
+func (j *FileEventJournal) Replay(ctx context.Context, query EventQuery) ([]Event, error) {
+	j.mu.Lock()
+	segments := append([]journalSegment(nil), j.segments...)
+	lastSeq := j.seq
+	j.mu.Unlock()
+
+	var events []Event
+	for i, segment := range segments {
+		// 下一个分段的起始序号不大于AfterSeq+1时，本分段不包含所需事件
+		if i+1 < len(segments) && segments[i+1].firstSeq <= query.AfterSeq+1 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err := readSegment(segment.path, func(event Event) bool {
+			if event.Seq > lastSeq || query.full(events) {
+				return false
+			}
+			if query.matches(event) {
+				events = append(events, event)
+			}
+			return true
+		})
+		if os.IsNotExist(err) {
+			// 分段在读取前已因滚动被删除
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if query.full(events) {
+			break
+		}
+	}
+	return events, nil
+}
+
+// Close 同步并关闭当前分段
+func (j *FileEventJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	if j.file == nil {
+		return nil
+	}
+	j.file.Sync()
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// truncatePartialLine 将文件截断到最后一个换行符之后
+func truncatePartialLine(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event journal: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat event journal: %w", err)
+	}
+
+	// 从文件末尾向前查找换行符
+	end := info.Size()
+	buf := make([]byte, 4096)
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		if _, err := file.ReadAt(buf[:n], end-n); err != nil {
+			return fmt.Errorf("failed to read event journal: %w", err)
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+
+	if end == info.Size() {
+		return nil
+	}
+	if err := file.Truncate(end); err != nil {
+		return fmt.Errorf("failed to truncate event journal: %w", err)
+	}
+	return file.Sync()
+}
+
+// readSegment 依次读取分段中的事件，fn返回false时停止
+func readSegment(path string, fn func(Event) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// 进程崩溃时最后一行可能不完整，跳过无法解析的行
+			continue
+		}
+		if !fn(event) {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event journal: %w", err)
+	}
+	return nil
+}
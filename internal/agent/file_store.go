@@ -0,0 +1,270 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileStoreEntry 是任务日志中的一行
+type fileStoreEntry struct {
+	Op     string      `json:"op"` // "save" 或 "delete"
+	TaskID string      `json:"task_id,omitempty"`
+	Record *TaskRecord `json:"record,omitempty"`
+}
+
+// compactMinEntries 是触发自动压缩的最少日志行数
+const compactMinEntries = 1024
+
+// FileTaskStore 是基于追加写JSON日志的任务存储。
+// 每次修改追加一行并同步到磁盘，打开时重放日志恢复任务记录并压缩日志；
+// 运行中日志行数超过记录数的两倍时自动压缩
+type FileTaskStore struct {
+	// OnCompactError 在自动压缩失败时调用，可为空，需在使用存储前设置。
+	// 修改已经写入日志，压缩失败不影响修改的结果
+	OnCompactError func(err error)
+
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	records map[string]TaskRecord
+	entries int // 日志中的行数
+}
+
+// NewFileTaskStore 打开或创建指定路径的任务存储
+func NewFileTaskStore(path string) (*FileTaskStore, error) {
+	s := &FileTaskStore{
+		path:    path,
+		records: make(map[string]TaskRecord),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	// 重放后压缩日志，只保留每个任务的最新记录
+	if err := s.Compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load 重放日志文件
+func (s *FileTaskStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open task log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var corrupt error
+	for line := 1; scanner.Scan(); line++ {
+		// 无法解析的行之后还有内容，说明日志已损坏而不是写入中断
+		if corrupt != nil {
+			return corrupt
+		}
+
+		var entry fileStoreEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// 进程崩溃时最后一行可能不完整，只跳过最后一行，打开后的压缩会将其清除
+			corrupt = fmt.Errorf("task log is corrupt at line %d: %w", line, err)
+			continue
+		}
+
+		switch entry.Op {
+		case "save":
+			if entry.Record != nil {
+				s.records[entry.Record.Task.ID] = *entry.Record
+			}
+		case "delete":
+			delete(s.records, entry.TaskID)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read task log: %w", err)
+	}
+	return nil
+}
+
+// Save 保存任务记录
+func (s *FileTaskStore) Save(ctx context.Context, record TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(fileStoreEntry{Op: "save", Record: &record}); err != nil {
+		return err
+	}
+	s.records[record.Task.ID] = record
+	s.maybeCompact()
+	return nil
+}
+
+// SaveBatch 保存多条任务记录，所有记录写入后只同步一次磁盘
+func (s *FileTaskStore) SaveBatch(ctx context.Context, records []TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]fileStoreEntry, len(records))
+	for i := range records {
+		entries[i] = fileStoreEntry{Op: "save", Record: &records[i]}
+	}
+	if err := s.append(entries...); err != nil {
+		return err
+	}
+	for _, record := range records {
+		s.records[record.Task.ID] = record
+	}
+	s.maybeCompact()
+	return nil
+}
+
+// Get 获取任务记录
+func (s *FileTaskStore) Get(ctx context.Context, taskID string) (TaskRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[taskID]
+	if !ok {
+		return TaskRecord{}, ErrTaskNotFound
+	}
+	return record, nil
+}
+
+// List 返回所有任务记录
+func (s *FileTaskStore) List(ctx context.Context) ([]TaskRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedRecords(s.records), nil
+}
+
+// Delete 删除任务记录
+func (s *FileTaskStore) Delete(ctx context.Context, taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(fileStoreEntry{Op: "delete", TaskID: taskID}); err != nil {
+		return err
+	}
+	delete(s.records, taskID)
+	s.maybeCompact()
+	return nil
+}
+
+// Compact 用当前任务记录重写日志文件
+func (s *FileTaskStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// maybeCompact 在日志中过时的行过多时压缩日志，调用方需持有锁。
+// 修改已经写入日志，压缩失败只通过OnCompactError报告，下次修改时重试
+func (s *FileTaskStore) maybeCompact() {
+	if s.entries < compactMinEntries || s.entries <= 2*len(s.records) {
+		return
+	}
+	if err := s.compact(); err != nil && s.OnCompactError != nil {
+		s.OnCompactError(fmt.Errorf("failed to compact task log: %w", err))
+	}
+}
+
+// compact 用当前任务记录重写日志文件，调用方需持有锁。
+// 失败时继续使用原日志文件
+func (s *FileTaskStore) compact() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create task log directory: %w", err)
+	}
+
+	// 先写入临时文件再替换，避免压缩过程中崩溃导致数据丢失
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create task log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, record := range sortedRecords(s.records) {
+		record := record
+		line, err := json.Marshal(fileStoreEntry{Op: "save", Record: &record})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode task %s: %w", record.Task.ID, err)
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write task log: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync task log: %w", err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace task log: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		// 原日志文件已被替换，不能再继续追加
+		if s.file != nil {
+			s.file.Close()
+			s.file = nil
+		}
+		return fmt.Errorf("failed to open task log: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.entries = len(s.records)
+	return nil
+}
+
+// Close 关闭日志文件
+func (s *FileTaskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// append 追加日志行并同步到磁盘，调用方需持有锁
+func (s *FileTaskStore) append(entries ...fileStoreEntry) error {
+	if s.file == nil {
+		return fmt.Errorf("task log is closed")
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode task log entry: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	if _, err := s.file.Write(buf); err != nil {
+		return fmt.Errorf("failed to write task log: %w", err)
+	}
+	s.entries += len(entries)
+	return s.file.Sync()
+}
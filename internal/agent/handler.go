@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// TaskHandler 处理一种类型的任务
+type TaskHandler interface {
+	// Parameters 返回任务参数规格，执行前据此校验任务参数
+	Parameters() []tool.ParameterSpec
+	// Handle 执行任务
+	Handle(ctx context.Context, task types.Task) (types.Result, error)
+}
+
+// HandlerFunc 是任务处理函数
+type HandlerFunc func(ctx context.Context, task types.Task) (types.Result, error)
+
+// funcHandler 将处理函数和参数规格组合为TaskHandler
+type funcHandler struct {
+	params []tool.ParameterSpec
+	fn     HandlerFunc
+}
+
+// NewTaskHandler 使用参数规格和处理函数创建任务处理器
+func NewTaskHandler(params []tool.ParameterSpec, fn HandlerFunc) TaskHandler {
+	return &funcHandler{params: params, fn: fn}
+}
+
+func (h *funcHandler) Parameters() []tool.ParameterSpec {
+	return h.params
+}
+
+func (h *funcHandler) Handle(ctx context.Context, task types.Task) (types.Result, error) {
+	return h.fn(ctx, task)
+}
+
+// HandlerRegistry 按任务类型注册任务处理器
+type HandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]TaskHandler
+}
+
+// NewHandlerRegistry 创建一个新的任务处理器注册表
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		handlers: make(map[string]TaskHandler),
+	}
+}
+
+// Register 注册任务类型的处理器，同一类型只能注册一次
+func (r *HandlerRegistry) Register(taskType string, handler TaskHandler) error {
+	if taskType == "" || handler == nil {
+		return ErrInvalidConfig
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[taskType]; ok {
+		return fmt.Errorf("%w: %s", ErrHandlerExists, taskType)
+	}
+	r.handlers[taskType] = handler
+	return nil
+}
+
+// Unregister 注销任务类型的处理器
+func (r *HandlerRegistry) Unregister(taskType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handlers, taskType)
+}
+
+// Get 获取任务类型的处理器
+func (r *HandlerRegistry) Get(taskType string) (TaskHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[taskType]
+	return handler, ok
+}
+
+// Types 返回已注册的任务类型
+func (r *HandlerRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	taskTypes := make([]string, 0, len(r.handlers))
+	for taskType := range r.handlers {
+		taskTypes = append(taskTypes, taskType)
+	}
+	sort.Strings(taskTypes)
+	return taskTypes
+}
+
+// globalHandlers 是所有Agent共享的任务处理器
+var globalHandlers = NewHandlerRegistry()
+
+// RegisterTaskHandler 注册对所有Agent生效的任务处理器
+func RegisterTaskHandler(taskType string, handler TaskHandler) error {
+	return globalHandlers.Register(taskType, handler)
+}
+
+// UnregisterTaskHandler 注销对所有Agent生效的任务处理器
+func UnregisterTaskHandler(taskType string) {
+	globalHandlers.Unregister(taskType)
+}
+
+// newBuiltinHandlers 创建运行时内置的任务处理器
+func newBuiltinHandlers(r *Runtime) *HandlerRegistry {
+	builtins := NewHandlerRegistry()
+
+	builtins.Register("conversation", NewTaskHandler([]tool.ParameterSpec{
+		{Name: "input", Type: "string", Description: "User input", Required: true},
+		{Name: "conversation_id", Type: "string", Description: "Conversation to continue"},
+	}, r.handleConversation))
+
+	builtins.Register("research", NewTaskHandler([]tool.ParameterSpec{
+		{Name: "topics", Type: "array", Description: "Topics to research", Required: true},
+	}, r.handleResearch))
+
+	builtins.Register("analysis", NewTaskHandler([]tool.ParameterSpec{
+		{Name: "data", Description: "Data to analyze", Required: true},
+	}, r.handleAnalysis))
+
+	return builtins
+}
+
+// lookupHandler 查找任务类型的处理器，依次查找Agent、全局和内置的注册表
+func (r *Runtime) lookupHandler(taskType string) (TaskHandler, bool) {
+	for _, registry := range []*HandlerRegistry{r.handlers, globalHandlers, r.builtins} {
+		if handler, ok := registry.Get(taskType); ok {
+			return handler, true
+		}
+	}
+	return nil, false
+}
+
+// RegisterHandler 注册仅对当前Agent生效的任务处理器，优先于全局和内置处理器
+func (r *Runtime) RegisterHandler(taskType string, handler TaskHandler) error {
+	return r.handlers.Register(taskType, handler)
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+func TestTaskHandlerRegistry(t *testing.T) {
+	ctx := context.Background()
+	runtime := newTestRuntime(t, newFakeProvider(), nil, nil)
+
+	handler := NewTaskHandler([]tool.ParameterSpec{
+		{Name: "order_id", Type: "string", Required: true},
+		{Name: "quantity", Type: "integer"},
+	}, func(ctx context.Context, task types.Task) (types.Result, error) {
+		return types.Result{Data: task.Parameters["order_id"]}, nil
+	})
+	if err := runtime.RegisterHandler("refund", handler); err != nil {
+		t.Fatalf("注册处理器失败: %v", err)
+	}
+	if err := runtime.RegisterHandler("refund", handler); !errors.Is(err, ErrHandlerExists) {
+		t.Errorf("重复注册期望得到 ErrHandlerExists，实际得到 %v", err)
+	}
+
+	result, err := runtime.executeTask(ctx, types.Task{ID: "task-1", Type: "refund", Parameters: map[string]interface{}{
+		"order_id": "o-1",
+		"quantity": float64(2),
+	}})
+	if err != nil || result.Data != "o-1" {
+		t.Fatalf("自定义任务执行失败: %v, %v", result.Data, err)
+	}
+
+	// 参数不符合规格时不执行处理器
+	_, err = runtime.executeTask(ctx, types.Task{ID: "task-2", Type: "refund", Parameters: map[string]interface{}{
+		"order_id": "o-1",
+		"quantity": "two",
+	}})
+	if !errors.Is(err, tool.ErrInvalidParameter) {
+		t.Errorf("期望参数校验错误，实际得到 %v", err)
+	}
+
+	_, err = runtime.executeTask(ctx, types.Task{ID: "task-3", Type: "unknown"})
+	if !errors.Is(err, ErrUnknownTaskType) {
+		t.Errorf("期望未知任务类型错误，实际得到 %v", err)
+	}
+}
+
+func TestTaskHandlerPrecedence(t *testing.T) {
+	ctx := context.Background()
+	runtime := newTestRuntime(t, newFakeProvider(), nil, nil)
+
+	constant := func(value string) TaskHandler {
+		return NewTaskHandler(nil, func(ctx context.Context, task types.Task) (types.Result, error) {
+			return types.Result{Data: value}, nil
+		})
+	}
+
+	// 全局处理器覆盖内置处理器，Agent处理器覆盖全局处理器
+	if err := RegisterTaskHandler("analysis", constant("global")); err != nil {
+		t.Fatalf("注册全局处理器失败: %v", err)
+	}
+	defer UnregisterTaskHandler("analysis")
+
+	task := types.Task{ID: "task-1", Type: "analysis"}
+	if result, _ := runtime.executeTask(ctx, task); result.Data != "global" {
+		t.Errorf("期望使用全局处理器，实际得到 %v", result.Data)
+	}
+
+	runtime.RegisterHandler("analysis", constant("agent"))
+	if result, _ := runtime.executeTask(ctx, task); result.Data != "agent" {
+		t.Errorf("期望使用Agent处理器，实际得到 %v", result.Data)
+	}
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventJournal 接口定义了只追加的事件日志，用于审计和事件重放
+type EventJournal interface {
+	// Append 追加事件，并为其分配严格递增的序号
+	Append(ctx context.Context, event *Event) error
+	// Replay 按序号顺序返回符合条件的事件
+	Replay(ctx context.Context, query EventQuery) ([]Event, error)
+}
+
+// EventQuery 是事件重放的查询条件，零值字段不参与过滤
+type EventQuery struct {
+	AgentID  string    // 只返回该Agent的事件
+	TaskID   string    // 只返回该任务的事件
+	Types    []string  // 只返回这些类型的事件
+	AfterSeq uint64    // 只返回序号大于AfterSeq的事件
+	Since    time.Time // 只返回该时间及之后的事件
+	Limit    int       // 最多返回的事件数
+}
+
+// matches 判断事件是否符合查询条件
+func (q EventQuery) matches(event Event) bool {
+	if event.Seq <= q.AfterSeq {
+		return false
+	}
+	if q.AgentID != "" && q.AgentID != event.AgentID {
+		return false
+	}
+	if q.TaskID != "" && q.TaskID != event.TaskID {
+		return false
+	}
+	if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+		return false
+	}
+	return len(q.Types) == 0 || containsString(q.Types, event.Type)
+}
+
+// full 判断是否已达到返回数量上限
+func (q EventQuery) full(events []Event) bool {
+	return q.Limit > 0 && len(events) >= q.Limit
+}
+
+// MemoryEventJournal 是基于内存的事件日志，进程退出后数据丢失
+type MemoryEventJournal struct {
+	mu     sync.RWMutex
+	events []Event
+}
+
+// NewMemoryEventJournal 创建一个新的内存事件日志
+func NewMemoryEventJournal() *MemoryEventJournal {
+	return &MemoryEventJournal{}
+}
+
+// Append 追加事件
+func (j *MemoryEventJournal) Append(ctx context.Context, event *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	event.Seq = uint64(len(j.events)) + 1
+	j.events = append(j.events, *event)
+	return nil
+}
+
+// Replay 返回符合条件的事件
+func (j *MemoryEventJournal) Replay(ctx context.Context, query EventQuery) ([]Event, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var events []Event
+	for _, event := range j.events[min(query.AfterSeq, uint64(len(j.events))):] {
+		if query.full(events) {
+			break
+		}
+		if query.matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/memory"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+func TestFileEventJournal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 分段很小，每次追加几乎都会滚动到新分段
+	journal, err := NewFileEventJournal(dir, 200, 0)
+	if err != nil {
+		t.Fatalf("打开事件日志失败: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		event := Event{
+			ID:        fmt.Sprintf("event-%d", i),
+			AgentID:   fmt.Sprintf("agent-%d", i%2),
+			TaskID:    fmt.Sprintf("task-%d", i%3),
+			Type:      "task_started",
+			Data:      map[string]interface{}{"index": i},
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := journal.Append(ctx, &event); err != nil {
+			t.Fatalf("追加事件失败: %v", err)
+		}
+		if event.Seq != uint64(i+1) {
+			t.Fatalf("期望序号为 %d，实际为 %d", i+1, event.Seq)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("关闭事件日志失败: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) < 2 {
+		t.Fatalf("期望事件日志已滚动为多个分段，实际只有 %d 个文件", len(entries))
+	}
+
+	// 重新打开后序号继续递增
+	journal, err = NewFileEventJournal(dir, 200, 0)
+	if err != nil {
+		t.Fatalf("重新打开事件日志失败: %v", err)
+	}
+	defer journal.Close()
+	event := Event{ID: "event-10", AgentID: "agent-0", Type: "task_finished", Timestamp: base.Add(10 * time.Minute)}
+	if err := journal.Append(ctx, &event); err != nil || event.Seq != 11 {
+		t.Fatalf("期望新事件序号为11，实际为 %d，错误 %v", event.Seq, err)
+	}
+
+	testCases := []struct {
+		name  string
+		query EventQuery
+		want  []uint64
+	}{
+		{name: "按Agent", query: EventQuery{AgentID: "agent-1"}, want: []uint64{2, 4, 6, 8, 10}},
+		{name: "按任务", query: EventQuery{TaskID: "task-0"}, want: []uint64{1, 4, 7, 10}},
+		{name: "按序号", query: EventQuery{AfterSeq: 8}, want: []uint64{9, 10, 11}},
+		{name: "按时间", query: EventQuery{AgentID: "agent-0", Since: base.Add(6 * time.Minute)}, want: []uint64{7, 9, 11}},
+		{name: "按类型", query: EventQuery{Types: []string{"task_finished"}}, want: []uint64{11}},
+		{name: "限制数量", query: EventQuery{AfterSeq: 2, Limit: 2}, want: []uint64{3, 4}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := journal.Replay(ctx, tc.query)
+			if err != nil {
+				t.Fatalf("重放事件失败: %v", err)
+			}
+			var got []uint64
+			for _, event := range events {
+				got = append(got, event.Seq)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("期望重放事件 %v，实际为 %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFileEventJournalRetention(t *testing.T) {
+	ctx := context.Background()
+	journal, err := NewFileEventJournal(t.TempDir(), 1, 3)
+	if err != nil {
+		t.Fatalf("打开事件日志失败: %v", err)
+	}
+	defer journal.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := journal.Append(ctx, &Event{Type: "tick"}); err != nil {
+			t.Fatalf("追加事件失败: %v", err)
+		}
+	}
+
+	// 每个事件一个分段，只保留最新的3个分段
+	events, err := journal.Replay(ctx, EventQuery{})
+	if err != nil {
+		t.Fatalf("重放事件失败: %v", err)
+	}
+	if len(events) != 3 || events[0].Seq != 8 {
+		t.Errorf("期望保留序号8到10的事件，实际为 %+v", events)
+	}
+}
+
+func TestFileEventJournalTornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	journal, err := NewFileEventJournal(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("打开事件日志失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := journal.Append(ctx, &Event{Type: "tick"}); err != nil {
+			t.Fatalf("追加事件失败: %v", err)
+		}
+	}
+	journal.Close()
+
+	// 模拟崩溃时只写入了一部分的最后一行
+	entries, _ := os.ReadDir(dir)
+	file, err := os.OpenFile(filepath.Join(dir, entries[0].Name()), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开分段失败: %v", err)
+	}
+	file.WriteString(`{"id":"torn","seq":3,"ty`)
+	file.Close()
+
+	journal, err = NewFileEventJournal(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("重新打开事件日志失败: %v", err)
+	}
+	defer journal.Close()
+	event := Event{Type: "tock"}
+	if err := journal.Append(ctx, &event); err != nil || event.Seq != 3 {
+		t.Fatalf("期望新事件序号为3，实际为 %d，错误 %v", event.Seq, err)
+	}
+
+	// 不完整的行被截掉，之后追加的事件可以正常读出
+	events, err := journal.Replay(ctx, EventQuery{})
+	if err != nil {
+		t.Fatalf("重放事件失败: %v", err)
+	}
+	if len(events) != 3 || events[2].Type != "tock" {
+		t.Errorf("期望重放3个事件，实际为 %+v", events)
+	}
+}
+
+func TestManagerReplayEvents(t *testing.T) {
+	ctx := context.Background()
+	service := llm.NewService()
+	if err := service.RegisterProvider(newFakeProvider("pong")); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+	mgr := NewManager(tool.NewManager(), memory.NewManager(), nil, service, nil, NewMemoryEventJournal())
+	agentID := createTestAgent(t, mgr)
+
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	if _, err := mgr.WaitTask(ctx, task.ID); err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+
+	// 晚到的订阅者通过重放获取任务的完整事件
+	events, err := mgr.ReplayEvents(ctx, EventQuery{TaskID: task.ID})
+	if err != nil {
+		t.Fatalf("重放事件失败: %v", err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Type)
+	}
+	want := []string{"task_assigned", "task_started", "task_finished", "task_completed"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("期望任务事件 %v，实际为 %v", want, got)
+	}
+
+	if _, err := newTestManager(t, newFakeProvider()).ReplayEvents(ctx, EventQuery{}); err != ErrJournalDisabled {
+		t.Errorf("期望未配置事件日志错误，实际得到 %v", err)
+	}
+}
+
+// failingJournal 拒绝写入所有事件
+type failingJournal struct {
+	*MemoryEventJournal
+}
+
+func (j failingJournal) Append(ctx context.Context, event *Event) error {
+	return errors.New("disk full")
+}
+
+func TestJournalWriteFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	service := llm.NewService()
+	service.RegisterProvider(newFakeProvider("pong"))
+	mgr := NewManager(tool.NewManager(), memory.NewManager(), nil, service, nil, failingJournal{NewMemoryEventJournal()})
+	agentID := createTestAgent(t, mgr)
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: agentID, Types: []string{"task_assigned", "journal_write_failed"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	if err := mgr.AssignTask(ctx, agentID, types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+
+	// 事件照常送达订阅者，随后报告写入事件日志失败
+	var got []string
+	for len(got) < 2 {
+		select {
+		case event := <-sub.Events():
+			got = append(got, event.Type)
+			if event.Type == "journal_write_failed" {
+				data := event.Data.(map[string]interface{})
+				if event.TaskID != "task-1" || data["event_type"] != "task_assigned" || !strings.Contains(data["error"].(string), "disk full") {
+					t.Errorf("事件日志写入失败事件不正确: %+v", event)
+				}
+			}
+		case <-ctx.Done():
+			t.Fatalf("等待事件超时，已收到 %v", got)
+		}
+	}
+	if fmt.Sprint(got) != "[task_assigned journal_write_failed]" {
+		t.Errorf("事件顺序不正确: %v", got)
+	}
+}
@@ -0,0 +1,671 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// agentSpec 是定义文件中的一个Agent或模板。字段的schema标签用于校验：
+// required表示必填，min/max限制数值范围，enum限制可选值
+type agentSpec struct {
+	Extends      string        `json:"extends"` // 继承的模板名
+	ID           string        `json:"id"`
+	Name         string        `json:"name" schema:"required"`
+	Description  string        `json:"description"`
+	Role         string        `json:"role"`
+	Capabilities []string      `json:"capabilities"`
+	Model        modelSpec     `json:"model" schema:"required"`
+	Tools        []toolSpec    `json:"tools"`
+	Memory       memorySpec    `json:"memory"`
+	Knowledge    knowledgeSpec `json:"knowledge"`
+	MaxSteps     int           `json:"max_steps" schema:"min=0"`
+	Queue        queueSpec     `json:"queue"`
+	Pause        pauseSpec     `json:"pause"`
+	Retry        retrySpec     `json:"retry"`
+	Recovery     string        `json:"recovery" schema:"enum=requeue|fail"`
+	Budget       budgetSpec    `json:"budget"`
+	Approval     approvalSpec  `json:"approval"`
+}
+
+type modelSpec struct {
+	Provider     string  `json:"provider"`
+	Type         string  `json:"type" schema:"required"`
+	Temperature  float64 `json:"temperature" schema:"min=0"`
+	MaxTokens    int     `json:"max_tokens" schema:"min=0"`
+	SystemPrompt string  `json:"system_prompt"`
+	NativeTools  bool    `json:"native_tools"`
+}
+
+type toolSpec struct {
+	ID              string                 `json:"id" schema:"required"`
+	Config          map[string]interface{} `json:"config"`
+	RequireApproval bool                   `json:"require_approval"`
+}
+
+type memorySpec struct {
+	Type string `json:"type"`
+	Size int    `json:"size" schema:"min=0"`
+}
+
+type knowledgeSpec struct {
+	Type    string   `json:"type"`
+	Sources []string `json:"sources"`
+}
+
+type queueSpec struct {
+	Capacity      int    `json:"capacity" schema:"min=0"`
+	BlockWhenFull bool   `json:"block_when_full"`
+	Concurrency   int    `json:"concurrency" schema:"min=0"`
+	Ordering      string `json:"ordering"`
+}
+
+type pauseSpec struct {
+	RejectTasks bool `json:"reject_tasks"`
+	Checkpoint  bool `json:"checkpoint"`
+}
+
+type retrySpec struct {
+	MaxAttempts    int          `json:"max_attempts" schema:"min=0"`
+	InitialBackoff specDuration `json:"initial_backoff"`
+	MaxBackoff     specDuration `json:"max_backoff"`
+	Multiplier     float64      `json:"multiplier" schema:"min=0"`
+	Jitter         float64      `json:"jitter" schema:"min=0,max=1"`
+}
+
+type budgetSpec struct {
+	Total      budgetLimitSpec `json:"total"`
+	Task       budgetLimitSpec `json:"task"`
+	OnExceeded string          `json:"on_exceeded" schema:"enum=fail|pause"`
+}
+
+type budgetLimitSpec struct {
+	MaxTokens int     `json:"max_tokens" schema:"min=0"`
+	MaxCost   float64 `json:"max_cost" schema:"min=0"`
+}
+
+type approvalSpec struct {
+	Timeout   specDuration `json:"timeout"`
+	OnTimeout string       `json:"on_timeout" schema:"enum=approve|reject"`
+}
+
+// specDuration 是以"500ms"、"2s"等形式书写的时长
+type specDuration time.Duration
+
+func (d *specDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = specDuration(parsed)
+	return nil
+}
+
+var durationType = reflect.TypeOf(specDuration(0))
+
+// FieldError 是定义文件中某个字段的错误
+type FieldError struct {
+	Path    string // 字段路径，如 agents[0].model.temperature
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ConfigError 汇总了定义文件中的所有错误，可用errors.Is判断为ErrInvalidConfig
+type ConfigError struct {
+	Source string
+	Errors []FieldError
+}
+
+func (e *ConfigError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s: %d error(s) in %s", ErrInvalidConfig, len(e.Errors), e.Source))
+	for _, fe := range e.Errors {
+		sb.WriteString("\n  ")
+		sb.WriteString(fe.Error())
+	}
+	return sb.String()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// LoadAgentFile 读取、校验YAML或JSON格式的Agent定义文件，并按定义在管理器中创建Agent。
+// 任一Agent创建失败时销毁已创建的Agent
+func LoadAgentFile(ctx context.Context, manager Manager, path string) ([]types.Agent, error) {
+	configs, err := ReadAgentFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]types.Agent, 0, len(configs))
+	for _, config := range configs {
+		agent, err := manager.CreateAgent(ctx, config)
+		if err != nil {
+			for _, created := range agents {
+				manager.DestroyAgent(ctx, created.Status().ID)
+			}
+			return nil, fmt.Errorf("failed to create agent %s: %w", config.Name, err)
+		}
+		agents = append(agents, agent)
+	}
+	return agents, nil
+}
+
+// ReadAgentFile 读取并校验Agent定义文件，返回其中定义的Agent配置。
+// 文件格式由扩展名决定（.yaml、.yml或.json）
+func ReadAgentFile(path string) ([]AgentConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent file: %w", err)
+	}
+
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	case ".json":
+		format = "json"
+	default:
+		return nil, fmt.Errorf("%w: unsupported agent file extension %q", ErrInvalidConfig, filepath.Ext(path))
+	}
+
+	return ParseAgentDefinitions(path, data, format)
+}
+
+// ParseAgentDefinitions 解析Agent定义。解析后在字符串值中展开${VAR}和${VAR:-默认值}形式的环境变量
+// （$$表示字面的$），再按模板继承合并每个Agent的定义，最后校验并转换为Agent配置。
+// 环境变量的值不会改变文件结构，也不会被解析为数字等其他类型。
+// 所有错误一次性以ConfigError返回
+func ParseAgentDefinitions(source string, data []byte, format string) ([]AgentConfig, error) {
+	cfgErr := &ConfigError{Source: source}
+
+	var doc interface{}
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(data, &doc)
+	case "json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("%w: unsupported agent file format %q", ErrInvalidConfig, format)
+	}
+	if err != nil {
+		cfgErr.Errors = append(cfgErr.Errors, FieldError{Message: fmt.Sprintf("invalid %s: %v", format, err)})
+		return nil, cfgErr
+	}
+
+	doc = expandEnvValues("", doc, cfgErr)
+
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		cfgErr.Errors = append(cfgErr.Errors, FieldError{Message: "document must be a mapping with templates and agents"})
+		return nil, cfgErr
+	}
+
+	templates := map[string]map[string]interface{}{}
+	var templateNames []string
+	var agents []interface{}
+	for _, key := range sortedKeys(root) {
+		switch key {
+		case "templates":
+			specs, ok := root[key].(map[string]interface{})
+			if !ok {
+				cfgErr.add(key, "must be a mapping of template names to agent definitions")
+				continue
+			}
+			for _, name := range sortedKeys(specs) {
+				spec, ok := specs[name].(map[string]interface{})
+				if !ok {
+					cfgErr.add("templates."+name, "must be a mapping")
+					continue
+				}
+				templates[name] = spec
+				templateNames = append(templateNames, name)
+			}
+		case "agents":
+			if agents, ok = root[key].([]interface{}); !ok {
+				cfgErr.add(key, "must be a list")
+			}
+		default:
+			cfgErr.add(key, "unknown field")
+		}
+	}
+
+	// 模板只检查字段和类型，必填字段可由继承它的Agent补全
+	invalidTemplates := map[string]bool{}
+	for _, name := range templateNames {
+		before := len(cfgErr.Errors)
+		validateSpec("templates."+name, templates[name], reflect.TypeOf(agentSpec{}), false, cfgErr)
+		invalidTemplates[name] = len(cfgErr.Errors) > before
+	}
+
+	var configs []AgentConfig
+	for i, item := range agents {
+		path := fmt.Sprintf("agents[%d]", i)
+		spec, ok := item.(map[string]interface{})
+		if !ok {
+			cfgErr.add(path, "must be a mapping")
+			continue
+		}
+
+		merged, chain, err := resolveTemplate(spec, templates, nil)
+		if err != nil {
+			cfgErr.add(path+".extends", err.Error())
+			continue
+		}
+		if anyTrue(invalidTemplates, chain) {
+			// 模板的错误已经报告过，不再在每个继承它的Agent上重复报告
+			continue
+		}
+
+		before := len(cfgErr.Errors)
+		validateSpec(path, merged, reflect.TypeOf(agentSpec{}), true, cfgErr)
+		if len(cfgErr.Errors) > before {
+			continue
+		}
+
+		config, err := decodeAgentSpec(merged)
+		if err != nil {
+			cfgErr.add(path, err.Error())
+			continue
+		}
+		configs = append(configs, config)
+	}
+
+	if len(cfgErr.Errors) > 0 {
+		return nil, cfgErr
+	}
+	return configs, nil
+}
+
+// add 记录一个字段错误
+func (e *ConfigError) add(path, message string) {
+	e.Errors = append(e.Errors, FieldError{Path: path, Message: message})
+}
+
+// expandEnvValues 展开文档中所有字符串值里的环境变量，映射的键保持原样
+func expandEnvValues(path string, value interface{}, cfgErr *ConfigError) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expandEnv(path, v, cfgErr)
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			v[key] = expandEnvValues(keyPath, v[key], cfgErr)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandEnvValues(fmt.Sprintf("%s[%d]", path, i), item, cfgErr)
+		}
+	}
+	return value
+}
+
+// expandEnv 展开字符串值中的环境变量，未设置且没有默认值的变量记为path处的错误
+func expandEnv(path, text string, cfgErr *ConfigError) string {
+	if !strings.Contains(text, "$") {
+		return text
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '$' || i+1 >= len(text) {
+			sb.WriteByte(c)
+			continue
+		}
+
+		switch text[i+1] {
+		case '$':
+			sb.WriteByte('$')
+			i++
+			continue
+		case '{':
+		default:
+			sb.WriteByte(c)
+			continue
+		}
+
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			sb.WriteByte(c)
+			continue
+		}
+
+		expr := text[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok && value != "":
+		case hasDefault:
+			value = def
+		case !ok:
+			cfgErr.add(path, fmt.Sprintf("environment variable %s is not set", name))
+		}
+		sb.WriteString(value)
+		i += end
+	}
+
+	return sb.String()
+}
+
+// resolveTemplate 沿extends链合并模板，后者覆盖前者：映射逐字段合并，列表和标量整体替换。
+// 返回合并后的定义和继承链上的模板名
+func resolveTemplate(spec map[string]interface{}, templates map[string]map[string]interface{}, chain []string) (map[string]interface{}, []string, error) {
+	name, _ := spec["extends"].(string)
+	if name == "" {
+		return spec, chain, nil
+	}
+	if containsString(chain, name) {
+		return nil, nil, fmt.Errorf("template inheritance cycle: %s -> %s", strings.Join(chain, " -> "), name)
+	}
+
+	base, ok := templates[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown template %q", name)
+	}
+	resolved, chain, err := resolveTemplate(base, templates, append(chain, name))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := mergeSpec(resolved, spec)
+	delete(merged, "extends")
+	return merged, chain, nil
+}
+
+// anyTrue 判断names中是否有值为true的键
+func anyTrue(set map[string]bool, names []string) bool {
+	for _, name := range names {
+		if set[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSpec 深度合并两个定义，返回新的映射
+func mergeSpec(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		baseMap, ok1 := merged[k].(map[string]interface{})
+		overrideMap, ok2 := v.(map[string]interface{})
+		if ok1 && ok2 {
+			merged[k] = mergeSpec(baseMap, overrideMap)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// validateSpec 按类型t递归校验value，required为false时不检查必填字段
+func validateSpec(path string, value interface{}, t reflect.Type, required bool, cfgErr *ConfigError) {
+	if t == durationType {
+		s, ok := value.(string)
+		if !ok {
+			cfgErr.add(path, fmt.Sprintf("expected duration string such as \"2s\", got %s", describeValue(value)))
+			return
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			cfgErr.add(path, fmt.Sprintf("invalid duration %q", s))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			cfgErr.add(path, fmt.Sprintf("expected mapping, got %s", describeValue(value)))
+			return
+		}
+
+		known := make(map[string]bool, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			known[name] = true
+			rules := parseSchemaTag(field.Tag.Get("schema"))
+			fieldPath := path + "." + name
+
+			fieldValue, present := fields[name]
+			if !present || fieldValue == nil {
+				if required && rules["required"] != "" {
+					cfgErr.add(fieldPath, "required field missing")
+				}
+				continue
+			}
+
+			before := len(cfgErr.Errors)
+			validateSpec(fieldPath, fieldValue, field.Type, required, cfgErr)
+			if len(cfgErr.Errors) == before {
+				checkSchemaRules(fieldPath, fieldValue, rules, required, cfgErr)
+			}
+		}
+
+		for _, key := range sortedKeys(fields) {
+			if !known[key] {
+				cfgErr.add(path+"."+key, "unknown field")
+			}
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			cfgErr.add(path, fmt.Sprintf("expected list, got %s", describeValue(value)))
+			return
+		}
+		for i, item := range items {
+			validateSpec(fmt.Sprintf("%s[%d]", path, i), item, t.Elem(), required, cfgErr)
+		}
+
+	case reflect.Map:
+		if _, ok := value.(map[string]interface{}); !ok {
+			cfgErr.add(path, fmt.Sprintf("expected mapping, got %s", describeValue(value)))
+		}
+
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			cfgErr.add(path, fmt.Sprintf("expected string, got %s", describeValue(value)))
+		}
+
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			cfgErr.add(path, fmt.Sprintf("expected boolean, got %s", describeValue(value)))
+		}
+
+	case reflect.Int:
+		if _, ok := specNumber(value); !ok || !isWholeNumber(value) {
+			cfgErr.add(path, fmt.Sprintf("expected integer, got %s", describeValue(value)))
+		}
+
+	case reflect.Float64:
+		if _, ok := specNumber(value); !ok {
+			cfgErr.add(path, fmt.Sprintf("expected number, got %s", describeValue(value)))
+		}
+	}
+}
+
+// checkSchemaRules 检查字段的取值范围和可选值
+func checkSchemaRules(path string, value interface{}, rules map[string]string, required bool, cfgErr *ConfigError) {
+	if s, ok := value.(string); ok {
+		if required && rules["required"] != "" && s == "" {
+			cfgErr.add(path, "required field is empty")
+		}
+		if enum := rules["enum"]; enum != "" && s != "" && !containsString(strings.Split(enum, "|"), s) {
+			cfgErr.add(path, fmt.Sprintf("must be one of %s, got %q", strings.ReplaceAll(enum, "|", ", "), s))
+		}
+	}
+
+	n, ok := specNumber(value)
+	if !ok {
+		return
+	}
+	if min, err := strconv.ParseFloat(rules["min"], 64); err == nil && n < min {
+		cfgErr.add(path, fmt.Sprintf("must be >= %v, got %v", min, n))
+	}
+	if max, err := strconv.ParseFloat(rules["max"], 64); err == nil && n > max {
+		cfgErr.add(path, fmt.Sprintf("must be <= %v, got %v", max, n))
+	}
+}
+
+// parseSchemaTag 解析schema标签，如 "required,min=0,enum=a|b"
+func parseSchemaTag(tag string) map[string]string {
+	rules := map[string]string{}
+	for _, part := range strings.Split(tag, ",") {
+		if part == "" {
+			continue
+		}
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			value = "true"
+		}
+		rules[key] = value
+	}
+	return rules
+}
+
+// specNumber 将YAML或JSON解析出的数值转换为float64
+func specNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// isWholeNumber 判断数值是否为整数
+func isWholeNumber(value interface{}) bool {
+	n, _ := specNumber(value)
+	return n == math.Trunc(n)
+}
+
+// describeValue 描述值的类型，用于错误信息
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "mapping"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64, float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// sortedKeys 返回排序后的键，保证错误按稳定顺序报告
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// decodeAgentSpec 将校验通过的定义转换为Agent配置
+func decodeAgentSpec(merged map[string]interface{}) (AgentConfig, error) {
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	var spec agentSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return AgentConfig{}, err
+	}
+
+	config := AgentConfig{
+		ID:           spec.ID,
+		Name:         spec.Name,
+		Description:  spec.Description,
+		Role:         spec.Role,
+		Capabilities: spec.Capabilities,
+		Model: ModelConfig{
+			Provider:     spec.Model.Provider,
+			Type:         spec.Model.Type,
+			Temperature:  spec.Model.Temperature,
+			MaxTokens:    spec.Model.MaxTokens,
+			SystemPrompt: spec.Model.SystemPrompt,
+			NativeTools:  spec.Model.NativeTools,
+		},
+		Memory: types.MemoryConfig{
+			Type: spec.Memory.Type,
+			Size: spec.Memory.Size,
+		},
+		Knowledge: KnowledgeConfig{
+			Type:    spec.Knowledge.Type,
+			Sources: spec.Knowledge.Sources,
+		},
+		MaxSteps: spec.MaxSteps,
+		Pause: PauseConfig{
+			RejectTasks: spec.Pause.RejectTasks,
+			Checkpoint:  spec.Pause.Checkpoint,
+		},
+		Queue: QueueConfig{
+			Capacity:      spec.Queue.Capacity,
+			BlockWhenFull: spec.Queue.BlockWhenFull,
+			Concurrency:   spec.Queue.Concurrency,
+			Ordering:      spec.Queue.Ordering,
+		},
+		Retry: types.RetryPolicy{
+			MaxAttempts:    spec.Retry.MaxAttempts,
+			InitialBackoff: time.Duration(spec.Retry.InitialBackoff),
+			MaxBackoff:     time.Duration(spec.Retry.MaxBackoff),
+			Multiplier:     spec.Retry.Multiplier,
+			Jitter:         spec.Retry.Jitter,
+		},
+		Recovery: RecoveryPolicy(spec.Recovery),
+		Budget: BudgetConfig{
+			Total:      types.Budget{MaxTokens: spec.Budget.Total.MaxTokens, MaxCost: spec.Budget.Total.MaxCost},
+			Task:       types.Budget{MaxTokens: spec.Budget.Task.MaxTokens, MaxCost: spec.Budget.Task.MaxCost},
+			OnExceeded: BudgetAction(spec.Budget.OnExceeded),
+		},
+		Approval: ApprovalConfig{
+			Timeout:   time.Duration(spec.Approval.Timeout),
+			OnTimeout: ApprovalAction(spec.Approval.OnTimeout),
+		},
+	}
+	for _, t := range spec.Tools {
+		config.Tools = append(config.Tools, ToolConfig{ID: t.ID, Config: t.Config, RequireApproval: t.RequireApproval})
+	}
+	return config, nil
+}
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAgentYAML = `
+templates:
+  base:
+    model:
+      provider: fake
+      type: ${TEST_AGENT_MODEL}
+      temperature: 0.2
+      system_prompt: You are a careful assistant.
+    retry:
+      max_attempts: 3
+      initial_backoff: 500ms
+  researcher:
+    extends: base
+    role: researcher
+    capabilities: [search]
+    queue:
+      concurrency: 2
+
+agents:
+  - id: alice
+    name: Alice
+    extends: researcher
+    model:
+      temperature: 0.7
+    tools:
+      - id: text_stats
+        require_approval: true
+        config:
+          api_key: ${TEST_AGENT_KEY:-none}
+  - name: Bob
+    model:
+      type: other-model
+    recovery: fail
+    budget:
+      task: {max_tokens: 1000}
+      on_exceeded: pause
+`
+
+func TestParseAgentDefinitions(t *testing.T) {
+	t.Setenv("TEST_AGENT_MODEL", "fake-model")
+
+	configs, err := ParseAgentDefinitions("agents.yaml", []byte(testAgentYAML), "yaml")
+	if err != nil {
+		t.Fatalf("解析Agent定义失败: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("期望2个Agent，实际为 %d 个", len(configs))
+	}
+
+	// 多级模板继承，映射逐字段合并
+	alice := configs[0]
+	if alice.Model.Type != "fake-model" || alice.Model.Temperature != 0.7 || alice.Model.SystemPrompt != "You are a careful assistant." {
+		t.Errorf("模型配置合并不正确: %+v", alice.Model)
+	}
+	if alice.Role != "researcher" || alice.Queue.Concurrency != 2 || alice.Retry.InitialBackoff != 500*time.Millisecond {
+		t.Errorf("模板配置未被继承: %+v", alice)
+	}
+	if len(alice.Tools) != 1 || alice.Tools[0].Config["api_key"] != "none" || !alice.Tools[0].RequireApproval {
+		t.Errorf("工具配置不正确: %+v", alice.Tools)
+	}
+
+	bob := configs[1]
+	if bob.Model.Type != "other-model" || bob.Recovery != RecoverFail || bob.Role != "" || bob.Budget.Task.MaxTokens != 1000 || bob.Budget.OnExceeded != BudgetPause {
+		t.Errorf("未继承模板的Agent配置不正确: %+v", bob)
+	}
+}
+
+func TestParseAgentDefinitionsEnvValues(t *testing.T) {
+	// 环境变量的值只作为字符串展开，不能注入新的字段
+	t.Setenv("TEST_AGENT_MODEL", "fake-model\n    max_tokens: 99999")
+	t.Setenv("TEST_AGENT_KEY", "${NOT_EXPANDED_AGAIN}")
+
+	configs, err := ParseAgentDefinitions("agents.yaml", []byte(testAgentYAML), "yaml")
+	if err != nil {
+		t.Fatalf("解析Agent定义失败: %v", err)
+	}
+	alice := configs[0]
+	if alice.Model.Type != "fake-model\n    max_tokens: 99999" || alice.Model.MaxTokens != 0 {
+		t.Errorf("环境变量的值改变了文件结构: %+v", alice.Model)
+	}
+	if alice.Tools[0].Config["api_key"] != "${NOT_EXPANDED_AGAIN}" {
+		t.Errorf("环境变量的值不应再次展开: %v", alice.Tools[0].Config["api_key"])
+	}
+}
+
+func TestParseAgentDefinitionsErrors(t *testing.T) {
+	data := `{
+		"templates": {"base": {"model": {"temperature": "hot"}}},
+		"agents": [
+			{"name": "A", "extends": "base"},
+			{"name": "B", "model": {"type": "m", "max_tokens": 1.5}, "tools": [{"config": {}}], "recovery": "retry"},
+			{"model": {"type": "${TEST_AGENT_UNSET}"}, "queue": {"capacity": -1}, "retry": {"initial_backoff": "soon", "jitter": 2}},
+			{"name": "D", "extends": "missing", "model": {"type": "m"}},
+			{"name": "E", "modle": {"type": "m"}}
+		],
+		"version": 1
+	}`
+
+	_, err := ParseAgentDefinitions("agents.json", []byte(data), "json")
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) || !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("期望ConfigError，实际得到 %v", err)
+	}
+
+	// 所有错误一次性报告，并带有字段路径
+	want := []string{
+		"agents[2].model.type: environment variable TEST_AGENT_UNSET is not set",
+		"version: unknown field",
+		"templates.base.model.temperature: expected number, got string",
+		"agents[1].model.max_tokens: expected integer, got number",
+		"agents[1].tools[0].id: required field missing",
+		"agents[1].recovery: must be one of requeue, fail, got \"retry\"",
+		"agents[2].name: required field missing",
+		"agents[2].model.type: required field is empty",
+		"agents[2].queue.capacity: must be >= 0, got -1",
+		"agents[2].retry.initial_backoff: invalid duration \"soon\"",
+		"agents[2].retry.jitter: must be <= 1, got 2",
+		"agents[3].extends: unknown template \"missing\"",
+		"agents[4].model: required field missing",
+		"agents[4].modle: unknown field",
+	}
+	var got []string
+	for _, fe := range cfgErr.Errors {
+		got = append(got, fe.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("错误列表不正确:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestLoadAgentFile(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+
+	path := filepath.Join(t.TempDir(), "agents.yml")
+	data := "agents:\n  - id: loaded\n    name: Loaded\n    model: {type: fake-model}\n  - id: broken\n    name: Broken\n    model: {type: fake-model}\n    queue: {ordering: random}\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("写入定义文件失败: %v", err)
+	}
+
+	// 任一Agent创建失败时回滚已创建的Agent
+	if _, err := LoadAgentFile(ctx, mgr, path); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("期望创建失败，实际得到 %v", err)
+	}
+	if _, err := mgr.GetAgentStatus(ctx, "loaded"); !errors.Is(err, ErrAgentNotFound) {
+		t.Errorf("期望已创建的Agent被销毁，实际得到 %v", err)
+	}
+
+	data = strings.ReplaceAll(data, "random", "fifo")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("写入定义文件失败: %v", err)
+	}
+	agents, err := LoadAgentFile(ctx, mgr, path)
+	if err != nil {
+		t.Fatalf("加载定义文件失败: %v", err)
+	}
+	if len(agents) != 2 || agents[1].Status().ID != "broken" {
+		t.Errorf("加载的Agent不正确: %d", len(agents))
+	}
+}
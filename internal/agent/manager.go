@@ -2,34 +2,62 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/llm"
 	"github.com/hewenyu/Aegis/internal/tool"
 	"github.com/hewenyu/Aegis/internal/types"
 )
 
 // manager 实现了Manager接口
 type manager struct {
-	agents    sync.Map
-	tasks     sync.Map
-	events    map[string]chan Event
-	eventsMu  sync.RWMutex
-	toolMgr   tool.Manager
-	memoryMgr types.Manager
-	knowledge types.Base
-}
-
-// NewManager 创建一个新的Agent管理器
-func NewManager(toolMgr tool.Manager, memoryMgr types.Manager, kb types.Base) Manager {
-	return &manager{
+	agents     sync.Map
+	tasks      sync.Map
+	tasksMu    sync.Mutex // 保护任务状态的读-改-写
+	taskAgents sync.Map   // 任务ID -> AgentID
+	taskDefs   sync.Map   // 任务ID -> types.Task
+	cancels    sync.Map   // 任务ID -> context.CancelFunc
+	done       sync.Map   // 任务ID -> *taskDone
+	streams    sync.Map   // 任务ID -> *taskStream，任务结束时移除
+	workflows  sync.Map   // 工作流ID -> *workflowRun
+	events     *EventBus
+	journal    EventJournal
+	messages   *messageBus
+	approvals  *approvalRegistry
+	toolMgr    tool.Manager
+	memoryMgr  types.Manager
+	knowledge  types.Base
+	llm        llm.Service
+	store      TaskStore
+	persister  *taskPersister
+}
+
+// NewManager 创建一个新的Agent管理器。store为空时使用内存任务存储；
+// 使用持久化存储时，创建Agent会恢复该Agent在上次运行中未完成的任务。
+// journal不为空时所有事件都会写入事件日志，可通过ReplayEvents重放
+func NewManager(toolMgr tool.Manager, memoryMgr types.Manager, kb types.Base, llmService llm.Service, store TaskStore, journal EventJournal) Manager {
+	if store == nil {
+		store = NewMemoryTaskStore()
+	}
+
+	m := &manager{
 		toolMgr:   toolMgr,
 		memoryMgr: memoryMgr,
 		knowledge: kb,
-		events:    make(map[string]chan Event),
+		llm:       llmService,
+		store:     store,
+		events:    NewEventBus(journal),
+		journal:   journal,
+		messages:  newMessageBus(),
+		approvals: newApprovalRegistry(),
 	}
+	m.persister = newTaskPersister(store, m.reportPersistError)
+	return m
 }
 
 // CreateAgent 创建一个新的Agent
@@ -72,7 +100,12 @@ func (m *manager) CreateAgent(ctx context.Context, config AgentConfig) (types.Ag
 	}
 
 	// 创建运行时
-	runtime := NewRuntime(agent, tools, memoryStore, knowledgeCtx)
+	runtime := NewRuntime(agent, tools, memoryStore, knowledgeCtx, m.llm)
+	runtime.events = m.events
+	runtime.onUsage = m.recordTaskUsage
+	runtime.approvals = m.approvals
+	runtime.onApproval = m.markAwaitingApproval
+	runtime.onChunk = m.recordTaskChunk
 	agent.runtime = runtime
 
 	// 初始化Agent
@@ -85,13 +118,9 @@ func (m *manager) CreateAgent(ctx context.Context, config AgentConfig) (types.Ag
 		return nil, fmt.Errorf("failed to start runtime: %w", err)
 	}
 
+	m.messages.register(config.ID)
 	m.agents.Store(config.ID, agent)
 
-	// 创建事件通道
-	m.eventsMu.Lock()
-	m.events[config.ID] = make(chan Event, 100) // 缓冲区大小可配置
-	m.eventsMu.Unlock()
-
 	// 发送Agent创建事件
 	m.emitEvent(config.ID, Event{
 		ID:        uuid.New().String(),
@@ -100,6 +129,9 @@ func (m *manager) CreateAgent(ctx context.Context, config AgentConfig) (types.Ag
 		Timestamp: time.Now(),
 	})
 
+	// 恢复该Agent未完成的任务
+	m.recoverTasks(ctx, config)
+
 	return agent, nil
 }
 
@@ -110,13 +142,18 @@ func (m *manager) createMemoryStore(ctx context.Context, config types.MemoryConf
 
 // createKnowledgeContext 创建知识上下文
 func (m *manager) createKnowledgeContext(ctx context.Context, config KnowledgeConfig) (types.Context, error) {
+	// 未配置知识库时Agent不使用知识上下文
+	if m.knowledge == nil {
+		return nil, nil
+	}
+
 	return m.knowledge.CreateContext(ctx, types.KnowledgeConfig{
 		Type:    config.Type,
 		Sources: config.Sources,
 	})
 }
 
-// getTools 获取工具列表
+// getTools 获取工具列表，带有配置的工具会为该Agent单独创建实例
 func (m *manager) getTools(ctx context.Context, toolConfigs []ToolConfig) ([]tool.Tool, error) {
 	var tools []tool.Tool
 
@@ -125,6 +162,10 @@ func (m *manager) getTools(ctx context.Context, toolConfigs []ToolConfig) ([]too
 		if err != nil {
 			return nil, fmt.Errorf("failed to get tool %s: %w", config.ID, err)
 		}
+		t, err = tool.Configure(t, config.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
 		tools = append(tools, t)
 	}
 
@@ -138,25 +179,43 @@ func (m *manager) DestroyAgent(ctx context.Context, agentID string) error {
 		return ErrAgentNotFound
 	}
 
-	agent := agentI.(types.Agent)
-	if err := agent.Stop(ctx); err != nil {
+	// 等待Agent排空任务，ctx结束时仍未完成的任务被放弃
+	agent := agentI.(*baseAgent)
+	abandoned, err := agent.shutdown(ctx)
+	if err != nil && ctx.Err() == nil {
 		return err
 	}
 
+	for _, task := range abandoned {
+		m.updateTask(task.ID, func(status *types.TaskStatus) bool {
+			if status.Status == "completed" || status.Status == "cancelled" {
+				return false
+			}
+			status.Status = "abandoned"
+			status.Error = ErrTaskAbandoned
+			status.EndTime = time.Now()
+			return true
+		})
+
+		m.emitEvent(agentID, Event{
+			ID:        uuid.New().String(),
+			Type:      "task_abandoned",
+			Data:      map[string]interface{}{"task_id": task.ID},
+			Timestamp: time.Now(),
+		})
+	}
+
 	m.agents.Delete(agentID)
+	m.messages.unregister(agentID)
 
-	// 关闭事件通道
-	m.eventsMu.Lock()
-	if ch, ok := m.events[agentID]; ok {
-		close(ch)
-		delete(m.events, agentID)
-	}
-	m.eventsMu.Unlock()
+	// 关闭只订阅了该Agent的事件订阅
+	m.events.closeAgent(agentID)
 
 	return nil
 }
 
-// PauseAgent 暂停一个Agent
+// PauseAgent 暂停一个Agent，暂停后运行时不再从队列中取出任务。
+// 按配置中断正在执行的任务，被中断的任务在恢复后优先重新执行
 func (m *manager) PauseAgent(ctx context.Context, agentID string) error {
 	agentI, ok := m.agents.Load(agentID)
 	if !ok {
@@ -164,7 +223,16 @@ func (m *manager) PauseAgent(ctx context.Context, agentID string) error {
 	}
 
 	agent := agentI.(*baseAgent)
-	agent.status.Status = "paused"
+	checkpointed := agent.pause()
+
+	for _, taskID := range checkpointed {
+		m.emitEvent(agentID, Event{
+			ID:        uuid.New().String(),
+			Type:      "task_checkpointed",
+			Data:      map[string]interface{}{"task_id": taskID},
+			Timestamp: time.Now(),
+		})
+	}
 
 	// 发送暂停事件
 	m.emitEvent(agentID, Event{
@@ -177,7 +245,7 @@ func (m *manager) PauseAgent(ctx context.Context, agentID string) error {
 	return nil
 }
 
-// ResumeAgent 恢复一个Agent
+// ResumeAgent 恢复一个Agent，按原顺序继续执行队列中的任务
 func (m *manager) ResumeAgent(ctx context.Context, agentID string) error {
 	agentI, ok := m.agents.Load(agentID)
 	if !ok {
@@ -185,7 +253,7 @@ func (m *manager) ResumeAgent(ctx context.Context, agentID string) error {
 	}
 
 	agent := agentI.(*baseAgent)
-	agent.status.Status = "running"
+	agent.resume()
 
 	// 发送恢复事件
 	m.emitEvent(agentID, Event{
@@ -198,82 +266,197 @@ func (m *manager) ResumeAgent(ctx context.Context, agentID string) error {
 	return nil
 }
 
-// AssignTask 分配任务给Agent
+// RegisterTaskHandler 注册仅对指定Agent生效的任务处理器
+func (m *manager) RegisterTaskHandler(ctx context.Context, agentID string, taskType string, handler TaskHandler) error {
+	agentI, ok := m.agents.Load(agentID)
+	if !ok {
+		return ErrAgentNotFound
+	}
+
+	return agentI.(*baseAgent).runtime.RegisterHandler(taskType, handler)
+}
+
+// RegisterMiddleware 注册仅对指定Agent生效的中间件
+func (m *manager) RegisterMiddleware(ctx context.Context, agentID string, mw Middleware) error {
+	agentI, ok := m.agents.Load(agentID)
+	if !ok {
+		return ErrAgentNotFound
+	}
+
+	return agentI.(*baseAgent).runtime.Use(mw)
+}
+
+// AssignTask 分配任务给Agent。Agent暂停时，按PauseConfig.RejectTasks
+// 返回ErrAgentPaused，或将任务排队等待恢复后执行。任务在返回前入队，
+// 队列已满时按QueueConfig返回ErrQueueFull，或阻塞直到有空位、ctx结束
 func (m *manager) AssignTask(ctx context.Context, agentID string, task types.Task) error {
 	agentI, ok := m.agents.Load(agentID)
 	if !ok {
 		return ErrAgentNotFound
 	}
 
+	if agent := agentI.(*baseAgent); agent.paused() && agent.config.Pause.RejectTasks {
+		return ErrAgentPaused
+	}
+
 	if task.ID == "" {
 		task.ID = uuid.New().String()
 	}
 
 	// 存储任务初始状态
-	taskStatus := types.TaskStatus{
-		ID:        task.ID,
-		Status:    "pending",
-		Progress:  0.0,
-		StartTime: time.Now(),
+	m.taskAgents.Store(task.ID, agentID)
+	m.taskDefs.Store(task.ID, task)
+	m.done.Store(task.ID, &taskDone{ch: make(chan struct{})})
+	m.streams.Store(task.ID, newTaskStream())
+	m.setTask(types.TaskStatus{
+		ID:         task.ID,
+		Status:     "pending",
+		Progress:   0.0,
+		Delegation: task.Delegation,
+		StartTime:  time.Now(),
+	})
+
+	// 任务的生命周期与调用方解耦，只能通过CancelTask取消
+	taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	m.cancels.Store(task.ID, cancel)
+
+	// startAttempt 在任务入队前更新任务状态，已取消的任务不再执行
+	startAttempt := func(attempt int) bool {
+		return m.updateTask(task.ID, func(status *types.TaskStatus) bool {
+			if status.Status == "cancelled" {
+				return false
+			}
+			status.Status = "running"
+			status.Attempts = attempt
+			return true
+		})
+	}
+	if !startAttempt(1) {
+		cancel()
+		m.cancels.Delete(task.ID)
+		return nil
+	}
+
+	// 同步入队，队列已满时按配置向调用方返回ErrQueueFull或阻塞调用方
+	agent := agentI.(*baseAgent)
+	future, err := agent.enqueue(ctx, taskCtx, task)
+	if err != nil {
+		cancel()
+		m.forgetTask(task.ID)
+		return err
 	}
-	m.tasks.Store(task.ID, taskStatus)
 
 	// 发送任务分配事件
 	m.emitEvent(agentID, Event{
 		ID:        uuid.New().String(),
+		TaskID:    task.ID,
 		Type:      "task_assigned",
 		Data:      task.ID,
 		Timestamp: time.Now(),
 	})
 
-	// 异步执行任务
+	// 异步等待任务结束
 	go func() {
-		agent := agentI.(types.Agent)
-
-		// 更新Agent状态
-		if baseAgent, ok := agent.(*baseAgent); ok {
-			baseAgent.status.Status = "working"
-			baseAgent.status.CurrentTask = task.ID
-		}
-
-		// 更新任务状态
-		taskStatus.Status = "running"
-		m.tasks.Store(task.ID, taskStatus)
-
-		// 执行任务
-		result, err := agent.Execute(ctx, task)
-
-		// 更新任务状态
-		endTime := time.Now()
-		taskStatus.EndTime = endTime
-
-		if err != nil {
-			taskStatus.Status = "failed"
-			taskStatus.Error = err
-			m.emitEvent(agentID, Event{
-				ID:        uuid.New().String(),
-				Type:      "task_failed",
-				Data:      map[string]interface{}{"task_id": task.ID, "error": err.Error()},
-				Timestamp: endTime,
+		defer func() {
+			cancel()
+			m.cancels.Delete(task.ID)
+		}()
+
+		policy := retryPolicyFor(agent.config, task)
+
+		// 执行任务，按重试策略重试可恢复的错误
+		var result types.Result
+		var err error
+		for attempt := 1; ; attempt++ {
+			// 第一次执行的任务已经入队，重试时重新入队
+			if attempt == 1 {
+				result, err = agent.wait(taskCtx, task, future)
+			} else if startAttempt(attempt) {
+				result, err = agent.Execute(taskCtx, task)
+			} else {
+				return
+			}
+			if !shouldRetry(policy, attempt, err) || taskCtx.Err() != nil {
+				break
+			}
+
+			delay := retryBackoff(policy, attempt)
+			m.updateTask(task.ID, func(status *types.TaskStatus) bool {
+				if status.Status == "cancelled" {
+					return false
+				}
+				status.Status = "retrying"
+				status.Error = err
+				return true
 			})
-		} else {
-			taskStatus.Status = "completed"
-			taskStatus.Result = result
-			taskStatus.Progress = 1.0
 			m.emitEvent(agentID, Event{
-				ID:        uuid.New().String(),
-				Type:      "task_completed",
-				Data:      map[string]interface{}{"task_id": task.ID},
-				Timestamp: endTime,
+				ID:   uuid.New().String(),
+				Type: "task_retrying",
+				Data: map[string]interface{}{
+					"task_id":  task.ID,
+					"attempt":  attempt,
+					"error":    err.Error(),
+					"delay_ms": delay.Milliseconds(),
+				},
+				Timestamp: time.Now(),
 			})
+
+			// 等待退避时间，期间任务可被取消
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-taskCtx.Done():
+				timer.Stop()
+			}
+			if taskCtx.Err() != nil {
+				break
+			}
 		}
 
-		m.tasks.Store(task.ID, taskStatus)
+		// 被放弃的任务由DestroyAgent记录状态并发送事件
+		if errors.Is(err, ErrTaskAbandoned) {
+			return
+		}
 
-		// 更新Agent状态
-		if baseAgent, ok := agent.(*baseAgent); ok {
-			baseAgent.status.Status = "idle"
-			baseAgent.status.CurrentTask = ""
+		// 更新任务状态
+		endTime := time.Now()
+		cancelled := errors.Is(taskCtx.Err(), context.Canceled)
+
+		m.updateTask(task.ID, func(status *types.TaskStatus) bool {
+			// 取消状态由CancelTask写入，不再覆盖
+			if cancelled || status.Status == "cancelled" {
+				return false
+			}
+
+			status.EndTime = endTime
+			if err != nil {
+				status.Status = "failed"
+				status.Error = err
+			} else {
+				status.Status = "completed"
+				status.Result = result
+				status.Error = nil
+				status.Progress = 1.0
+			}
+			return true
+		})
+
+		if !cancelled {
+			if err != nil {
+				m.emitEvent(agentID, Event{
+					ID:        uuid.New().String(),
+					Type:      "task_failed",
+					Data:      map[string]interface{}{"task_id": task.ID, "error": err.Error()},
+					Timestamp: endTime,
+				})
+			} else {
+				m.emitEvent(agentID, Event{
+					ID:        uuid.New().String(),
+					Type:      "task_completed",
+					Data:      map[string]interface{}{"task_id": task.ID},
+					Timestamp: endTime,
+				})
+			}
 		}
 	}()
 
@@ -282,31 +465,75 @@ func (m *manager) AssignTask(ctx context.Context, agentID string, task types.Tas
 
 // CancelTask 取消任务
 func (m *manager) CancelTask(ctx context.Context, taskID string) error {
-	taskI, ok := m.tasks.Load(taskID)
-	if !ok {
+	if _, ok := m.tasks.Load(taskID); !ok {
 		return ErrTaskNotFound
 	}
 
-	taskStatus := taskI.(types.TaskStatus)
-	if taskStatus.Status == "completed" || taskStatus.Status == "failed" {
-		return nil // 任务已经完成或失败，无需取消
+	// 通知运行时移除排队中的任务或中断正在执行的任务
+	inRuntime := false
+	if agent := m.taskAgent(taskID); agent != nil && agent.runtime != nil {
+		inRuntime = agent.runtime.CancelTask(taskID)
 	}
 
-	// 更新任务状态
-	taskStatus.Status = "cancelled"
-	taskStatus.EndTime = time.Now()
-	m.tasks.Store(taskID, taskStatus)
+	// 取消任务上下文，传递到工具执行和模型调用
+	if cancel, ok := m.cancels.Load(taskID); ok {
+		cancel.(context.CancelFunc)()
+	}
 
-	// TODO: 实际中需要通知Agent取消任务的执行
+	updated := m.updateTask(taskID, func(status *types.TaskStatus) bool {
+		if isTerminalStatus(status.Status) && !inRuntime {
+			return false // 任务已经结束，无需取消
+		}
+		status.Status = "cancelled"
+		status.EndTime = time.Now()
+		return true
+	})
+	if !updated {
+		return nil
+	}
+
+	agentID, _ := m.taskAgents.Load(taskID)
+	if agentID, ok := agentID.(string); ok {
+		m.emitEvent(agentID, Event{
+			ID:        uuid.New().String(),
+			Type:      "task_cancelled",
+			Data:      map[string]interface{}{"task_id": taskID},
+			Timestamp: time.Now(),
+		})
+	}
 
 	return nil
 }
 
+// WaitTask 等待任务结束并返回最终状态
+func (m *manager) WaitTask(ctx context.Context, taskID string) (types.TaskStatus, error) {
+	doneI, ok := m.done.Load(taskID)
+	if !ok {
+		// 上次运行中已结束的任务只存在于任务存储中
+		record, err := m.store.Get(ctx, taskID)
+		if err != nil || !isTerminalStatus(record.Status) {
+			return types.TaskStatus{}, ErrTaskNotFound
+		}
+		return record.TaskStatus(), nil
+	}
+
+	select {
+	case <-doneI.(*taskDone).ch:
+		return m.GetTaskStatus(ctx, taskID)
+	case <-ctx.Done():
+		return types.TaskStatus{}, ctx.Err()
+	}
+}
+
 // GetTaskStatus 获取任务状态
 func (m *manager) GetTaskStatus(ctx context.Context, taskID string) (types.TaskStatus, error) {
 	taskI, ok := m.tasks.Load(taskID)
 	if !ok {
-		return types.TaskStatus{}, ErrTaskNotFound
+		record, err := m.store.Get(ctx, taskID)
+		if err != nil {
+			return types.TaskStatus{}, ErrTaskNotFound
+		}
+		return record.TaskStatus(), nil
 	}
 
 	return taskI.(types.TaskStatus), nil
@@ -323,46 +550,364 @@ func (m *manager) GetAgentStatus(ctx context.Context, agentID string) (types.Age
 	return agent.Status(), nil
 }
 
-// SubscribeToEvents 订阅Agent事件
+// SubscribeToEvents 订阅Agent事件，使用默认的缓冲区大小和丢弃策略。
+// 返回的通道在ctx结束或Agent被销毁时关闭
 func (m *manager) SubscribeToEvents(ctx context.Context, agentID string) (<-chan Event, error) {
-	m.eventsMu.RLock()
-	ch, ok := m.events[agentID]
-	m.eventsMu.RUnlock()
+	sub, err := m.Subscribe(ctx, SubscribeOptions{AgentID: agentID})
+	if err != nil {
+		return nil, err
+	}
+	return sub.Events(), nil
+}
 
-	if !ok {
+// Subscribe 按条件订阅事件。指定AgentID时该Agent必须存在，订阅在Agent被销毁时结束；
+// 未指定时订阅所有Agent的事件，直到ctx结束或调用Unsubscribe
+func (m *manager) Subscribe(ctx context.Context, opts SubscribeOptions) (*Subscription, error) {
+	if opts.AgentID == "" {
+		return m.events.Subscribe(ctx, opts), nil
+	}
+
+	if _, ok := m.agents.Load(opts.AgentID); !ok {
+		return nil, ErrAgentNotFound
+	}
+	sub := m.events.Subscribe(ctx, opts)
+
+	// 订阅期间Agent可能已被销毁，此时不会再有人关闭该订阅
+	if _, ok := m.agents.Load(opts.AgentID); !ok {
+		sub.Unsubscribe()
 		return nil, ErrAgentNotFound
 	}
+	return sub, nil
+}
+
+// ReplayEvents 从事件日志中按序号顺序重放符合条件的事件。
+// 晚到的订阅者可以先订阅，再重放历史事件，并忽略订阅中序号不大于最后重放事件的事件
+func (m *manager) ReplayEvents(ctx context.Context, query EventQuery) ([]Event, error) {
+	if m.journal == nil {
+		return nil, ErrJournalDisabled
+	}
+	return m.journal.Replay(ctx, query)
+}
+
+// SetBudget 替换Agent的资源预算，已有的用量保持不变。
+// 因超出预算而暂停的Agent需要在调整预算后调用ResumeAgent恢复
+func (m *manager) SetBudget(ctx context.Context, agentID string, budget BudgetConfig) error {
+	agentI, ok := m.agents.Load(agentID)
+	if !ok {
+		return ErrAgentNotFound
+	}
 
-	return ch, nil
+	if problems := validateBudget(budget); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+
+	if agent := agentI.(*baseAgent); agent.runtime != nil {
+		agent.runtime.meter.setBudget(budget)
+	}
+	return nil
+}
+
+// PendingApprovals 按请求时间返回等待审批的工具调用，agentID为空时返回所有Agent的请求
+func (m *manager) PendingApprovals(ctx context.Context, agentID string) ([]ApprovalRequest, error) {
+	if agentID != "" {
+		if _, ok := m.agents.Load(agentID); !ok {
+			return nil, ErrAgentNotFound
+		}
+	}
+	return m.approvals.list(agentID), nil
+}
+
+// ResolveApproval 对等待审批的工具调用作出决定，被挂起的任务随即继续执行
+func (m *manager) ResolveApproval(ctx context.Context, approvalID string, decision ApprovalDecision) error {
+	if err := validateApprovalDecision(decision); err != nil {
+		return err
+	}
+	return m.approvals.resolve(approvalID, decision)
 }
 
 // 内部辅助方法
 
-// validateConfig 验证Agent配置
+// markAwaitingApproval 在任务等待审批期间将其状态标记为awaiting_approval
+func (m *manager) markAwaitingApproval(taskID string, waiting bool) {
+	m.updateTask(taskID, func(status *types.TaskStatus) bool {
+		switch {
+		case isTerminalStatus(status.Status):
+			return false
+		case waiting:
+			status.Status = "awaiting_approval"
+		case status.Status == "awaiting_approval":
+			status.Status = "running"
+		default:
+			return false
+		}
+		return true
+	})
+}
+
+// recordTaskUsage 将模型调用的用量累加到任务状态
+func (m *manager) recordTaskUsage(taskID string, usage types.ResourceStats) {
+	m.updateTask(taskID, func(status *types.TaskStatus) bool {
+		if isTerminalStatus(status.Status) {
+			return false
+		}
+		addResources(&status.Resources, usage)
+		return true
+	})
+}
+
+// validateConfig 验证Agent配置，一次性报告所有问题
 func (m *manager) validateConfig(config AgentConfig) error {
+	var problems []string
+
 	if config.Name == "" {
-		return ErrInvalidConfig
+		problems = append(problems, "name is required")
+	}
+	if config.MaxSteps < 0 {
+		problems = append(problems, "max steps must not be negative")
+	}
+	if config.Model.Temperature < 0 || config.Model.MaxTokens < 0 {
+		problems = append(problems, "model temperature and max tokens must not be negative")
+	}
+	for i, t := range config.Tools {
+		if t.ID == "" {
+			problems = append(problems, fmt.Sprintf("tool %d has no id", i))
+		}
+	}
+	if _, ok := lookupTaskOrdering(config.Queue.Ordering); !ok {
+		problems = append(problems, fmt.Sprintf("unknown task ordering %q", config.Queue.Ordering))
+	}
+	if config.Queue.Capacity < 0 || config.Queue.Concurrency < 0 {
+		problems = append(problems, "queue capacity and concurrency must not be negative")
+	}
+	if config.Retry.MaxAttempts < 0 || config.Retry.Jitter < 0 || config.Retry.Jitter > 1 {
+		problems = append(problems, "retry max attempts must not be negative and jitter must be between 0 and 1")
+	}
+	switch config.Recovery {
+	case "", RecoverRequeue, RecoverFail:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown recovery policy %q", config.Recovery))
+	}
+	problems = append(problems, validateBudget(config.Budget)...)
+	if config.Approval.Timeout < 0 {
+		problems = append(problems, "approval timeout must not be negative")
+	}
+	switch config.Approval.OnTimeout {
+	case "", ApprovalApprove, ApprovalReject:
+	default:
+		problems = append(problems, fmt.Sprintf("approval timeout action must be approve or reject, got %q", config.Approval.OnTimeout))
 	}
 
-	// TODO: 添加更多验证逻辑
-
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
 	return nil
 }
 
-// emitEvent 发送事件
-func (m *manager) emitEvent(agentID string, event Event) {
-	m.eventsMu.RLock()
-	ch, ok := m.events[agentID]
-	m.eventsMu.RUnlock()
-
-	if ok {
-		// 非阻塞发送，如果通道已满则丢弃事件
-		select {
-		case ch <- event:
-		default:
-			// TODO: 可以考虑记录日志
+// updateTask 在锁保护下修改任务状态，fn返回false时放弃修改。
+// 修改后的状态在释放锁之后写入任务存储，写入后才通知任务的等待者
+func (m *manager) updateTask(taskID string, fn func(status *types.TaskStatus) bool) bool {
+	finish, ok := m.modifyTask(taskID, fn)
+	if !ok {
+		return false
+	}
+	m.persister.flush()
+	finish()
+	return true
+}
+
+// modifyTask 在锁保护下修改任务状态，并将修改后的状态加入写入队列。
+// 返回的finish在状态写入后调用，任务结束时通知等待者并释放任务的资源
+func (m *manager) modifyTask(taskID string, fn func(status *types.TaskStatus) bool) (func(), bool) {
+	m.tasksMu.Lock()
+	defer m.tasksMu.Unlock()
+
+	taskI, ok := m.tasks.Load(taskID)
+	if !ok {
+		return nil, false
+	}
+
+	status := taskI.(types.TaskStatus)
+	if !fn(&status) {
+		return nil, false
+	}
+
+	m.tasks.Store(taskID, status)
+	m.persistTask(status)
+
+	if !isTerminalStatus(status.Status) {
+		return func() {}, true
+	}
+	// 在锁内取出任务的通知通道和输出，避免影响之后以相同ID分配的任务
+	doneI, _ := m.done.Load(taskID)
+	streamI, _ := m.streams.LoadAndDelete(taskID)
+	agent := m.taskAgent(taskID)
+	return func() {
+		if doneI != nil {
+			doneI.(*taskDone).close()
+		}
+		if streamI != nil {
+			streamI.(*taskStream).close()
 		}
+		// 任务的用量统计跨越重试，直到任务结束才释放
+		if agent != nil && agent.runtime != nil {
+			agent.runtime.meter.release(taskID)
+		}
+	}, true
+}
+
+// forgetTask 撤销未能入队的任务的登记和存储记录，唤醒已经开始等待该任务的调用方
+func (m *manager) forgetTask(taskID string) {
+	m.tasksMu.Lock()
+	m.tasks.Delete(taskID)
+	m.taskAgents.Delete(taskID)
+	m.taskDefs.Delete(taskID)
+	m.cancels.Delete(taskID)
+	doneI, _ := m.done.LoadAndDelete(taskID)
+	streamI, _ := m.streams.LoadAndDelete(taskID)
+	m.tasksMu.Unlock()
+
+	if err := m.persister.delete(taskID); err != nil {
+		m.reportPersistError([]string{taskID}, err)
+	}
+	if doneI != nil {
+		doneI.(*taskDone).close()
 	}
+	if streamI != nil {
+		streamI.(*taskStream).close()
+	}
+}
+
+// setTask 在锁保护下写入任务状态
+func (m *manager) setTask(status types.TaskStatus) {
+	m.tasksMu.Lock()
+	m.tasks.Store(status.ID, status)
+	m.persistTask(status)
+	m.tasksMu.Unlock()
+
+	m.persister.flush()
+}
+
+// persistTask 将任务状态加入写入队列，调用方需持有tasksMu以保证写入顺序
+func (m *manager) persistTask(status types.TaskStatus) {
+	taskI, ok := m.taskDefs.Load(status.ID)
+	if !ok {
+		return
+	}
+	agentID, _ := m.taskAgents.Load(status.ID)
+	agentIDStr, _ := agentID.(string)
+
+	m.persister.enqueue(newTaskRecord(taskI.(types.Task), agentIDStr, status))
+}
+
+// reportPersistError 为每个写入失败的任务发布事件，失败的记录随下一次写入重试
+func (m *manager) reportPersistError(taskIDs []string, err error) {
+	for _, taskID := range taskIDs {
+		agentID, _ := m.taskAgents.Load(taskID)
+		agentIDStr, _ := agentID.(string)
+
+		event := NewEvent(uuid.New().String(), "task_persist_failed", err.Error())
+		event.TaskID = taskID
+		m.emitEvent(agentIDStr, *event)
+	}
+}
+
+// recoverTasks 恢复Agent在上次运行中未完成的任务：尚未开始的任务重新入队，
+// 执行中被中断的任务按Agent的恢复策略重新入队或标记为失败。
+// 无法读取任务存储或任务无法重新入队时发布task_recover_failed事件
+func (m *manager) recoverTasks(ctx context.Context, config AgentConfig) {
+	records, err := m.store.List(ctx)
+	if err != nil {
+		m.emitEvent(config.ID, *NewEvent(uuid.New().String(), "task_recover_failed", err.Error()))
+		return
+	}
+
+	for _, record := range records {
+		if record.AgentID != config.ID || !isRecoverableStatus(record.Status) {
+			continue
+		}
+
+		// 当前进程中仍在处理的任务无需恢复
+		if statusI, ok := m.tasks.Load(record.Task.ID); ok && !isTerminalStatus(statusI.(types.TaskStatus).Status) {
+			continue
+		}
+
+		action := "requeued"
+		if record.Status != "pending" && config.Recovery == RecoverFail {
+			action = "failed"
+			status := record.TaskStatus()
+			status.Status = "failed"
+			status.Error = ErrTaskInterrupted
+			status.EndTime = time.Now()
+
+			m.taskAgents.Store(record.Task.ID, config.ID)
+			m.taskDefs.Store(record.Task.ID, record.Task)
+			done := &taskDone{ch: make(chan struct{})}
+			done.close()
+			m.done.Store(record.Task.ID, done)
+			m.setTask(status)
+		} else if err := m.AssignTask(ctx, config.ID, record.Task); err != nil {
+			event := NewEvent(uuid.New().String(), "task_recover_failed", err.Error())
+			event.TaskID = record.Task.ID
+			m.emitEvent(config.ID, *event)
+			continue
+		}
+
+		m.emitEvent(config.ID, Event{
+			ID:   uuid.New().String(),
+			Type: "task_recovered",
+			Data: map[string]interface{}{
+				"task_id":         record.Task.ID,
+				"previous_status": record.Status,
+				"action":          action,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// isRecoverableStatus 判断任务是否在上次运行中未完成
+func isRecoverableStatus(status string) bool {
+	return status == "pending" || status == "running" || status == "retrying" || status == "awaiting_approval" || status == "abandoned"
+}
+
+// taskDone 在任务结束时关闭，用于等待任务完成
+type taskDone struct {
+	ch   chan struct{}
+	once sync.Once
+}
+
+// close 关闭通知通道，可重复调用
+func (d *taskDone) close() {
+	d.once.Do(func() {
+		close(d.ch)
+	})
+}
+
+// taskAgent 返回任务所属的Agent
+func (m *manager) taskAgent(taskID string) *baseAgent {
+	agentID, ok := m.taskAgents.Load(taskID)
+	if !ok {
+		return nil
+	}
+
+	agentI, ok := m.agents.Load(agentID)
+	if !ok {
+		return nil
+	}
+
+	agent, _ := agentI.(*baseAgent)
+	return agent
+}
+
+// isTerminalStatus 判断任务是否已经结束
+func isTerminalStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled" || status == "abandoned"
+}
+
+// emitEvent 将Agent的事件发布到事件总线，写入事件日志失败时由事件总线广播journal_write_failed事件
+func (m *manager) emitEvent(agentID string, event Event) {
+	event.AgentID = agentID
+	m.events.emit(event)
 }
 
 // baseAgent 是Agent接口的基本实现
@@ -389,63 +934,127 @@ func (a *baseAgent) Initialize(ctx context.Context) error {
 	return nil
 }
 
-// Execute 执行任务
+// Execute 执行任务，阻塞直到任务完成、ctx结束或到达任务截止时间
 func (a *baseAgent) Execute(ctx context.Context, task types.Task) (types.Result, error) {
-	a.mu.Lock()
-	a.status.Status = "working"
-	a.status.CurrentTask = task.ID
-	a.mu.Unlock()
-
 	// 使用运行时执行任务
+	future, err := a.enqueue(ctx, ctx, task)
+	if err != nil {
+		return types.Result{}, err
+	}
+	return a.wait(ctx, task, future)
+}
+
+// enqueue 将任务加入运行时队列，队列已满时按配置返回ErrQueueFull或等待直到ctx结束，
+// taskCtx传递给任务执行过程
+func (a *baseAgent) enqueue(ctx, taskCtx context.Context, task types.Task) (*TaskFuture, error) {
 	if a.runtime == nil {
-		return types.Result{}, fmt.Errorf("agent runtime not available")
+		return nil, fmt.Errorf("agent runtime not available")
 	}
+	return a.runtime.enqueue(ctx, taskCtx, task)
+}
 
-	if err := a.runtime.EnqueueTask(task); err != nil {
-		a.mu.Lock()
-		a.status.Status = "error"
-		a.mu.Unlock()
-		return types.Result{}, err
+// wait 等待已入队的任务结束，任务设置了截止时间时最多等待到截止时间
+func (a *baseAgent) wait(ctx context.Context, task types.Task, future *TaskFuture) (types.Result, error) {
+	waitCtx := ctx
+	if !task.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithDeadline(ctx, task.Deadline)
+		defer cancel()
 	}
 
-	// 这里简化实现，实际上任务是异步执行的
-	// 真实情况下需要等待任务完成或实现回调机制
+	return future.Wait(waitCtx)
+}
 
-	// 模拟简单结果
-	result := types.Result{
-		Data: map[string]interface{}{
-			"message": "Task received and processing",
-		},
-		Metadata: map[string]interface{}{
-			"task_id": task.ID,
-			"status":  "processing",
-		},
-		Timestamp: time.Now(),
+// pause 暂停Agent，返回因暂停被中断的任务ID
+func (a *baseAgent) pause() []string {
+	a.setStatus("paused")
+
+	if a.runtime == nil {
+		return nil
+	}
+	return a.runtime.Pause(a.config.Pause.Checkpoint)
+}
+
+// resume 恢复Agent
+func (a *baseAgent) resume() {
+	a.mu.Lock()
+	if a.status.CurrentTask != "" {
+		a.status.Status = "working"
+	} else {
+		a.status.Status = "idle"
+	}
+	a.mu.Unlock()
+
+	if a.runtime != nil {
+		a.runtime.Resume()
 	}
+}
 
-	return result, nil
+// paused 判断Agent是否处于暂停状态
+func (a *baseAgent) paused() bool {
+	return a.runtime != nil && a.runtime.Paused()
 }
 
-// Stop 停止Agent
-func (a *baseAgent) Stop(ctx context.Context) error {
+// markTaskStarted 记录Agent开始执行任务
+func (a *baseAgent) markTaskStarted(taskID string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	a.status.Status = "stopped"
+	// 排空和暂停期间保持原状态
+	if a.status.Status != "stopping" && a.status.Status != "paused" {
+		a.status.Status = "working"
+	}
+	a.status.CurrentTask = taskID
+}
 
-	// 停止运行时
-	if a.runtime != nil {
-		if err := a.runtime.Stop(ctx); err != nil {
-			return fmt.Errorf("failed to stop runtime: %w", err)
-		}
+// markTaskFinished 记录Agent结束执行任务
+func (a *baseAgent) markTaskFinished(taskID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.status.CurrentTask == taskID {
+		a.status.CurrentTask = ""
+	}
+	if a.status.Status == "working" {
+		a.status.Status = "idle"
 	}
+}
 
+// Stop 停止Agent
+func (a *baseAgent) Stop(ctx context.Context) error {
+	if _, err := a.shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop runtime: %w", err)
+	}
 	return nil
 }
 
+// shutdown 停止Agent并返回未能完成的任务
+func (a *baseAgent) shutdown(ctx context.Context) ([]types.Task, error) {
+	// 排空期间任务仍需更新Agent状态，因此不能持有锁等待运行时
+	a.setStatus("stopping")
+	defer a.setStatus("stopped")
+
+	if a.runtime == nil {
+		return nil, nil
+	}
+	return a.runtime.Shutdown(ctx)
+}
+
+// setStatus 设置Agent状态
+func (a *baseAgent) setStatus(status string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.Status = status
+}
+
 // Status 获取Agent状态
 func (a *baseAgent) Status() types.AgentStatus {
 	a.mu.RLock()
-	defer a.mu.RUnlock()
-	return a.status
+	status := a.status
+	a.mu.RUnlock()
+
+	if a.runtime != nil {
+		status.Resources = a.runtime.meter.totals()
+	}
+	return status
 }
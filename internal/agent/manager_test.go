@@ -0,0 +1,352 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/memory"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// newTestManager 创建一个使用给定提供者的Agent管理器
+func newTestManager(t *testing.T, provider types.Provider) Manager {
+	t.Helper()
+
+	service := llm.NewService()
+	if err := service.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+
+	return NewManager(tool.NewManager(), memory.NewManager(), nil, service, nil, nil)
+}
+
+// createTestAgent 创建一个测试Agent
+func createTestAgent(t *testing.T, mgr Manager) string {
+	t.Helper()
+
+	agent, err := mgr.CreateAgent(context.Background(), AgentConfig{
+		Name:  "TestAgent",
+		Model: ModelConfig{Type: "fake-model"},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	return agent.Status().ID
+}
+
+func TestManagerTaskResult(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong"))
+	agentID := createTestAgent(t, mgr)
+
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	status, err := mgr.WaitTask(waitCtx, task.ID)
+	if err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+	if status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际状态 %s，错误 %v", status.Status, status.Error)
+	}
+
+	result, ok := status.Result.(types.Result)
+	if !ok {
+		t.Fatalf("任务结果类型不正确: %T", status.Result)
+	}
+	if data := result.Data.(map[string]interface{}); data["response"] != "pong" {
+		t.Errorf("期望响应为 pong，实际得到 %v", data["response"])
+	}
+}
+
+func TestManagerTaskFailure(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+	agentID := createTestAgent(t, mgr)
+
+	task := types.Task{ID: "task-1", Type: "unknown"}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+
+	status, err := mgr.WaitTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+	if status.Status != "failed" || status.Error == nil {
+		t.Errorf("期望任务失败并带有错误，实际状态 %s，错误 %v", status.Status, status.Error)
+	}
+}
+
+func TestExecuteDeadline(t *testing.T) {
+	provider := &blockingProvider{started: make(chan string, 1)}
+	mgr := newTestManager(t, provider)
+	agentID := createTestAgent(t, mgr)
+
+	agentI, _ := mgr.(*manager).agents.Load(agentID)
+	agent := agentI.(*baseAgent)
+
+	task := types.Task{
+		ID:         "task-1",
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": "slow"},
+		Deadline:   time.Now().Add(50 * time.Millisecond),
+	}
+
+	_, err := agent.Execute(context.Background(), task)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望超过截止时间错误，实际得到 %v", err)
+	}
+}
+
+func TestManagerCancelTask(t *testing.T) {
+	ctx := context.Background()
+	provider := &blockingProvider{started: make(chan string, 1)}
+	mgr := newTestManager(t, provider)
+	agentID := createTestAgent(t, mgr)
+
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "slow"}}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	<-provider.started
+
+	if err := mgr.CancelTask(ctx, task.ID); err != nil {
+		t.Fatalf("取消任务失败: %v", err)
+	}
+
+	status, err := mgr.WaitTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+	if status.Status != "cancelled" {
+		t.Errorf("期望任务已取消，实际状态 %s", status.Status)
+	}
+
+	// 运行时中的任务应已结束
+	agent := mgr.(*manager).taskAgent(task.ID)
+	waitFor(t, func() bool {
+		agent.runtime.runningMu.Lock()
+		defer agent.runtime.runningMu.Unlock()
+		return len(agent.runtime.running) == 0
+	})
+}
+
+func TestManagerAssignTaskQueueFull(t *testing.T) {
+	ctx := context.Background()
+	provider := &blockingProvider{started: make(chan string, 2)}
+	mgr := newTestManager(t, provider)
+
+	for _, block := range []bool{false, true} {
+		agent, err := mgr.CreateAgent(ctx, AgentConfig{
+			Name:  "QueuedAgent",
+			Model: ModelConfig{Type: "fake-model"},
+			Queue: QueueConfig{Capacity: 1, BlockWhenFull: block},
+		})
+		if err != nil {
+			t.Fatalf("创建Agent失败: %v", err)
+		}
+		agentID := agent.Status().ID
+
+		// 第一个任务开始执行，第二个任务占满队列
+		running := types.Task{ID: fmt.Sprintf("running-%v", block), Type: "conversation", Parameters: map[string]interface{}{"input": "slow"}}
+		if err := mgr.AssignTask(ctx, agentID, running); err != nil {
+			t.Fatalf("分配任务失败: %v", err)
+		}
+		<-provider.started
+		queued := types.Task{ID: fmt.Sprintf("queued-%v", block), Type: "conversation", Parameters: map[string]interface{}{"input": "slow"}}
+		if err := mgr.AssignTask(ctx, agentID, queued); err != nil {
+			t.Fatalf("分配任务失败: %v", err)
+		}
+
+		// 队列已满时调用方应收到错误，或阻塞到ctx结束
+		wantErr := ErrQueueFull
+		assignCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		if block {
+			wantErr = context.DeadlineExceeded
+		}
+		rejected := types.Task{ID: fmt.Sprintf("rejected-%v", block), Type: "conversation", Parameters: map[string]interface{}{"input": "slow"}}
+		err = mgr.AssignTask(assignCtx, agentID, rejected)
+		cancel()
+		if !errors.Is(err, wantErr) {
+			t.Errorf("期望错误 %v，实际得到 %v", wantErr, err)
+		}
+
+		// 未能入队的任务不应留下记录
+		if _, err := mgr.GetTaskStatus(ctx, rejected.ID); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("期望找不到未入队的任务，实际得到 %v", err)
+		}
+
+		for _, id := range []string{running.ID, queued.ID} {
+			if err := mgr.CancelTask(ctx, id); err != nil {
+				t.Fatalf("取消任务失败: %v", err)
+			}
+		}
+	}
+}
+
+func TestDestroyAgentAbandonsTasks(t *testing.T) {
+	ctx := context.Background()
+	provider := &blockingProvider{started: make(chan string, 2)}
+	mgr := newTestManager(t, provider)
+	agentID := createTestAgent(t, mgr)
+
+	events, err := mgr.SubscribeToEvents(ctx, agentID)
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	for _, id := range []string{"running", "queued"} {
+		task := types.Task{ID: id, Type: "conversation", Parameters: map[string]interface{}{"input": id}}
+		if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+			t.Fatalf("分配任务失败: %v", err)
+		}
+	}
+	<-provider.started
+	waitFor(t, func() bool {
+		return mgr.(*manager).taskAgent("queued").runtime.taskQueue.len() == 1
+	})
+
+	stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := mgr.DestroyAgent(stopCtx, agentID); err != nil {
+		t.Fatalf("销毁Agent失败: %v", err)
+	}
+
+	for _, id := range []string{"running", "queued"} {
+		status, err := mgr.WaitTask(ctx, id)
+		if err != nil {
+			t.Fatalf("等待任务失败: %v", err)
+		}
+		if status.Status != "abandoned" || !errors.Is(status.Error, ErrTaskAbandoned) {
+			t.Errorf("期望任务 %s 被放弃，实际状态 %s，错误 %v", id, status.Status, status.Error)
+		}
+	}
+
+	abandoned := 0
+	for event := range events {
+		if event.Type == "task_abandoned" {
+			abandoned++
+		}
+	}
+	if abandoned != 2 {
+		t.Errorf("期望2个任务放弃事件，实际得到 %d", abandoned)
+	}
+}
+
+func TestAssignTaskToPausedAgent(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong"))
+
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:  "TestAgent",
+		Model: ModelConfig{Type: "fake-model"},
+		Pause: PauseConfig{RejectTasks: true},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+
+	if err := mgr.PauseAgent(ctx, agentID); err != nil {
+		t.Fatalf("暂停Agent失败: %v", err)
+	}
+
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}
+	if err := mgr.AssignTask(ctx, agentID, task); !errors.Is(err, ErrAgentPaused) {
+		t.Fatalf("期望暂停的Agent拒绝任务，实际得到 %v", err)
+	}
+
+	if err := mgr.ResumeAgent(ctx, agentID); err != nil {
+		t.Fatalf("恢复Agent失败: %v", err)
+	}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("恢复后分配任务失败: %v", err)
+	}
+
+	status, err := mgr.WaitTask(ctx, task.ID)
+	if err != nil || status.Status != "completed" {
+		t.Errorf("期望任务完成，实际状态 %s，错误 %v", status.Status, err)
+	}
+}
+
+// flakyProvider 在返回脚本响应前先返回若干次指定错误
+type flakyProvider struct {
+	fakeProvider
+	failures int
+	err      error
+}
+
+func (p *flakyProvider) Chat(ctx context.Context, modelID string, request types.ChatRequest) (types.ChatResponse, error) {
+	p.mu.Lock()
+	if p.failures > 0 {
+		p.failures--
+		p.mu.Unlock()
+		return types.ChatResponse{}, p.err
+	}
+	p.mu.Unlock()
+	return p.fakeProvider.Chat(ctx, modelID, request)
+}
+
+func TestManagerTaskRetry(t *testing.T) {
+	ctx := context.Background()
+	provider := &flakyProvider{
+		fakeProvider: *newFakeProvider("pong"),
+		failures:     1,
+		err:          fmt.Errorf("connection reset: %w", types.ErrLLMNotAvailable),
+	}
+	mgr := newTestManager(t, provider)
+	agentID := createTestAgent(t, mgr)
+
+	events, err := mgr.SubscribeToEvents(ctx, agentID)
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	task := types.Task{
+		ID:         "task-1",
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": "ping"},
+		Retry:      &types.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	}
+	if err := mgr.AssignTask(ctx, agentID, task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+
+	status, err := mgr.WaitTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("等待任务失败: %v", err)
+	}
+	if status.Status != "completed" || status.Attempts != 2 {
+		t.Errorf("期望第2次执行成功，实际状态 %s，执行 %d 次，错误 %v", status.Status, status.Attempts, status.Error)
+	}
+
+	retried := false
+	for len(events) > 0 {
+		if event := <-events; event.Type == "task_retrying" {
+			retried = true
+		}
+	}
+	if !retried {
+		t.Error("期望收到task_retrying事件")
+	}
+
+	// 不可重试的错误和达到最大次数时不再重试
+	policy := types.RetryPolicy{MaxAttempts: 3}
+	if shouldRetry(policy, 1, errors.New("bad input")) {
+		t.Error("不可重试的错误不应重试")
+	}
+	if shouldRetry(policy, 3, types.ErrRateLimited) {
+		t.Error("达到最大次数后不应重试")
+	}
+}
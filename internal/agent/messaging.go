@@ -0,0 +1,345 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+const (
+	defaultMailboxSize = 100
+	// maxDelegationDepth 限制委托链长度，避免Agent之间循环委托
+	maxDelegationDepth = 8
+)
+
+// Message 是Agent之间传递的消息
+type Message struct {
+	ID        string
+	From      string      // 发送方AgentID
+	To        string      // 接收方AgentID
+	Role      string      // To为空时，发送给具有该角色且负载最低的Agent
+	Type      string      // 消息类型，由收发双方约定
+	Payload   interface{} // 消息内容
+	ReplyTo   string      // 所回复消息的ID
+	Timestamp time.Time
+}
+
+// Delegation 是一次任务委托请求
+type Delegation struct {
+	From string // 委托方AgentID，为空时取自ctx中正在执行的任务
+	To   string // 受托方AgentID
+	Role string // To为空时，委托给具有该角色且负载最低的Agent
+	Task types.Task
+}
+
+// mailbox 是Agent的消息信箱
+type mailbox struct {
+	ch     chan Message
+	closed chan struct{}
+}
+
+// messageBus 负责Agent之间的消息投递和回复匹配
+type messageBus struct {
+	mu        sync.Mutex
+	mailboxes map[string]*mailbox
+	waiters   map[string]chan Message // 请求消息ID -> 等待回复的通道
+}
+
+func newMessageBus() *messageBus {
+	return &messageBus{
+		mailboxes: make(map[string]*mailbox),
+		waiters:   make(map[string]chan Message),
+	}
+}
+
+// register 为Agent创建信箱
+func (b *messageBus) register(agentID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mailboxes[agentID] = &mailbox{
+		ch:     make(chan Message, defaultMailboxSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// unregister 关闭Agent的信箱，阻塞在该信箱上的收发操作返回ErrAgentNotFound
+func (b *messageBus) unregister(agentID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if box, ok := b.mailboxes[agentID]; ok {
+		close(box.closed)
+		delete(b.mailboxes, agentID)
+	}
+}
+
+// mailbox 返回Agent的信箱
+func (b *messageBus) mailbox(agentID string) (*mailbox, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	box, ok := b.mailboxes[agentID]
+	if !ok {
+		return nil, ErrAgentNotFound
+	}
+	return box, nil
+}
+
+// deliver 投递消息。回复消息优先交给等待该回复的请求方，否则放入接收方信箱，
+// 信箱已满时等待直到ctx结束
+func (b *messageBus) deliver(ctx context.Context, msg Message) error {
+	if msg.ReplyTo != "" {
+		b.mu.Lock()
+		waiter, ok := b.waiters[msg.ReplyTo]
+		if ok {
+			delete(b.waiters, msg.ReplyTo)
+		}
+		b.mu.Unlock()
+
+		if ok {
+			waiter <- msg
+			return nil
+		}
+	}
+
+	box, err := b.mailbox(msg.To)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case box.ch <- msg:
+		return nil
+	case <-box.closed:
+		return ErrAgentNotFound
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receive 从信箱中取出一条消息
+func (b *messageBus) receive(ctx context.Context, agentID string) (Message, error) {
+	box, err := b.mailbox(agentID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case msg := <-box.ch:
+		return msg, nil
+	case <-box.closed:
+		return Message{}, ErrAgentNotFound
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// await 登记等待指定消息的回复
+func (b *messageBus) await(msgID string) chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	waiter := make(chan Message, 1)
+	b.waiters[msgID] = waiter
+	return waiter
+}
+
+// cancelAwait 取消等待回复
+func (b *messageBus) cancelAwait(msgID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.waiters, msgID)
+}
+
+// SendMessage 向另一个Agent发送消息，返回消息ID
+func (m *manager) SendMessage(ctx context.Context, msg Message) (string, error) {
+	msg, err := m.prepareMessage(msg)
+	if err != nil {
+		return "", err
+	}
+	if err := m.messages.deliver(ctx, msg); err != nil {
+		return "", err
+	}
+
+	m.emitEvent(msg.To, Event{
+		ID:   uuid.New().String(),
+		Type: "message_received",
+		Data: map[string]interface{}{
+			"message_id": msg.ID,
+			"from":       msg.From,
+			"type":       msg.Type,
+			"reply_to":   msg.ReplyTo,
+		},
+		Timestamp: msg.Timestamp,
+	})
+	return msg.ID, nil
+}
+
+// ReceiveMessage 从Agent的信箱中取出下一条消息，信箱为空时等待直到ctx结束
+func (m *manager) ReceiveMessage(ctx context.Context, agentID string) (Message, error) {
+	return m.messages.receive(ctx, agentID)
+}
+
+// RequestMessage 发送消息并等待接收方通过ReplyMessage回复
+func (m *manager) RequestMessage(ctx context.Context, msg Message) (Message, error) {
+	msg, err := m.prepareMessage(msg)
+	if err != nil {
+		return Message{}, err
+	}
+
+	waiter := m.messages.await(msg.ID)
+	defer m.messages.cancelAwait(msg.ID)
+
+	if _, err := m.SendMessage(ctx, msg); err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case reply := <-waiter:
+		return reply, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// ReplyMessage 回复一条消息，回复直接交给等待中的请求方
+func (m *manager) ReplyMessage(ctx context.Context, request Message, msgType string, payload interface{}) error {
+	_, err := m.SendMessage(ctx, Message{
+		From:    request.To,
+		To:      request.From,
+		Type:    msgType,
+		Payload: payload,
+		ReplyTo: request.ID,
+	})
+	return err
+}
+
+// prepareMessage 补全消息ID和时间，并按角色确定接收方
+func (m *manager) prepareMessage(msg Message) (Message, error) {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	if msg.To == "" {
+		agentID, err := m.agentForRole(msg.Role, msg.From)
+		if err != nil {
+			return Message{}, err
+		}
+		msg.To = agentID
+	}
+	if _, ok := m.agents.Load(msg.To); !ok {
+		return Message{}, ErrAgentNotFound
+	}
+	return msg, nil
+}
+
+// DelegateTask 将子任务委托给另一个Agent执行，并等待其结束。
+// 在任务处理器中调用时，委托方和父任务取自ctx，子任务的委托链在父任务的基础上延长。
+// 委托给链上已有的Agent时返回ErrDelegationCycle
+func (m *manager) DelegateTask(ctx context.Context, delegation Delegation) (types.TaskStatus, error) {
+	hop := types.DelegationHop{AgentID: delegation.From}
+	if taskID, ok := ctx.Value("task_id").(string); ok {
+		hop.TaskID = taskID
+		if hop.AgentID == "" {
+			hop.AgentID, _ = ctx.Value("agent_id").(string)
+		}
+	}
+	if hop.AgentID == "" {
+		return types.TaskStatus{}, fmt.Errorf("%w: delegating agent not specified", ErrInvalidConfig)
+	}
+
+	to := delegation.To
+	if to == "" {
+		var err error
+		if to, err = m.agentForRole(delegation.Role, hop.AgentID); err != nil {
+			return types.TaskStatus{}, err
+		}
+	}
+
+	// 子任务的委托链 = 父任务的委托链 + 本次委托
+	var chain []types.DelegationHop
+	if taskI, ok := m.taskDefs.Load(hop.TaskID); ok {
+		chain = append(chain, taskI.(types.Task).Delegation...)
+	}
+	chain = append(chain, hop)
+
+	// 链上的Agent都在等待子任务，占用着自己的工作协程，委托回链上的Agent可能永远无法执行
+	for _, h := range chain {
+		if h.AgentID == to {
+			return types.TaskStatus{}, fmt.Errorf("%w: agent %s is already in the delegation chain", ErrDelegationCycle, to)
+		}
+	}
+	if len(chain) > maxDelegationDepth {
+		return types.TaskStatus{}, fmt.Errorf("%w: %d hops", ErrDelegationTooDeep, len(chain))
+	}
+
+	task := delegation.Task
+	if task.ID == "" {
+		task.ID = uuid.New().String()
+	}
+	task.Delegation = chain
+
+	if err := m.AssignTask(ctx, to, task); err != nil {
+		return types.TaskStatus{}, err
+	}
+
+	m.emitEvent(hop.AgentID, Event{
+		ID:     uuid.New().String(),
+		TaskID: hop.TaskID,
+		Type:   "task_delegated",
+		Data: map[string]interface{}{
+			"to":         to,
+			"subtask_id": task.ID,
+			"task_type":  task.Type,
+			"depth":      len(chain),
+		},
+		Timestamp: time.Now(),
+	})
+
+	status, err := m.WaitTask(ctx, task.ID)
+	if err != nil {
+		// 委托方不再等待时取消子任务
+		m.CancelTask(context.Background(), task.ID)
+		return status, err
+	}
+	if status.Status != "completed" {
+		// 保留子任务的错误，委托方可以用errors.Is判断失败原因
+		if status.Error != nil {
+			return status, fmt.Errorf("%w: delegated task %s %s: %w", ErrTaskFailed, task.ID, status.Status, status.Error)
+		}
+		return status, fmt.Errorf("%w: delegated task %s %s", ErrTaskFailed, task.ID, status.Status)
+	}
+	return status, nil
+}
+
+// agentForRole 选择具有指定角色且排队和执行中任务最少的Agent，不会选择exclude
+func (m *manager) agentForRole(role, exclude string) (string, error) {
+	if role == "" {
+		return "", fmt.Errorf("%w: neither recipient nor role specified", ErrInvalidConfig)
+	}
+
+	var candidates []*baseAgent
+	m.agents.Range(func(key, value interface{}) bool {
+		agent := value.(*baseAgent)
+		if agent.config.Role == role && agent.id != exclude {
+			candidates = append(candidates, agent)
+		}
+		return true
+	})
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNoAgentForRole, role)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		li, lj := candidates[i].runtime.load(), candidates[j].runtime.load()
+		if li != lj {
+			return li < lj
+		}
+		return candidates[i].id < candidates[j].id
+	})
+	return candidates[0].id, nil
+}
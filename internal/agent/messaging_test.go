@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// createRoleAgent 创建一个具有指定角色并注册了给定处理器的Agent
+func createRoleAgent(t *testing.T, mgr Manager, role string, handlers map[string]HandlerFunc) string {
+	t.Helper()
+
+	ctx := context.Background()
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:  role,
+		Role:  role,
+		Model: ModelConfig{Type: "fake-model"},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+
+	for taskType, fn := range handlers {
+		if err := mgr.RegisterTaskHandler(ctx, agentID, taskType, NewTaskHandler(nil, fn)); err != nil {
+			t.Fatalf("注册处理器失败: %v", err)
+		}
+	}
+	return agentID
+}
+
+func TestAgentMessaging(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mgr := newTestManager(t, newFakeProvider())
+	author := createRoleAgent(t, mgr, "author", nil)
+	reviewer := createRoleAgent(t, mgr, "reviewer", nil)
+
+	// 审阅者收到请求后回复
+	go func() {
+		request, err := mgr.ReceiveMessage(ctx, reviewer)
+		if err != nil {
+			return
+		}
+		mgr.ReplyMessage(ctx, request, "review", fmt.Sprintf("LGTM: %v", request.Payload))
+	}()
+
+	reply, err := mgr.RequestMessage(ctx, Message{From: author, Role: "reviewer", Type: "review_request", Payload: "draft"})
+	if err != nil {
+		t.Fatalf("请求消息失败: %v", err)
+	}
+	if reply.From != reviewer || reply.Type != "review" || reply.Payload != "LGTM: draft" {
+		t.Errorf("回复消息不正确: %+v", reply)
+	}
+
+	// 普通消息进入接收方信箱
+	if _, err := mgr.SendMessage(ctx, Message{From: reviewer, To: author, Type: "note", Payload: "thanks"}); err != nil {
+		t.Fatalf("发送消息失败: %v", err)
+	}
+	if msg, err := mgr.ReceiveMessage(ctx, author); err != nil || msg.Payload != "thanks" {
+		t.Errorf("期望收到消息thanks，实际为 %+v，错误 %v", msg, err)
+	}
+
+	if _, err := mgr.SendMessage(ctx, Message{From: author, Role: "translator"}); !errors.Is(err, ErrNoAgentForRole) {
+		t.Errorf("期望没有对应角色的错误，实际得到 %v", err)
+	}
+}
+
+func TestDelegationChain(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+
+	chains := make(chan []types.DelegationHop, 1)
+	writer := createRoleAgent(t, mgr, "writer", map[string]HandlerFunc{
+		"write": func(ctx context.Context, task types.Task) (types.Result, error) {
+			status, _ := mgr.GetTaskStatus(ctx, task.ID)
+			chains <- status.Delegation
+			return types.Result{Data: fmt.Sprintf("article about %v", task.Parameters["topic"])}, nil
+		},
+	})
+	researcher := createRoleAgent(t, mgr, "researcher", map[string]HandlerFunc{
+		"research": func(ctx context.Context, task types.Task) (types.Result, error) {
+			status, err := mgr.DelegateTask(ctx, Delegation{
+				Role: "writer",
+				Task: types.Task{ID: "write-1", Type: "write", Parameters: task.Parameters},
+			})
+			if err != nil {
+				return types.Result{}, err
+			}
+			return status.Result.(types.Result), nil
+		},
+	})
+	planner := createRoleAgent(t, mgr, "planner", map[string]HandlerFunc{
+		"plan": func(ctx context.Context, task types.Task) (types.Result, error) {
+			status, err := mgr.DelegateTask(ctx, Delegation{
+				To:   researcher,
+				Task: types.Task{ID: "research-1", Type: "research", Parameters: map[string]interface{}{"topic": "go"}},
+			})
+			if err != nil {
+				return types.Result{}, err
+			}
+			return status.Result.(types.Result), nil
+		},
+	})
+
+	if err := mgr.AssignTask(ctx, planner, types.Task{ID: "plan-1", Type: "plan"}); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	status, err := mgr.WaitTask(ctx, "plan-1")
+	if err != nil || status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际状态 %s，错误 %v", status.Status, status.Error)
+	}
+	if data := status.Result.(types.Result).Data; data != "article about go" {
+		t.Errorf("委托结果未返回给委托方: %v", data)
+	}
+
+	// 委托链记录了谁在执行哪个任务时发起了委托
+	want := []types.DelegationHop{{AgentID: planner, TaskID: "plan-1"}, {AgentID: researcher, TaskID: "research-1"}}
+	if got := <-chains; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("期望委托链 %v，实际为 %v", want, got)
+	}
+	if status, _ := mgr.GetTaskStatus(ctx, "write-1"); len(status.Delegation) != 2 {
+		t.Errorf("任务状态中缺少委托链: %+v", status.Delegation)
+	}
+
+	if _, err := mgr.DelegateTask(ctx, Delegation{From: writer, To: writer, Task: types.Task{Type: "write"}}); !errors.Is(err, ErrDelegationCycle) {
+		t.Errorf("期望拒绝委托给自己，实际得到 %v", err)
+	}
+}
+
+func TestDelegationCycle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mgr := newTestManager(t, newFakeProvider())
+	var alice string
+	delegate := func(to *string, taskType string) HandlerFunc {
+		return func(ctx context.Context, task types.Task) (types.Result, error) {
+			status, err := mgr.DelegateTask(ctx, Delegation{To: *to, Task: types.Task{Type: taskType}})
+			if err != nil {
+				return types.Result{}, err
+			}
+			return status.Result.(types.Result), nil
+		}
+	}
+	bob := createRoleAgent(t, mgr, "reviewer", map[string]HandlerFunc{"review": delegate(&alice, "write")})
+	alice = createRoleAgent(t, mgr, "writer", map[string]HandlerFunc{
+		"write":  func(ctx context.Context, task types.Task) (types.Result, error) { return types.Result{}, nil },
+		"submit": delegate(&bob, "review"),
+	})
+
+	// A→B→A 的委托会让两个Agent互相等待，必须被拒绝而不是死锁
+	if err := mgr.AssignTask(ctx, alice, types.Task{ID: "submit-1", Type: "submit"}); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	status, err := mgr.WaitTask(ctx, "submit-1")
+	if err != nil {
+		t.Fatalf("等待任务失败（可能死锁）: %v", err)
+	}
+	if status.Status != "failed" || !errors.Is(status.Error, ErrDelegationCycle) {
+		t.Errorf("期望循环委托失败，实际状态 %s，错误 %v", status.Status, status.Error)
+	}
+}
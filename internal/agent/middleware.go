@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// HookStage 标识中间件拦截的执行阶段
+type HookStage string
+
+// 预定义执行阶段
+const (
+	StageTask  HookStage = "task"  // 任务处理器执行
+	StageModel HookStage = "model" // 模型调用
+	StageTool  HookStage = "tool"  // 工具调用
+	StageChunk HookStage = "chunk" // 任务增量输出的发布
+)
+
+// Middleware 在任务执行、模型调用和工具调用前后拦截运行时，未设置的钩子被跳过。
+// Before钩子按注册顺序执行，可以修改输入；After钩子在成功后按相反顺序执行，可以修改输出。
+// 任一钩子返回错误时中止当前阶段，错误包装为ErrAborted返回。
+// 全局中间件先于Agent的中间件执行
+type Middleware struct {
+	Name string // 中间件名称，在同一注册表中唯一
+
+	BeforeTask func(ctx context.Context, task *types.Task) error
+	AfterTask  func(ctx context.Context, task types.Task, result *types.Result) error
+
+	BeforeModel func(ctx context.Context, request *types.ChatRequest) error
+	AfterModel  func(ctx context.Context, request types.ChatRequest, response *types.ChatResponse) error
+
+	// 工具调用的参数可以原地修改，钩子之后才校验参数和请求审批
+	BeforeTool func(ctx context.Context, toolID string, params map[string]interface{}) error
+	AfterTool  func(ctx context.Context, toolID string, params map[string]interface{}, result *interface{}) error
+
+	// OnChunk 在发布任务的增量输出前调用，可以修改分片，返回错误时丢弃该分片。
+	// 有中间件设置了AfterModel时，模型输出先缓存，AfterModel通过后才按修改后的回复发布
+	OnChunk func(ctx context.Context, chunk *TaskChunk) error
+
+	// OnError 在任一阶段失败（包括被中间件中止）时调用，仅用于观察，不改变返回的错误
+	OnError func(ctx context.Context, stage HookStage, err error)
+}
+
+// MiddlewareChain 是按注册顺序排列的中间件
+type MiddlewareChain struct {
+	mu          sync.RWMutex
+	middlewares []Middleware
+}
+
+// NewMiddlewareChain 创建一个空的中间件链
+func NewMiddlewareChain() *MiddlewareChain {
+	return &MiddlewareChain{}
+}
+
+// Use 在链尾添加中间件，同名中间件只能注册一次
+func (c *MiddlewareChain) Use(mw Middleware) error {
+	if mw.Name == "" {
+		return ErrInvalidConfig
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, existing := range c.middlewares {
+		if existing.Name == mw.Name {
+			return fmt.Errorf("%w: %s", ErrMiddlewareExists, mw.Name)
+		}
+	}
+	c.middlewares = append(c.middlewares, mw)
+	return nil
+}
+
+// Remove 移除指定名称的中间件
+func (c *MiddlewareChain) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, mw := range c.middlewares {
+		if mw.Name == name {
+			c.middlewares = append(c.middlewares[:i:i], c.middlewares[i+1:]...)
+			return
+		}
+	}
+}
+
+// Names 按执行顺序返回已注册的中间件名称
+func (c *MiddlewareChain) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.middlewares))
+	for _, mw := range c.middlewares {
+		names = append(names, mw.Name)
+	}
+	return names
+}
+
+// list 返回中间件的副本，调用钩子时不持有锁
+func (c *MiddlewareChain) list() []Middleware {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Middleware(nil), c.middlewares...)
+}
+
+// globalMiddleware 是对所有Agent生效的中间件
+var globalMiddleware = NewMiddlewareChain()
+
+// RegisterMiddleware 注册对所有Agent生效的中间件
+func RegisterMiddleware(mw Middleware) error {
+	return globalMiddleware.Use(mw)
+}
+
+// UnregisterMiddleware 注销对所有Agent生效的中间件
+func UnregisterMiddleware(name string) {
+	globalMiddleware.Remove(name)
+}
+
+// Use 注册仅对当前Agent生效的中间件，在全局中间件之后执行
+func (r *Runtime) Use(mw Middleware) error {
+	return r.middleware.Use(mw)
+}
+
+// middlewares 返回当前生效的中间件，全局中间件在前
+func (r *Runtime) middlewares() []Middleware {
+	return append(globalMiddleware.list(), r.middleware.list()...)
+}
+
+// runBefore 按顺序执行Before钩子，call在中间件未设置对应钩子时返回nil
+func (r *Runtime) runBefore(ctx context.Context, stage HookStage, mws []Middleware, call func(Middleware) error) error {
+	for _, mw := range mws {
+		if err := call(mw); err != nil {
+			return r.abort(ctx, stage, mw.Name, err)
+		}
+	}
+	return nil
+}
+
+// runAfter 按相反顺序执行After钩子
+func (r *Runtime) runAfter(ctx context.Context, stage HookStage, mws []Middleware, call func(Middleware) error) error {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if err := call(mws[i]); err != nil {
+			return r.abort(ctx, stage, mws[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// abort 记录中间件中止事件并包装错误
+func (r *Runtime) abort(ctx context.Context, stage HookStage, name string, err error) error {
+	r.recordEvent(ctx, "middleware_aborted", map[string]interface{}{
+		"stage":      string(stage),
+		"middleware": name,
+		"error":      err.Error(),
+	})
+	return fmt.Errorf("%w %s: %w", ErrAborted, name, err)
+}
+
+// notifyError 将阶段失败通知给所有中间件
+func notifyError(ctx context.Context, stage HookStage, mws []Middleware, err error) {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i].OnError != nil {
+			mws[i].OnError(ctx, stage, err)
+		}
+	}
+}
+
+// interceptTask 在中间件的拦截下执行任务处理器
+func (r *Runtime) interceptTask(ctx context.Context, task types.Task) (types.Result, error) {
+	mws := r.middlewares()
+	if len(mws) == 0 {
+		return r.executeTask(ctx, task)
+	}
+
+	// 复制参数，钩子的修改不影响管理器保存的任务定义
+	params := make(map[string]interface{}, len(task.Parameters))
+	for k, v := range task.Parameters {
+		params[k] = v
+	}
+	task.Parameters = params
+
+	err := r.runBefore(ctx, StageTask, mws, func(mw Middleware) error {
+		if mw.BeforeTask == nil {
+			return nil
+		}
+		return mw.BeforeTask(ctx, &task)
+	})
+
+	var result types.Result
+	if err == nil {
+		result, err = r.executeTask(ctx, task)
+	}
+	if err == nil {
+		err = r.runAfter(ctx, StageTask, mws, func(mw Middleware) error {
+			if mw.AfterTask == nil {
+				return nil
+			}
+			return mw.AfterTask(ctx, task, &result)
+		})
+	}
+	if err != nil {
+		notifyError(ctx, StageTask, mws, err)
+		return types.Result{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,346 @@
+package agent
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// queuedTask 是等待执行的任务及其提交时的上下文
+type queuedTask struct {
+	task   types.Task
+	ctx    context.Context
+	future *TaskFuture
+	seq    uint64 // 入队序号，排序相同时先入队的任务先执行
+}
+
+// TaskFuture 用于获取异步执行任务的结果
+type TaskFuture struct {
+	taskID string
+	done   chan struct{}
+	once   sync.Once
+	result types.Result
+	err    error
+}
+
+// newTaskFuture 创建一个新的任务结果
+func newTaskFuture(taskID string) *TaskFuture {
+	return &TaskFuture{
+		taskID: taskID,
+		done:   make(chan struct{}),
+	}
+}
+
+// TaskID 返回任务ID
+func (f *TaskFuture) TaskID() string {
+	return f.taskID
+}
+
+// Done 返回任务结束时关闭的通道
+func (f *TaskFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result 返回任务结果，任务尚未结束时阻塞
+func (f *TaskFuture) Result() (types.Result, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// Wait 等待任务结束或ctx结束
+func (f *TaskFuture) Wait(ctx context.Context) (types.Result, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return types.Result{}, ctx.Err()
+	}
+}
+
+// resolve 设置任务结果，只有第一次调用生效
+func (f *TaskFuture) resolve(result types.Result, err error) {
+	f.once.Do(func() {
+		f.result = result
+		f.err = err
+		close(f.done)
+	})
+}
+
+// TaskOrdering 决定任务的出队顺序，a应先于b执行时返回true
+type TaskOrdering func(a, b types.Task) bool
+
+// 内置的任务排序方式
+const (
+	OrderingPriority = "priority" // 按优先级从高到低，同优先级按截止时间从早到晚
+	OrderingFIFO     = "fifo"     // 按入队顺序
+)
+
+var (
+	orderingsMu sync.RWMutex
+	orderings   = map[string]TaskOrdering{
+		OrderingPriority: PriorityOrdering,
+		OrderingFIFO:     FIFOOrdering,
+	}
+)
+
+// RegisterTaskOrdering 注册自定义的任务排序方式，可在QueueConfig.Ordering中按名称使用
+func RegisterTaskOrdering(name string, ordering TaskOrdering) {
+	orderingsMu.Lock()
+	defer orderingsMu.Unlock()
+	orderings[name] = ordering
+}
+
+// lookupTaskOrdering 按名称查找任务排序方式，名称为空时使用优先级排序
+func lookupTaskOrdering(name string) (TaskOrdering, bool) {
+	if name == "" {
+		name = OrderingPriority
+	}
+
+	orderingsMu.RLock()
+	defer orderingsMu.RUnlock()
+	ordering, ok := orderings[name]
+	return ordering, ok
+}
+
+// PriorityOrdering 优先级高的任务先执行，同优先级时截止时间早的任务先执行，
+// 有截止时间的任务先于没有截止时间的任务
+func PriorityOrdering(a, b types.Task) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Deadline.IsZero() || b.Deadline.IsZero() {
+		return !a.Deadline.IsZero() && b.Deadline.IsZero()
+	}
+	return a.Deadline.Before(b.Deadline)
+}
+
+// FIFOOrdering 按入队顺序执行任务
+func FIFOOrdering(a, b types.Task) bool {
+	return false
+}
+
+// taskQueue 是运行时的任务队列，按排序方式出队，支持按ID移除尚未开始的任务
+type taskQueue struct {
+	mu       sync.Mutex
+	items    taskHeap
+	seq      uint64
+	capacity int           // 队列容量，必须大于0
+	block    bool          // 队列已满时阻塞等待而不是拒绝
+	ready    chan struct{} // 队列中有任务时发出信号
+	notFull  chan struct{} // 队列有空位时发出信号
+	closed   chan struct{} // 队列关闭后不再接收新任务
+	paused   bool          // 暂停时仍接收任务但不再出队
+}
+
+// newTaskQueue 创建一个新的任务队列
+func newTaskQueue(capacity int, block bool, ordering TaskOrdering) *taskQueue {
+	return &taskQueue{
+		items:    taskHeap{less: ordering},
+		capacity: capacity,
+		block:    block,
+		ready:    make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+}
+
+// push 将任务加入队列。队列已满时按配置返回ErrQueueFull，
+// 或阻塞直到有空位、ctx结束或队列关闭
+func (q *taskQueue) push(ctx context.Context, item queuedTask) error {
+	for {
+		q.mu.Lock()
+		if q.isClosed() {
+			q.mu.Unlock()
+			return ErrRuntimeStopped
+		}
+		if q.items.Len() < q.capacity {
+			q.seq++
+			item.seq = q.seq
+			heap.Push(&q.items, item)
+			q.signal()
+			// 还有空位时继续唤醒其他等待的提交者
+			if q.items.Len() < q.capacity {
+				q.signalNotFull()
+			}
+			q.mu.Unlock()
+			return nil
+		}
+		q.mu.Unlock()
+
+		if !q.block {
+			return ErrQueueFull
+		}
+
+		select {
+		case <-q.notFull:
+		case <-q.closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pop 取出下一个任务，队列为空或暂停时阻塞直到有任务或stopCh关闭。
+// 队列关闭后仍会返回剩余任务，全部取完或处于暂停状态时返回false
+func (q *taskQueue) pop(stopCh <-chan struct{}) (queuedTask, bool) {
+	for {
+		q.mu.Lock()
+		if !q.paused && q.items.Len() > 0 {
+			item := heap.Pop(&q.items).(queuedTask)
+			// 还有剩余任务时继续唤醒其他工作协程
+			if q.items.Len() > 0 {
+				q.signal()
+			}
+			q.signalNotFull()
+			q.mu.Unlock()
+			return item, true
+		}
+		closed := q.isClosed()
+		q.mu.Unlock()
+
+		if closed {
+			return queuedTask{}, false
+		}
+
+		select {
+		case <-q.ready:
+		case <-q.closed:
+		case <-stopCh:
+			return queuedTask{}, false
+		}
+	}
+}
+
+// requeue 将被中断的任务放回队列，保留原入队序号以维持原有顺序，不受容量限制
+func (q *taskQueue) requeue(item queuedTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	heap.Push(&q.items, item)
+	q.signal()
+}
+
+// setPaused 暂停或恢复出队
+func (q *taskQueue) setPaused(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.paused = paused
+	if !paused && q.items.Len() > 0 {
+		q.signal()
+	}
+}
+
+// isPaused 判断队列是否处于暂停状态
+func (q *taskQueue) isPaused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// close 关闭队列，不再接收新任务
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.isClosed() {
+		close(q.closed)
+	}
+}
+
+// drain 按出队顺序移除并返回队列中的所有任务
+func (q *taskQueue) drain() []queuedTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]queuedTask, 0, q.items.Len())
+	for q.items.Len() > 0 {
+		items = append(items, heap.Pop(&q.items).(queuedTask))
+	}
+	q.signalNotFull()
+	return items
+}
+
+// isClosed 判断队列是否已关闭
+func (q *taskQueue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// remove 从队列中移除指定任务
+func (q *taskQueue) remove(taskID string) (queuedTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.items.items {
+		if item.task.ID == taskID {
+			heap.Remove(&q.items, i)
+			q.signalNotFull()
+			return item, true
+		}
+	}
+
+	return queuedTask{}, false
+}
+
+// len 返回队列中的任务数量
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// signal 非阻塞地发出有任务的信号，调用方需持有锁
+func (q *taskQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// signalNotFull 非阻塞地发出有空位的信号，调用方需持有锁
+func (q *taskQueue) signalNotFull() {
+	select {
+	case q.notFull <- struct{}{}:
+	default:
+	}
+}
+
+// taskHeap 按排序方式和入队序号组织任务的堆，实现heap.Interface
+type taskHeap struct {
+	items []queuedTask
+	less  TaskOrdering
+}
+
+func (h taskHeap) Len() int { return len(h.items) }
+
+func (h taskHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less != nil {
+		if h.less(a.task, b.task) {
+			return true
+		}
+		if h.less(b.task, a.task) {
+			return false
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (h taskHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *taskHeap) Push(x interface{}) { h.items = append(h.items, x.(queuedTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = queuedTask{}
+	h.items = h.items[:n-1]
+	return item
+}
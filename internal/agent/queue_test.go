@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+func TestTaskQueueOrdering(t *testing.T) {
+	now := time.Now()
+	q := newTaskQueue(defaultQueueCapacity, false, PriorityOrdering)
+
+	tasks := []types.Task{
+		{ID: "batch-1"},
+		{ID: "batch-2"},
+		{ID: "late", Priority: 1, Deadline: now.Add(time.Hour)},
+		{ID: "interactive", Priority: 1},
+		{ID: "urgent", Priority: 1, Deadline: now.Add(time.Minute)},
+	}
+	for _, task := range tasks {
+		if err := q.push(context.Background(), queuedTask{task: task}); err != nil {
+			t.Fatalf("任务入队失败: %v", err)
+		}
+	}
+
+	want := []string{"urgent", "late", "interactive", "batch-1", "batch-2"}
+	for _, id := range want {
+		item, ok := q.pop(nil)
+		if !ok || item.task.ID != id {
+			t.Fatalf("期望出队 %s，实际得到 %s", id, item.task.ID)
+		}
+	}
+}
+
+func TestTaskQueueBackpressure(t *testing.T) {
+	ctx := context.Background()
+
+	reject := newTaskQueue(1, false, FIFOOrdering)
+	reject.push(ctx, queuedTask{task: types.Task{ID: "task-1"}})
+	if err := reject.push(ctx, queuedTask{task: types.Task{ID: "task-2"}}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("期望队列已满错误，实际得到 %v", err)
+	}
+
+	block := newTaskQueue(1, true, FIFOOrdering)
+	block.push(ctx, queuedTask{task: types.Task{ID: "task-1"}})
+
+	// 阻塞的提交者应在ctx结束时返回
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := block.push(timeoutCtx, queuedTask{task: types.Task{ID: "task-2"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望等待超时，实际得到 %v", err)
+	}
+
+	// 出队后阻塞的提交者应继续入队
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- block.push(ctx, queuedTask{task: types.Task{ID: "task-3"}})
+	}()
+	block.pop(nil)
+
+	select {
+	case err := <-pushed:
+		if err != nil {
+			t.Errorf("阻塞的提交者入队失败: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("出队后提交者仍被阻塞")
+	}
+}
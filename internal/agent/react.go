@@ -0,0 +1,369 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+const (
+	defaultMaxSteps   = 5
+	finalAnswerMarker = "Final Answer:"
+)
+
+// ReasoningStep 记录推理循环中的一步
+type ReasoningStep struct {
+	Step        int                    `json:"step"`
+	Thought     string                 `json:"thought,omitempty"`
+	Action      string                 `json:"action,omitempty"`
+	ActionInput map[string]interface{} `json:"action_input,omitempty"`
+	Observation string                 `json:"observation,omitempty"`
+}
+
+// reactReply 是解析后的模型输出
+type reactReply struct {
+	thought     string
+	action      string
+	actionInput map[string]interface{}
+	finalAnswer string
+	isFinal     bool
+	parseErr    error
+}
+
+// runReActLoop 执行ReAct推理循环：模型选择工具、运行时执行工具并回传观察结果，直到得到最终答案
+func (r *Runtime) runReActLoop(ctx context.Context, messages []types.Message) (string, []ReasoningStep, types.Usage, error) {
+	var usage types.Usage
+	var steps []ReasoningStep
+
+	// 在系统提示中加入工具说明和输出格式要求
+	messages = append([]types.Message(nil), messages...)
+	messages[0].Content = messages[0].Content + "\n\n" + r.buildToolPrompt()
+
+	maxSteps := r.agent.config.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxSteps
+	}
+
+	for step := 1; step <= maxSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return "", steps, usage, err
+		}
+
+		// 思考和工具调用不是给用户的输出，只发布最终答案
+		response, err := r.sendChat(ctx, types.ChatRequest{Messages: messages}, tokensFinalAnswer)
+		if err != nil {
+			return "", steps, usage, err
+		}
+		addUsage(&usage, response.Usage)
+
+		content := response.Message.Content
+		reply := parseReActReply(content)
+		if reply.isFinal {
+			return reply.finalAnswer, steps, usage, nil
+		}
+
+		current := ReasoningStep{
+			Step:        step,
+			Thought:     reply.thought,
+			Action:      reply.action,
+			ActionInput: reply.actionInput,
+		}
+
+		if reply.parseErr != nil {
+			current.Observation = fmt.Sprintf("Error: %v", reply.parseErr)
+		} else {
+			r.recordEvent(ctx, "tool_call_requested", map[string]interface{}{
+				"step":    step,
+				"tool_id": reply.action,
+				"params":  reply.actionInput,
+				"thought": reply.thought,
+			})
+			current.Observation = r.observe(ctx, reply.action, reply.actionInput)
+		}
+		steps = append(steps, current)
+
+		messages = append(messages,
+			types.Message{Role: types.RoleAssistant, Content: content},
+			types.Message{Role: types.RoleUser, Content: "Observation: " + current.Observation},
+		)
+	}
+
+	return "", steps, usage, fmt.Errorf("%w: %d", ErrMaxSteps, maxSteps)
+}
+
+// runToolCallingLoop 使用模型原生的工具调用能力执行推理循环
+func (r *Runtime) runToolCallingLoop(ctx context.Context, messages []types.Message) (string, []ReasoningStep, types.Usage, error) {
+	var usage types.Usage
+	var steps []ReasoningStep
+
+	messages = append([]types.Message(nil), messages...)
+	definitions := r.toolDefinitions()
+
+	maxSteps := r.agent.config.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxSteps
+	}
+
+	for step := 1; step <= maxSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return "", steps, usage, err
+		}
+
+		response, err := r.sendChat(ctx, types.ChatRequest{
+			Messages: messages,
+			Tools:    definitions,
+		}, tokensAll)
+		if err != nil {
+			return "", steps, usage, err
+		}
+		addUsage(&usage, response.Usage)
+
+		if len(response.Message.ToolCalls) == 0 {
+			return response.Message.Content, steps, usage, nil
+		}
+
+		assistant := response.Message
+		assistant.Role = types.RoleAssistant
+		messages = append(messages, assistant)
+
+		// 依次执行模型请求的每个工具调用，并以tool角色回传结果
+		for _, call := range response.Message.ToolCalls {
+			r.recordEvent(ctx, "tool_call_requested", map[string]interface{}{
+				"step":    step,
+				"tool_id": call.Function.Name,
+				"params":  call.Function.Arguments,
+			})
+
+			observation := r.observe(ctx, call.Function.Name, call.Function.Arguments)
+			steps = append(steps, ReasoningStep{
+				Step:        step,
+				Thought:     response.Message.Content,
+				Action:      call.Function.Name,
+				ActionInput: call.Function.Arguments,
+				Observation: observation,
+			})
+
+			messages = append(messages, types.Message{
+				Role:       types.RoleTool,
+				Name:       call.Function.Name,
+				Content:    observation,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	return "", steps, usage, fmt.Errorf("%w: %d", ErrMaxSteps, maxSteps)
+}
+
+// toolDefinitions 生成Agent可用工具的LLM工具定义
+func (r *Runtime) toolDefinitions() []types.ToolDefinition {
+	definitions := make([]types.ToolDefinition, 0, len(r.tools))
+	for _, t := range r.tools {
+		metadata := tool.ToolMetadata{
+			ID:          t.ID(),
+			Name:        t.Name(),
+			Description: t.Description(),
+		}
+		if mp, ok := t.(tool.MetadataProvider); ok {
+			metadata = mp.Metadata()
+		}
+		definitions = append(definitions, tool.ToToolDefinition(metadata))
+	}
+	return definitions
+}
+
+// observe 执行工具并把结果转换为可回传给模型的观察文本
+func (r *Runtime) observe(ctx context.Context, toolID string, params map[string]interface{}) string {
+	if t := r.findTool(toolID); t != nil {
+		if mp, ok := t.(tool.MetadataProvider); ok {
+			params = coerceParams(mp.Metadata().Parameters, params)
+		}
+	}
+
+	observation := formatObservation(r.callTool(ctx, toolID, params))
+	r.publishChunk(ctx, TaskChunk{Kind: ChunkObservation, ToolID: toolID, Content: observation})
+	return observation
+}
+
+// formatObservation 把工具调用的结果或错误转换为观察文本
+func formatObservation(result interface{}, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+
+	switch v := result.(type) {
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
+
+// findTool 按ID查找Agent可用的工具
+func (r *Runtime) findTool(toolID string) tool.Tool {
+	for _, t := range r.tools {
+		if t.ID() == toolID {
+			return t
+		}
+	}
+	return nil
+}
+
+// buildToolPrompt 构建工具描述和ReAct输出格式说明
+func (r *Runtime) buildToolPrompt() string {
+	var sb strings.Builder
+
+	sb.WriteString("You can use the following tools:\n")
+	for _, t := range r.tools {
+		sb.WriteString(fmt.Sprintf("\n- %s: %s", t.ID(), t.Description()))
+
+		mp, ok := t.(tool.MetadataProvider)
+		if !ok {
+			continue
+		}
+		for _, p := range mp.Metadata().Parameters {
+			required := "optional"
+			if p.Required {
+				required = "required"
+			}
+			sb.WriteString(fmt.Sprintf("\n    - %s (%s, %s): %s", p.Name, p.Type, required, p.Description))
+		}
+	}
+
+	sb.WriteString("\n\nTo use a tool, reply exactly in this format:\n")
+	sb.WriteString("Thought: <your reasoning>\n")
+	sb.WriteString("Action: <tool id>\n")
+	sb.WriteString("Action Input: <tool parameters as a JSON object>\n")
+	sb.WriteString("\nYou will then receive an Observation with the tool result.\n")
+	sb.WriteString("When you know the answer, reply in this format:\n")
+	sb.WriteString("Thought: <your reasoning>\n")
+	sb.WriteString("Final Answer: <the answer to the user>")
+
+	return sb.String()
+}
+
+// parseReActReply 解析模型的ReAct格式输出
+func parseReActReply(content string) reactReply {
+	var reply reactReply
+
+	if idx := strings.Index(content, finalAnswerMarker); idx >= 0 {
+		reply.thought = extractField(content[:idx], "Thought:")
+		reply.finalAnswer = strings.TrimSpace(content[idx+len(finalAnswerMarker):])
+		reply.isFinal = true
+		return reply
+	}
+
+	actionIdx := strings.Index(content, "Action:")
+	if actionIdx < 0 {
+		// 模型没有按格式输出时，把整个回复视为最终答案
+		reply.finalAnswer = strings.TrimSpace(content)
+		reply.isFinal = true
+		return reply
+	}
+
+	reply.thought = extractField(content[:actionIdx], "Thought:")
+
+	rest := content[actionIdx+len("Action:"):]
+	inputIdx := strings.Index(rest, "Action Input:")
+	if inputIdx < 0 {
+		reply.action = strings.TrimSpace(firstLine(rest))
+		reply.parseErr = fmt.Errorf("missing Action Input for action %q", reply.action)
+		return reply
+	}
+
+	reply.action = strings.TrimSpace(rest[:inputIdx])
+	rawInput := strings.TrimSpace(rest[inputIdx+len("Action Input:"):])
+	rawInput = strings.TrimPrefix(rawInput, "```json")
+	rawInput = strings.TrimPrefix(rawInput, "```")
+	rawInput = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rawInput), "```"))
+
+	if rawInput == "" {
+		reply.actionInput = map[string]interface{}{}
+		return reply
+	}
+	if err := json.Unmarshal([]byte(rawInput), &reply.actionInput); err != nil {
+		reply.parseErr = fmt.Errorf("action input is not a valid JSON object: %v", err)
+	}
+
+	return reply
+}
+
+// extractField 提取以指定前缀开头的字段内容
+func extractField(content, prefix string) string {
+	idx := strings.Index(content, prefix)
+	if idx < 0 {
+		return strings.TrimSpace(content)
+	}
+	return strings.TrimSpace(content[idx+len(prefix):])
+}
+
+// firstLine 返回文本的第一行
+func firstLine(content string) string {
+	content = strings.TrimSpace(content)
+	if idx := strings.IndexByte(content, '\n'); idx >= 0 {
+		return content[:idx]
+	}
+	return content
+}
+
+// coerceParams 按参数规格转换JSON解码后的参数类型
+func coerceParams(specs []tool.ParameterSpec, params map[string]interface{}) map[string]interface{} {
+	if len(specs) == 0 || params == nil {
+		return params
+	}
+
+	coerced := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		coerced[k] = v
+	}
+
+	for _, spec := range specs {
+		value, ok := coerced[spec.Name]
+		if !ok {
+			continue
+		}
+
+		switch spec.Type {
+		case "integer", "int":
+			// JSON数字默认解码为float64
+			if f, ok := value.(float64); ok {
+				coerced[spec.Name] = int(f)
+			}
+		case "array":
+			// 元素全为字符串的数组转换为[]string
+			items, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			strs := make([]string, 0, len(items))
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					strs = nil
+					break
+				}
+				strs = append(strs, s)
+			}
+			if strs != nil {
+				coerced[spec.Name] = strs
+			}
+		}
+	}
+
+	return coerced
+}
+
+// addUsage 累加token使用量
+func addUsage(total *types.Usage, usage types.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+}
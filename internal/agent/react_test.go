@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// fakeTool 是一个记录调用参数的测试工具
+type fakeTool struct {
+	id     string
+	calls  []map[string]interface{}
+	result interface{}
+}
+
+func (t *fakeTool) ID() string          { return t.id }
+func (t *fakeTool) Name() string        { return t.id }
+func (t *fakeTool) Description() string { return "Repeats a word several times" }
+func (t *fakeTool) Version() string     { return "1.0.0" }
+
+func (t *fakeTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	t.calls = append(t.calls, params)
+	if t.result != nil {
+		return t.result, nil
+	}
+	word, _ := params["word"].(string)
+	times, _ := params["times"].(int)
+	return strings.Repeat(word, times), nil
+}
+
+func (t *fakeTool) Validate(params map[string]interface{}) error {
+	if _, ok := params["word"].(string); !ok {
+		return fmt.Errorf("word is required")
+	}
+	return nil
+}
+
+func (t *fakeTool) Metadata() tool.ToolMetadata {
+	return tool.ToolMetadata{
+		ID: t.id,
+		Parameters: []tool.ParameterSpec{
+			{Name: "word", Type: "string", Required: true},
+			{Name: "times", Type: "integer"},
+		},
+	}
+}
+
+func TestReActLoop(t *testing.T) {
+	provider := newFakeProvider(
+		"Thought: I should repeat the word.\nAction: repeat\nAction Input: {\"word\": \"go\", \"times\": 3}",
+		"Thought: I have the result.\nFinal Answer: gogogo",
+	)
+	repeat := &fakeTool{id: "repeat"}
+	runtime := newTestRuntime(t, provider, []tool.Tool{repeat}, nil)
+
+	task := types.Task{
+		ID:         "task-1",
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": "Repeat go three times"},
+	}
+
+	result, err := runtime.handleConversation(context.Background(), task)
+	if err != nil {
+		t.Fatalf("对话任务失败: %v", err)
+	}
+
+	data := result.Data.(map[string]interface{})
+	if data["response"] != "gogogo" {
+		t.Errorf("期望最终答案为 gogogo，实际得到 %v", data["response"])
+	}
+
+	steps := data["steps"].([]ReasoningStep)
+	if len(steps) != 1 || steps[0].Action != "repeat" || steps[0].Observation != "gogogo" {
+		t.Errorf("推理步骤不正确: %+v", steps)
+	}
+
+	// JSON数字应按参数规格转换为整数
+	if len(repeat.calls) != 1 || repeat.calls[0]["times"] != 3 {
+		t.Errorf("工具调用参数不正确: %+v", repeat.calls)
+	}
+
+	// 第二次请求应包含观察结果
+	request := provider.lastRequest()
+	last := request.Messages[len(request.Messages)-1]
+	if last.Content != "Observation: gogogo" {
+		t.Errorf("期望最后一条消息为观察结果，实际得到 %q", last.Content)
+	}
+	if !strings.Contains(request.Messages[0].Content, "times (integer, optional)") {
+		t.Errorf("系统提示未包含工具参数说明: %q", request.Messages[0].Content)
+	}
+}
+
+func TestReActLoopStepLimit(t *testing.T) {
+	action := "Action: repeat\nAction Input: {\"word\": \"go\"}"
+	provider := newFakeProvider(action, action, action)
+	runtime := newTestRuntime(t, provider, []tool.Tool{&fakeTool{id: "repeat"}}, nil)
+	runtime.agent.config.MaxSteps = 2
+
+	_, steps, _, err := runtime.runReActLoop(context.Background(), []types.Message{{Role: "system"}, {Role: "user", Content: "loop"}})
+	if !errors.Is(err, ErrMaxSteps) {
+		t.Fatalf("期望步数超限错误，实际得到 %v", err)
+	}
+	if len(steps) != 2 {
+		t.Errorf("期望执行2步，实际执行 %d 步", len(steps))
+	}
+}
+
+func TestToolCallingLoop(t *testing.T) {
+	provider := newFakeProvider("gogo")
+	provider.replies = append([]types.Message{{
+		Role: types.RoleAssistant,
+		ToolCalls: []types.ToolCall{{
+			ID: "call_0",
+			Function: types.ToolCallFunction{
+				Name:      "repeat",
+				Arguments: map[string]interface{}{"word": "go", "times": float64(2)},
+			},
+		}},
+	}}, provider.replies...)
+
+	repeat := &fakeTool{id: "repeat"}
+	runtime := newTestRuntime(t, provider, []tool.Tool{repeat}, nil)
+	runtime.agent.config.Model.NativeTools = true
+
+	result, err := runtime.handleConversation(context.Background(), types.Task{
+		ID:         "task-1",
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": "Repeat go twice"},
+	})
+	if err != nil {
+		t.Fatalf("对话任务失败: %v", err)
+	}
+
+	if data := result.Data.(map[string]interface{}); data["response"] != "gogo" {
+		t.Errorf("期望最终答案为 gogo，实际得到 %v", data["response"])
+	}
+
+	request := provider.lastRequest()
+	if len(request.Tools) != 1 || request.Tools[0].Function.Name != "repeat" {
+		t.Fatalf("请求未包含工具定义: %+v", request.Tools)
+	}
+	if request.Tools[0].Function.Parameters.Properties["times"].Type != "integer" {
+		t.Errorf("工具参数类型不正确: %+v", request.Tools[0].Function.Parameters)
+	}
+
+	last := request.Messages[len(request.Messages)-1]
+	if last.Role != types.RoleTool || last.Content != "gogo" || last.ToolCallID != "call_0" {
+		t.Errorf("工具结果消息不正确: %+v", last)
+	}
+}
+
+func TestParseReActReply(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		final   bool
+		action  string
+		wantErr bool
+	}{
+		{name: "最终答案", content: "Thought: done\nFinal Answer: 42", final: true},
+		{name: "工具调用", content: "Thought: search\nAction: search\nAction Input: {\"q\": \"go\"}", action: "search"},
+		{name: "代码块参数", content: "Action: search\nAction Input: ```json\n{\"q\": \"go\"}\n```", action: "search"},
+		{name: "无效参数", content: "Action: search\nAction Input: not json", action: "search", wantErr: true},
+		{name: "无格式输出", content: "Just an answer", final: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reply := parseReActReply(tc.content)
+			if reply.isFinal != tc.final {
+				t.Errorf("isFinal = %v，期望 %v", reply.isFinal, tc.final)
+			}
+			if reply.action != tc.action {
+				t.Errorf("action = %q，期望 %q", reply.action, tc.action)
+			}
+			if (reply.parseErr != nil) != tc.wantErr {
+				t.Errorf("parseErr = %v，期望出错: %v", reply.parseErr, tc.wantErr)
+			}
+		})
+	}
+}
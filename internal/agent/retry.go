@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultMultiplier     = 2.0
+)
+
+// defaultRetryableErrors 是未配置可重试错误时默认重试的错误
+var defaultRetryableErrors = []error{
+	types.ErrRateLimited,
+	types.ErrRequestTimeout,
+	types.ErrLLMNotAvailable,
+}
+
+// retryPolicyFor 返回任务使用的重试策略，任务自身的策略优先于Agent配置
+func retryPolicyFor(config AgentConfig, task types.Task) types.RetryPolicy {
+	if task.Retry != nil {
+		return *task.Retry
+	}
+	return config.Retry
+}
+
+// shouldRetry 判断第attempt次执行失败后是否还应重试
+func shouldRetry(policy types.RetryPolicy, attempt int, err error) bool {
+	if err == nil || attempt >= policy.MaxAttempts {
+		return false
+	}
+
+	retryable := policy.RetryableErrors
+	if len(retryable) == 0 {
+		retryable = defaultRetryableErrors
+	}
+	for _, target := range retryable {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff 计算第attempt次执行失败后的等待时间，按指数增长并加入随机抖动
+func retryBackoff(policy types.RetryPolicy, attempt int) time.Duration {
+	initial := policy.InitialBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	backoff := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if backoff > float64(maxBackoff) {
+		backoff = float64(maxBackoff)
+	}
+
+	if jitter := math.Min(policy.Jitter, 1); jitter > 0 {
+		backoff *= 1 + jitter*(2*rand.Float64()-1)
+	}
+
+	return time.Duration(backoff)
+}
@@ -2,140 +2,383 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/llm"
 	"github.com/hewenyu/Aegis/internal/tool"
 	"github.com/hewenyu/Aegis/internal/types"
 )
 
+const defaultQueueCapacity = 10
+
 // Runtime 提供Agent的运行时环境
 type Runtime struct {
 	agent         *baseAgent
 	tools         []tool.Tool
 	memory        types.Store
 	knowledge     types.Context
+	llm           llm.Service
 	context       map[string]interface{}
-	executionMu   sync.Mutex
+	contextMu     sync.Mutex
 	stopCh        chan struct{}
-	taskQueue     chan types.Task
+	taskQueue     *taskQueue
 	maxConcurrent int
+	running       map[string]*runningTask // 正在执行的任务
+	handlers      *HandlerRegistry        // 仅对当前Agent生效的任务处理器
+	builtins      *HandlerRegistry        // 内置任务处理器
+	runningMu     sync.Mutex
+	workers       sync.WaitGroup
+	stopOnce      sync.Once
+	abandoned     []types.Task // 停止时未能完成的任务
+	stopErr       error
+	events        *EventBus // 为空时不发布事件
+	meter         *usageMeter
+	pricing       *types.ModelInfo // 首次成功获取的模型定价，获取失败时下次调用模型再试
+	pricingMu     sync.Mutex
+	onUsage       func(taskID string, usage types.ResourceStats) // 每次模型调用后通知任务用量，可为空
+	approvals     *approvalRegistry
+	onApproval    func(taskID string, waiting bool) // 任务开始或结束等待审批时通知，可为空
+	middleware    *MiddlewareChain                  // 仅对当前Agent生效的中间件
+	onChunk       func(chunk TaskChunk)             // 任务发布增量输出时通知，可为空
+}
+
+// runningTask 是正在执行的任务及其取消函数
+type runningTask struct {
+	item         queuedTask
+	cancel       context.CancelFunc
+	abandoned    bool // 停止超时被中断
+	checkpointed bool // 暂停时被中断，恢复后重新执行
 }
 
-// NewRuntime 创建新的Agent运行时
-func NewRuntime(agent *baseAgent, tools []tool.Tool, memory types.Store, knowledge types.Context) *Runtime {
-	return &Runtime{
+// errTaskCheckpointed 表示任务因暂停被中断并已放回队列
+var errTaskCheckpointed = errors.New("task checkpointed")
+
+// NewRuntime 创建新的Agent运行时，任务队列按Agent的QueueConfig配置
+func NewRuntime(agent *baseAgent, tools []tool.Tool, memory types.Store, knowledge types.Context, llmService llm.Service) *Runtime {
+	config := agent.config.Queue
+
+	capacity := config.Capacity
+	if capacity <= 0 {
+		capacity = defaultQueueCapacity
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1 // 默认单任务执行
+	}
+	ordering, ok := lookupTaskOrdering(config.Ordering)
+	if !ok {
+		ordering = PriorityOrdering
+	}
+
+	r := &Runtime{
 		agent:         agent,
 		tools:         tools,
 		memory:        memory,
 		knowledge:     knowledge,
+		llm:           llmService,
 		context:       make(map[string]interface{}),
 		stopCh:        make(chan struct{}),
-		taskQueue:     make(chan types.Task, 10), // 任务队列缓冲区大小可配置
-		maxConcurrent: 1,                         // 默认单任务执行
-	}
+		taskQueue:     newTaskQueue(capacity, config.BlockWhenFull, ordering),
+		maxConcurrent: concurrency,
+		running:       make(map[string]*runningTask),
+		handlers:      NewHandlerRegistry(),
+		meter:         newUsageMeter(agent.config.Budget),
+		approvals:     newApprovalRegistry(),
+		middleware:    NewMiddlewareChain(),
+	}
+	r.builtins = newBuiltinHandlers(r)
+	return r
 }
 
 // Start 启动运行时
 func (r *Runtime) Start(ctx context.Context) error {
 	// 启动任务处理循环
 	for i := 0; i < r.maxConcurrent; i++ {
+		r.workers.Add(1)
 		go r.taskWorker(ctx)
 	}
 	return nil
 }
 
-// Stop 停止运行时
+// Stop 停止运行时，等待任务完成直到ctx结束，可重复调用
 func (r *Runtime) Stop(ctx context.Context) error {
-	close(r.stopCh)
-	// TODO: 等待所有任务完成或超时
-	return nil
+	_, err := r.Shutdown(ctx)
+	return err
 }
 
-// EnqueueTask 将任务加入队列
-func (r *Runtime) EnqueueTask(task types.Task) error {
+// Shutdown 以排空模式停止运行时：不再接收新任务，继续执行队列中的任务，
+// 直到全部完成或ctx结束。ctx结束时中断剩余任务并返回这些被放弃的任务。
+// 重复调用返回第一次调用的结果
+func (r *Runtime) Shutdown(ctx context.Context) ([]types.Task, error) {
+	r.stopOnce.Do(func() {
+		r.abandoned, r.stopErr = r.drain(ctx)
+	})
+	return r.abandoned, r.stopErr
+}
+
+// drain 关闭任务队列并等待工作协程退出
+func (r *Runtime) drain(ctx context.Context) ([]types.Task, error) {
+	r.taskQueue.close()
+	r.recordEvent(ctx, "runtime_draining", map[string]interface{}{
+		"queued": r.taskQueue.len(),
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(drained)
+	}()
+
+	var err error
 	select {
-	case r.taskQueue <- task:
-		return nil
-	default:
-		return fmt.Errorf("task queue is full")
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// 放弃暂停期间或等待超时后仍留在队列中的任务，并中断正在执行的任务。
+	// 持有runningMu保证被暂停中断的任务要么仍在执行中，要么已放回队列
+	var abandoned []types.Task
+	r.runningMu.Lock()
+	for _, item := range r.taskQueue.drain() {
+		item.future.resolve(types.Result{}, ErrTaskAbandoned)
+		abandoned = append(abandoned, item.task)
+	}
+	for _, rt := range r.running {
+		rt.abandoned = true
+		rt.cancel()
+		abandoned = append(abandoned, rt.item.task)
 	}
+	r.runningMu.Unlock()
+
+	close(r.stopCh)
+
+	r.recordEvent(ctx, "runtime_stopped", map[string]interface{}{
+		"abandoned": len(abandoned),
+	})
+
+	return abandoned, err
+}
+
+// Pause 暂停运行时，队列仍接收新任务但不再出队。
+// checkpoint为true时中断正在执行的任务并放回队列，恢复后按原顺序重新执行；
+// 否则正在执行的任务继续运行至结束。返回被中断的任务ID
+func (r *Runtime) Pause(checkpoint bool) []string {
+	r.taskQueue.setPaused(true)
+
+	var checkpointed []string
+	if checkpoint {
+		r.runningMu.Lock()
+		for id, rt := range r.running {
+			rt.checkpointed = true
+			rt.cancel()
+			checkpointed = append(checkpointed, id)
+		}
+		r.runningMu.Unlock()
+	}
+
+	r.recordEvent(context.Background(), "runtime_paused", map[string]interface{}{
+		"checkpointed": checkpointed,
+	})
+
+	return checkpointed
+}
+
+// Resume 恢复运行时，按队列顺序继续执行任务
+func (r *Runtime) Resume() {
+	r.taskQueue.setPaused(false)
+	r.recordEvent(context.Background(), "runtime_resumed", map[string]interface{}{
+		"queued": r.taskQueue.len(),
+	})
+}
+
+// load 返回排队和正在执行的任务数
+func (r *Runtime) load() int {
+	r.runningMu.Lock()
+	defer r.runningMu.Unlock()
+	return r.taskQueue.len() + len(r.running)
+}
+
+// Paused 判断运行时是否处于暂停状态
+func (r *Runtime) Paused() bool {
+	return r.taskQueue.isPaused()
+}
+
+// EnqueueTask 将任务加入队列，ctx会传递给任务执行过程，取消ctx即取消任务。
+// 队列已满且配置为阻塞时，等待空位直到ctx结束。
+// 返回的TaskFuture在任务结束后提供执行结果
+func (r *Runtime) EnqueueTask(ctx context.Context, task types.Task) (*TaskFuture, error) {
+	return r.enqueue(ctx, ctx, task)
+}
+
+// enqueue 将任务加入队列，队列已满时的等待由ctx控制，taskCtx传递给任务执行过程
+func (r *Runtime) enqueue(ctx, taskCtx context.Context, task types.Task) (*TaskFuture, error) {
+	future := newTaskFuture(task.ID)
+	if err := r.taskQueue.push(ctx, queuedTask{task: task, ctx: taskCtx, future: future}); err != nil {
+		return nil, err
+	}
+	return future, nil
+}
+
+// CancelTask 取消排队中或正在执行的任务，任务不在运行时中时返回false
+func (r *Runtime) CancelTask(taskID string) bool {
+	// 尚未开始的任务直接从队列中移除
+	if item, ok := r.taskQueue.remove(taskID); ok {
+		item.future.resolve(types.Result{}, context.Canceled)
+		return true
+	}
+
+	r.runningMu.Lock()
+	rt, ok := r.running[taskID]
+	r.runningMu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	rt.cancel()
+	return true
 }
 
 // taskWorker 是处理任务的工作协程
 func (r *Runtime) taskWorker(ctx context.Context) {
+	defer r.workers.Done()
+
 	for {
-		select {
-		case <-r.stopCh:
+		item, ok := r.taskQueue.pop(r.stopCh)
+		if !ok {
 			return
-		case task := <-r.taskQueue:
-			r.processTask(ctx, task)
 		}
+		result, err := r.processTask(item)
+		if errors.Is(err, errTaskCheckpointed) {
+			continue
+		}
+		item.future.resolve(result, err)
 	}
 }
 
-// processTask 处理单个任务
-func (r *Runtime) processTask(ctx context.Context, task types.Task) {
+// processTask 处理单个任务并返回执行结果
+func (r *Runtime) processTask(item queuedTask) (types.Result, error) {
+	task := item.task
+
 	// 建立任务执行上下文
-	taskCtx := r.createTaskContext(ctx, task)
+	taskCtx, cancel := r.createTaskContext(item.ctx, task)
+	defer cancel()
+
+	// 登记取消函数，使任务在执行过程中可以被取消
+	rt := &runningTask{item: item, cancel: cancel}
+	r.runningMu.Lock()
+	r.running[task.ID] = rt
+	r.runningMu.Unlock()
+
+	defer r.unregisterTask(rt)
+
+	// 排队期间已被取消的任务不再执行
+	if taskCtx.Err() != nil {
+		return types.Result{}, taskCtx.Err()
+	}
 
 	// 记录任务开始
-	r.recordEvent(taskCtx, "task_started", task.ID)
+	r.meter.begin(task)
+	r.agent.markTaskStarted(task.ID)
+	defer r.agent.markTaskFinished(task.ID)
+	r.recordEvent(taskCtx, "task_started", map[string]interface{}{
+		"task_id": task.ID,
+	})
 
 	// 执行任务
-	result, err := r.executeTask(taskCtx, task)
-
-	// 记录任务结束
+	result, err := r.interceptTask(taskCtx, task)
+
+	// 停止超时被中断的任务由Shutdown统一报告，因暂停被中断的任务放回队列。
+	// 在同一把锁内完成登记移除和重新入队，保证Shutdown不会遗漏任务
+	r.runningMu.Lock()
+	r.unregisterTaskLocked(rt)
+	abandoned := rt.abandoned
+	requeue := !abandoned && rt.checkpointed && err != nil
+	if requeue {
+		r.taskQueue.requeue(item)
+	}
+	r.runningMu.Unlock()
+
+	// 记录本次执行结束。任务状态的变化（完成、失败、重试等）由管理器另行发布
+	state := "completed"
+	switch {
+	case abandoned:
+		state, err = "abandoned", ErrTaskAbandoned
+	case requeue:
+		state, err = "checkpointed", errTaskCheckpointed
+	case err != nil && errors.Is(taskCtx.Err(), context.Canceled):
+		state = "cancelled"
+	case err != nil:
+		state = "failed"
+	}
+	data := map[string]interface{}{
+		"task_id": task.ID,
+		"state":   state,
+	}
 	if err != nil {
-		r.recordEvent(taskCtx, "task_failed", map[string]interface{}{
-			"task_id": task.ID,
-			"error":   err.Error(),
-		})
-	} else {
-		r.recordEvent(taskCtx, "task_completed", map[string]interface{}{
-			"task_id": task.ID,
-			"result":  result,
-		})
+		data["error"] = err.Error()
+	}
+	r.recordEvent(taskCtx, "task_finished", data)
+
+	if abandoned || requeue {
+		return types.Result{}, err
 	}
+	return result, err
 }
 
-// createTaskContext 创建任务执行上下文
-func (r *Runtime) createTaskContext(ctx context.Context, task types.Task) context.Context {
+// unregisterTask 移除正在执行的任务登记
+func (r *Runtime) unregisterTask(rt *runningTask) {
+	r.runningMu.Lock()
+	defer r.runningMu.Unlock()
+	r.unregisterTaskLocked(rt)
+}
+
+// unregisterTaskLocked 移除正在执行的任务登记，调用方需持有runningMu。
+// 任务重新入队后可能已被再次登记，此时保留新的登记
+func (r *Runtime) unregisterTaskLocked(rt *runningTask) {
+	if r.running[rt.item.task.ID] == rt {
+		delete(r.running, rt.item.task.ID)
+	}
+}
+
+// createTaskContext 创建可取消的任务执行上下文
+func (r *Runtime) createTaskContext(ctx context.Context, task types.Task) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	// 添加任务相关信息到上下文
 	taskCtx := context.WithValue(ctx, "task_id", task.ID)
 	taskCtx = context.WithValue(taskCtx, "agent_id", r.agent.id)
+	taskCtx = context.WithValue(taskCtx, runtimeKey{}, r)
 
 	// 设置超时
 	if !task.Deadline.IsZero() {
-		var cancel context.CancelFunc
-		taskCtx, cancel = context.WithDeadline(taskCtx, task.Deadline)
-		go func() {
-			<-taskCtx.Done()
-			cancel()
-		}()
+		return context.WithDeadline(taskCtx, task.Deadline)
 	}
 
-	return taskCtx
+	return context.WithCancel(taskCtx)
 }
 
 // executeTask 执行具体任务
 func (r *Runtime) executeTask(ctx context.Context, task types.Task) (types.Result, error) {
-	r.executionMu.Lock()
-	defer r.executionMu.Unlock()
-
-	// 任务类型路由
-	switch task.Type {
-	case "conversation":
-		return r.handleConversation(ctx, task)
-	case "research":
-		return r.handleResearch(ctx, task)
-	case "analysis":
-		return r.handleAnalysis(ctx, task)
-	default:
-		return types.Result{}, fmt.Errorf("unknown task type: %s", task.Type)
+	// 按任务类型查找处理器
+	handler, ok := r.lookupHandler(task.Type)
+	if !ok {
+		return types.Result{}, fmt.Errorf("%w: %s", ErrUnknownTaskType, task.Type)
+	}
+
+	// 执行前校验任务参数
+	if err := tool.ValidateParams(handler.Parameters(), task.Parameters); err != nil {
+		return types.Result{}, fmt.Errorf("invalid task %s: %w", task.ID, err)
 	}
+
+	return handler.Handle(ctx, task)
 }
 
 // 不同类型任务的处理函数
@@ -148,21 +391,61 @@ func (r *Runtime) handleConversation(ctx context.Context, task types.Task) (type
 		return types.Result{}, fmt.Errorf("missing required parameter: input")
 	}
 
-	// TODO: 实现对话处理逻辑
-	// 1. 获取对话历史
-	// 2. 调用LLM生成回复
-	// 3. 更新对话历史
+	conversationID, _ := task.Parameters["conversation_id"].(string)
+	if conversationID == "" {
+		conversationID = defaultConversationID
+	}
 
-	// 示例响应
-	response := fmt.Sprintf("This is a response to: %s", input)
+	// 获取对话历史
+	history, err := r.loadConversationHistory(ctx, conversationID, conversationHistoryLimit)
+	if err != nil {
+		return types.Result{}, fmt.Errorf("failed to load conversation history: %w", err)
+	}
+
+	// 检索相关知识
+	knowledge := r.lookupKnowledge(ctx, input, conversationKnowledgeLimit)
+
+	// 调用LLM生成回复，Agent配置了工具时进入推理循环
+	messages := r.buildConversationMessages(history, knowledge, input)
+
+	var answer string
+	var steps []ReasoningStep
+	var usage types.Usage
+	switch {
+	case len(r.tools) > 0 && r.agent.config.Model.NativeTools:
+		answer, steps, usage, err = r.runToolCallingLoop(ctx, messages)
+	case len(r.tools) > 0:
+		answer, steps, usage, err = r.runReActLoop(ctx, messages)
+	default:
+		var response types.ChatResponse
+		response, err = r.chat(ctx, messages)
+		answer, usage = response.Message.Content, response.Usage
+	}
+	if err != nil {
+		return types.Result{}, fmt.Errorf("failed to generate response: %w", err)
+	}
+
+	// 更新对话历史
+	r.saveConversationTurn(ctx, conversationID, input, answer)
+
+	data := map[string]interface{}{
+		"response":        answer,
+		"conversation_id": conversationID,
+	}
+	if len(steps) > 0 {
+		data["steps"] = steps
+	}
 
 	return types.Result{
-		Data: map[string]interface{}{
-			"response": response,
-		},
+		Data: data,
 		Metadata: map[string]interface{}{
-			"tokens_used": 100, // 假设值
-			"model":       "gpt-4",
+			"tokens_used":       usage.TotalTokens,
+			"prompt_tokens":     usage.PromptTokens,
+			"completion_tokens": usage.CompletionTokens,
+			"model":             r.agent.config.Model.Type,
+			"history_turns":     len(history),
+			"knowledge_used":    len(knowledge),
+			"tool_steps":        len(steps),
 		},
 		Timestamp: time.Now(),
 	}, nil
@@ -171,7 +454,7 @@ func (r *Runtime) handleConversation(ctx context.Context, task types.Task) (type
 // handleResearch 处理研究类型任务
 func (r *Runtime) handleResearch(ctx context.Context, task types.Task) (types.Result, error) {
 	// 从任务参数中获取必要信息
-	topics, ok := task.Parameters["topics"].([]string)
+	topics, ok := stringSlice(task.Parameters["topics"])
 	if !ok {
 		return types.Result{}, fmt.Errorf("missing required parameter: topics")
 	}
@@ -227,28 +510,68 @@ func (r *Runtime) handleAnalysis(ctx context.Context, task types.Task) (types.Re
 	}, nil
 }
 
+// stringSlice 将参数转换为字符串切片，兼容JSON解码得到的[]interface{}
+func stringSlice(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			strs = append(strs, s)
+		}
+		return strs, true
+	default:
+		return nil, false
+	}
+}
+
 // 工具调用和辅助函数
 
 // callTool 调用指定工具
 func (r *Runtime) callTool(ctx context.Context, toolID string, params map[string]interface{}) (interface{}, error) {
 	// 查找工具
-	var tool tool.Tool
-	for _, t := range r.tools {
-		if t.ID() == toolID {
-			tool = t
-			break
-		}
-	}
-
+	tool := r.findTool(toolID)
 	if tool == nil {
 		return nil, fmt.Errorf("tool not found: %s", toolID)
 	}
 
+	// 中间件可以在校验和审批前修改参数
+	mws := r.middlewares()
+	err := r.runBefore(ctx, StageTool, mws, func(mw Middleware) error {
+		if mw.BeforeTool == nil {
+			return nil
+		}
+		return mw.BeforeTool(ctx, toolID, params)
+	})
+	if err != nil {
+		notifyError(ctx, StageTool, mws, err)
+		return nil, err
+	}
+
 	// 验证参数
 	if err := tool.Validate(params); err != nil {
 		return nil, fmt.Errorf("invalid parameters: %w", err)
 	}
 
+	// 任务已被取消时不再调用工具
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 敏感工具在得到审批后才执行，审批时参数可能被修改
+	if r.requiresApproval(tool) {
+		approved, err := r.awaitApproval(ctx, tool, params)
+		if err != nil {
+			return nil, err
+		}
+		params = approved
+	}
+
 	// 记录工具调用事件
 	r.recordEvent(ctx, "tool_call_started", map[string]interface{}{
 		"tool_id": toolID,
@@ -267,6 +590,18 @@ func (r *Runtime) callTool(ctx context.Context, toolID string, params map[string
 			"duration": duration.Milliseconds(),
 			"error":    err.Error(),
 		})
+		notifyError(ctx, StageTool, mws, err)
+		return nil, err
+	}
+
+	err = r.runAfter(ctx, StageTool, mws, func(mw Middleware) error {
+		if mw.AfterTool == nil {
+			return nil
+		}
+		return mw.AfterTool(ctx, toolID, params, &result)
+	})
+	if err != nil {
+		notifyError(ctx, StageTool, mws, err)
 		return nil, err
 	}
 
@@ -302,15 +637,20 @@ func (r *Runtime) callTool(ctx context.Context, toolID string, params map[string
 	return result, nil
 }
 
-// recordEvent 记录事件
+// recordEvent 将运行时事件发布到事件总线
 func (r *Runtime) recordEvent(ctx context.Context, eventType string, data interface{}) {
-	event := NewEvent(uuid.New().String(), eventType, data)
+	if r.events == nil {
+		return
+	}
 
-	// TODO: 将事件记录到事件流
-	// 临时打印事件，避免未使用变量错误
-	if r.agent != nil && r.agent.id != "" {
-		fmt.Printf("Agent %s event: %s - %v\n", r.agent.id, event.Type, event.Timestamp)
+	event := NewEvent(uuid.New().String(), eventType, data)
+	if r.agent != nil {
+		event.AgentID = r.agent.id
+	}
+	if taskID, ok := ctx.Value("task_id").(string); ok {
+		event.TaskID = taskID
 	}
+	r.events.emit(*event)
 }
 
 // recordMemory 记录到记忆
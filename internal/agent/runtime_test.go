@@ -0,0 +1,366 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/memory"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// fakeProvider 是一个按脚本返回响应的LLM提供者
+type fakeProvider struct {
+	mu       sync.Mutex
+	replies  []types.Message
+	requests []types.ChatRequest
+}
+
+// newFakeProvider 创建按顺序返回给定文本的提供者
+func newFakeProvider(responses ...string) *fakeProvider {
+	p := &fakeProvider{}
+	for _, content := range responses {
+		p.replies = append(p.replies, types.Message{Role: types.RoleAssistant, Content: content})
+	}
+	return p
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]types.ModelInfo, error) {
+	return []types.ModelInfo{{Name: "fake-model"}}, nil
+}
+
+func (p *fakeProvider) GetModel(ctx context.Context, modelID string) (types.ModelInfo, error) {
+	return types.ModelInfo{Name: modelID, PricingPerInputToken: 0.001, PricingPerOutputToken: 0.002}, nil
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, modelID string, request types.CompletionRequest) (types.CompletionResponse, error) {
+	return types.CompletionResponse{}, fmt.Errorf("not implemented")
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, modelID string, request types.ChatRequest) (types.ChatResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, request)
+	if len(p.replies) == 0 {
+		return types.ChatResponse{}, fmt.Errorf("no scripted response left")
+	}
+
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+
+	return types.ChatResponse{
+		Message: reply,
+		Usage:   types.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+func (p *fakeProvider) Embed(ctx context.Context, modelID string, request types.EmbeddingRequest) (types.EmbeddingResponse, error) {
+	return types.EmbeddingResponse{}, fmt.Errorf("not implemented")
+}
+
+func (p *fakeProvider) GetEmbedModel() string { return "" }
+
+// history 返回已收到的所有聊天请求
+func (p *fakeProvider) history() []types.ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]types.ChatRequest(nil), p.requests...)
+}
+
+// lastRequest 返回最近一次聊天请求
+func (p *fakeProvider) lastRequest() types.ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests[len(p.requests)-1]
+}
+
+// fakeKnowledge 是一个返回固定知识的知识上下文
+type fakeKnowledge struct {
+	items []types.Knowledge
+}
+
+func (k *fakeKnowledge) Query(ctx context.Context, q types.Query) ([]types.Knowledge, error) {
+	return k.items, nil
+}
+
+func (k *fakeKnowledge) SemanticSearch(ctx context.Context, text string, limit int) ([]types.Knowledge, error) {
+	return k.items, nil
+}
+
+func (k *fakeKnowledge) AddKnowledge(ctx context.Context, item types.Knowledge) error {
+	k.items = append(k.items, item)
+	return nil
+}
+
+func (k *fakeKnowledge) GetRelevantKnowledge(ctx context.Context, text string, limit int) ([]types.Knowledge, error) {
+	return k.items, nil
+}
+
+// newTestRuntime 创建一个使用脚本化提供者的运行时
+func newTestRuntime(t *testing.T, provider *fakeProvider, tools []tool.Tool, kc types.Context) *Runtime {
+	t.Helper()
+
+	service := llm.NewService()
+	if err := service.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+
+	agent := &baseAgent{
+		id: "agent-1",
+		config: AgentConfig{
+			ID:   "agent-1",
+			Name: "TestAgent",
+			Model: ModelConfig{
+				Type:         "fake-model",
+				Temperature:  0.2,
+				MaxTokens:    256,
+				SystemPrompt: "You are a test agent.",
+			},
+		},
+	}
+
+	store := memory.NewInMemoryStore("test-store", 100)
+	runtime := NewRuntime(agent, tools, store, kc, service)
+	agent.runtime = runtime
+	return runtime
+}
+
+func TestHandleConversation(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeProvider("Hello, Alice.", "Your name is Alice.")
+	kc := &fakeKnowledge{items: []types.Knowledge{{ID: "k1", Content: "Alice likes Go."}}}
+	runtime := newTestRuntime(t, provider, nil, kc)
+
+	task := types.Task{
+		ID:         "task-1",
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": "Hi, I am Alice.", "conversation_id": "c1"},
+	}
+
+	result, err := runtime.handleConversation(ctx, task)
+	if err != nil {
+		t.Fatalf("对话任务失败: %v", err)
+	}
+
+	data := result.Data.(map[string]interface{})
+	if data["response"] != "Hello, Alice." {
+		t.Errorf("期望响应为 %q，实际得到 %q", "Hello, Alice.", data["response"])
+	}
+	if result.Metadata["tokens_used"] != 15 || result.Metadata["model"] != "fake-model" {
+		t.Errorf("元数据不正确: %v", result.Metadata)
+	}
+
+	request := provider.lastRequest()
+	if request.Temperature != 0.2 || request.MaxTokens != 256 {
+		t.Errorf("请求未使用模型配置: %+v", request)
+	}
+	system := request.Messages[0]
+	if system.Role != "system" || !strings.Contains(system.Content, "Alice likes Go.") {
+		t.Errorf("系统提示未注入知识: %q", system.Content)
+	}
+
+	// 第二轮对话应带上历史
+	task.Parameters["input"] = "What is my name?"
+	if _, err := runtime.handleConversation(ctx, task); err != nil {
+		t.Fatalf("第二轮对话失败: %v", err)
+	}
+
+	request = provider.lastRequest()
+	if len(request.Messages) != 4 {
+		t.Fatalf("期望4条消息（系统、历史两条、输入），实际得到 %d", len(request.Messages))
+	}
+	if request.Messages[1].Content != "Hi, I am Alice." || request.Messages[2].Content != "Hello, Alice." {
+		t.Errorf("历史消息不正确: %+v", request.Messages[1:3])
+	}
+}
+
+func TestHandleConversationMissingInput(t *testing.T) {
+	runtime := newTestRuntime(t, newFakeProvider(), nil, nil)
+
+	_, err := runtime.handleConversation(context.Background(), types.Task{ID: "task-1", Type: "conversation"})
+	if err == nil {
+		t.Error("缺少input参数时期望得到错误，但没有")
+	}
+}
+
+// blockingProvider 的聊天调用会一直阻塞到上下文结束
+type blockingProvider struct {
+	fakeProvider
+	started chan string
+}
+
+func (p *blockingProvider) Chat(ctx context.Context, modelID string, request types.ChatRequest) (types.ChatResponse, error) {
+	p.started <- request.Messages[len(request.Messages)-1].Content
+	<-ctx.Done()
+	return types.ChatResponse{}, ctx.Err()
+}
+
+// waitFor 轮询等待条件成立
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待条件超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRuntimeCancelTask(t *testing.T) {
+	ctx := context.Background()
+	provider := &blockingProvider{started: make(chan string, 2)}
+	runtime := newTestRuntime(t, &provider.fakeProvider, nil, nil)
+	runtime.llm = llm.NewService()
+	if err := runtime.llm.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+
+	if err := runtime.Start(ctx); err != nil {
+		t.Fatalf("启动运行时失败: %v", err)
+	}
+	defer runtime.Stop(ctx)
+
+	running := types.Task{ID: "running", Type: "conversation", Parameters: map[string]interface{}{"input": "first"}}
+	queued := types.Task{ID: "queued", Type: "conversation", Parameters: map[string]interface{}{"input": "second"}}
+	if _, err := runtime.EnqueueTask(ctx, running); err != nil {
+		t.Fatalf("任务入队失败: %v", err)
+	}
+	queuedFuture, err := runtime.EnqueueTask(ctx, queued)
+	if err != nil {
+		t.Fatalf("任务入队失败: %v", err)
+	}
+
+	// 等待第一个任务进入模型调用
+	if input := <-provider.started; input != "first" {
+		t.Fatalf("期望先执行first，实际执行 %s", input)
+	}
+
+	// 排队中的任务应直接从队列移除
+	if !runtime.CancelTask("queued") {
+		t.Error("取消排队中的任务失败")
+	}
+	if runtime.taskQueue.len() != 0 {
+		t.Errorf("期望队列为空，实际剩余 %d 个任务", runtime.taskQueue.len())
+	}
+	if _, err := queuedFuture.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("期望排队任务的结果为取消错误，实际得到 %v", err)
+	}
+
+	// 正在执行的任务应通过上下文中断
+	if !runtime.CancelTask("running") {
+		t.Error("取消正在执行的任务失败")
+	}
+	waitFor(t, func() bool {
+		runtime.runningMu.Lock()
+		defer runtime.runningMu.Unlock()
+		return len(runtime.running) == 0
+	})
+
+	if runtime.CancelTask("unknown") {
+		t.Error("取消不存在的任务时期望返回false")
+	}
+
+	select {
+	case input := <-provider.started:
+		t.Errorf("已取消的任务不应被执行: %s", input)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRuntimeShutdownDrain(t *testing.T) {
+	ctx := context.Background()
+	runtime := newTestRuntime(t, newFakeProvider("one", "two"), nil, nil)
+	if err := runtime.Start(ctx); err != nil {
+		t.Fatalf("启动运行时失败: %v", err)
+	}
+
+	var futures []*TaskFuture
+	for _, id := range []string{"task-1", "task-2"} {
+		future, err := runtime.EnqueueTask(ctx, types.Task{ID: id, Type: "conversation", Parameters: map[string]interface{}{"input": id}})
+		if err != nil {
+			t.Fatalf("任务入队失败: %v", err)
+		}
+		futures = append(futures, future)
+	}
+
+	// 排空模式下队列中的任务应全部执行完毕
+	abandoned, err := runtime.Shutdown(ctx)
+	if err != nil || len(abandoned) != 0 {
+		t.Fatalf("期望任务全部完成，实际放弃 %d 个任务，错误 %v", len(abandoned), err)
+	}
+	for _, future := range futures {
+		if _, err := future.Result(); err != nil {
+			t.Errorf("任务 %s 执行失败: %v", future.TaskID(), err)
+		}
+	}
+
+	if _, err := runtime.EnqueueTask(ctx, types.Task{ID: "late", Type: "conversation"}); !errors.Is(err, ErrRuntimeStopped) {
+		t.Errorf("停止后入队期望得到 ErrRuntimeStopped，实际得到 %v", err)
+	}
+
+	// 重复停止不应panic
+	if err := runtime.Stop(ctx); err != nil {
+		t.Errorf("重复停止失败: %v", err)
+	}
+}
+
+func TestRuntimePauseCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	provider := &blockingProvider{started: make(chan string, 4)}
+	runtime := newTestRuntime(t, &provider.fakeProvider, nil, nil)
+	runtime.llm = llm.NewService()
+	if err := runtime.llm.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+
+	if err := runtime.Start(ctx); err != nil {
+		t.Fatalf("启动运行时失败: %v", err)
+	}
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		runtime.Stop(stopCtx)
+	}()
+
+	first := types.Task{ID: "first", Type: "conversation", Parameters: map[string]interface{}{"input": "first"}}
+	if _, err := runtime.EnqueueTask(ctx, first); err != nil {
+		t.Fatalf("任务入队失败: %v", err)
+	}
+	<-provider.started
+
+	// 暂停时中断正在执行的任务并放回队列
+	if checkpointed := runtime.Pause(true); len(checkpointed) != 1 || checkpointed[0] != "first" {
+		t.Fatalf("期望中断任务first，实际得到 %v", checkpointed)
+	}
+	waitFor(t, func() bool { return runtime.taskQueue.len() == 1 })
+
+	// 暂停期间仍可入队，但不会执行
+	second := types.Task{ID: "second", Type: "conversation", Parameters: map[string]interface{}{"input": "second"}}
+	if _, err := runtime.EnqueueTask(ctx, second); err != nil {
+		t.Fatalf("暂停期间入队失败: %v", err)
+	}
+	select {
+	case input := <-provider.started:
+		t.Fatalf("暂停期间不应执行任务: %s", input)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 恢复后按原顺序执行
+	runtime.Resume()
+	if input := <-provider.started; input != "first" {
+		t.Errorf("期望恢复后先执行first，实际执行 %s", input)
+	}
+	if runtime.taskQueue.len() != 1 {
+		t.Errorf("期望队列中剩余1个任务，实际剩余 %d 个", runtime.taskQueue.len())
+	}
+}
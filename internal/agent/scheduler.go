@@ -0,0 +1,529 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// Clock 提供当前时间和定时器，便于在测试中替换
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock 是使用系统时间的时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Schedule 定义了按cron表达式或固定间隔重复分配的任务
+type Schedule struct {
+	ID        string        `json:"id"`
+	AgentID   string        `json:"agent_id"`
+	Task      types.Task    `json:"task"`               // 任务模板，每次执行生成新的任务ID
+	Cron      string        `json:"cron,omitempty"`     // cron表达式，与Interval二选一
+	Interval  time.Duration `json:"interval,omitempty"` // 执行间隔
+	StartAt   time.Time     `json:"start_at,omitempty"` // 首次执行时间，为空时按表达式或间隔计算
+	Paused    bool          `json:"paused"`
+	NextRun   time.Time     `json:"next_run"`
+	LastRun   time.Time     `json:"last_run,omitempty"`
+	Runs      int           `json:"runs"`
+	LastTask  string        `json:"last_task,omitempty"`  // 最近一次分配的任务ID
+	LastError string        `json:"last_error,omitempty"` // 最近一次分配失败的原因
+}
+
+// ScheduleStore 接口定义了计划任务的持久化存储
+type ScheduleStore interface {
+	Save(ctx context.Context, schedule Schedule) error
+	Delete(ctx context.Context, scheduleID string) error
+	List(ctx context.Context) ([]Schedule, error)
+}
+
+// Scheduler 按计划向Agent分配任务。错过的执行（例如进程停止期间）在启动后补执行一次
+type Scheduler struct {
+	manager   Manager
+	store     ScheduleStore
+	clock     Clock
+	mu        sync.Mutex
+	schedules map[string]*Schedule
+	wake      chan struct{}
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// NewScheduler 创建一个新的调度器。store为空时使用内存存储，clock为空时使用系统时钟
+func NewScheduler(manager Manager, store ScheduleStore, clock Clock) *Scheduler {
+	if store == nil {
+		store = NewMemoryScheduleStore()
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	return &Scheduler{
+		manager:   manager,
+		store:     store,
+		clock:     clock,
+		schedules: make(map[string]*Schedule),
+		wake:      make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 从存储加载计划任务并启动调度循环
+func (s *Scheduler) Start(ctx context.Context) error {
+	schedules, err := s.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	s.mu.Lock()
+	for i := range schedules {
+		schedule := schedules[i]
+		s.schedules[schedule.ID] = &schedule
+	}
+	s.mu.Unlock()
+
+	go s.loop()
+	return nil
+}
+
+// Stop 停止调度循环，可重复调用
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	<-s.done
+}
+
+// Add 添加计划任务，返回计划ID
+func (s *Scheduler) Add(ctx context.Context, schedule Schedule) (string, error) {
+	if schedule.ID == "" {
+		schedule.ID = uuid.New().String()
+	}
+	if schedule.AgentID == "" || schedule.Task.Type == "" {
+		return "", fmt.Errorf("%w: agent and task type are required", ErrInvalidSchedule)
+	}
+	if (schedule.Cron == "") == (schedule.Interval <= 0) {
+		return "", fmt.Errorf("%w: exactly one of cron or interval is required", ErrInvalidSchedule)
+	}
+
+	// 指定了首次执行时间时也要校验cron表达式，否则首次执行后无法计算下一次执行时间
+	next, err := nextRun(schedule, s.clock.Now())
+	if err != nil {
+		return "", err
+	}
+	schedule.NextRun = next
+	if !schedule.StartAt.IsZero() {
+		schedule.NextRun = schedule.StartAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[schedule.ID]; ok {
+		return "", fmt.Errorf("%w: schedule %s already exists", ErrInvalidSchedule, schedule.ID)
+	}
+	if err := s.store.Save(ctx, schedule); err != nil {
+		return "", fmt.Errorf("failed to save schedule: %w", err)
+	}
+
+	s.schedules[schedule.ID] = &schedule
+	s.signal()
+	return schedule.ID, nil
+}
+
+// Pause 暂停计划任务
+func (s *Scheduler) Pause(ctx context.Context, scheduleID string) error {
+	return s.update(ctx, scheduleID, func(schedule *Schedule) error {
+		schedule.Paused = true
+		return nil
+	})
+}
+
+// Resume 恢复计划任务，从当前时间起计算下一次执行时间
+func (s *Scheduler) Resume(ctx context.Context, scheduleID string) error {
+	return s.update(ctx, scheduleID, func(schedule *Schedule) error {
+		next, err := nextRun(*schedule, s.clock.Now())
+		if err != nil {
+			return err
+		}
+		schedule.Paused = false
+		schedule.NextRun = next
+		return nil
+	})
+}
+
+// Delete 删除计划任务
+func (s *Scheduler) Delete(ctx context.Context, scheduleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[scheduleID]; !ok {
+		return ErrScheduleNotFound
+	}
+	if err := s.store.Delete(ctx, scheduleID); err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+
+	delete(s.schedules, scheduleID)
+	s.signal()
+	return nil
+}
+
+// Get 获取计划任务
+func (s *Scheduler) Get(scheduleID string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[scheduleID]
+	if !ok {
+		return Schedule{}, ErrScheduleNotFound
+	}
+	return *schedule, nil
+}
+
+// List 按下一次执行时间返回所有计划任务
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		list = append(list, *schedule)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].NextRun.Before(list[j].NextRun)
+	})
+	return list
+}
+
+// update 在锁保护下修改并保存计划任务
+func (s *Scheduler) update(ctx context.Context, scheduleID string, fn func(schedule *Schedule) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.schedules[scheduleID]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+
+	schedule := *current
+	if err := fn(&schedule); err != nil {
+		return err
+	}
+	if err := s.store.Save(ctx, schedule); err != nil {
+		return fmt.Errorf("failed to save schedule: %w", err)
+	}
+
+	s.schedules[scheduleID] = &schedule
+	s.signal()
+	return nil
+}
+
+// loop 是调度循环，等待到最近的执行时间后分配到期的任务
+func (s *Scheduler) loop() {
+	defer close(s.done)
+
+	for {
+		s.runDue()
+
+		var timer <-chan time.Time
+		if next, ok := s.nextDue(); ok {
+			timer = s.clock.After(next.Sub(s.clock.Now()))
+		}
+
+		select {
+		case <-timer:
+		case <-s.wake:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// nextDue 返回最近的执行时间
+func (s *Scheduler) nextDue() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, schedule := range s.schedules {
+		if schedule.Paused || schedule.NextRun.IsZero() {
+			continue
+		}
+		if next.IsZero() || schedule.NextRun.Before(next) {
+			next = schedule.NextRun
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// runDue 分配所有到期的计划任务
+func (s *Scheduler) runDue() {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	var due []Schedule
+	for _, schedule := range s.schedules {
+		if !schedule.Paused && !schedule.NextRun.IsZero() && !schedule.NextRun.After(now) {
+			due = append(due, *schedule)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextRun.Before(due[j].NextRun)
+	})
+
+	ctx := context.Background()
+	for _, schedule := range due {
+		task := schedule.Task
+		prefix := task.ID
+		if prefix == "" {
+			prefix = schedule.ID
+		}
+		task.ID = fmt.Sprintf("%s-%d", prefix, schedule.Runs+1)
+
+		ok, err := s.assignDue(ctx, schedule, task)
+		if !ok {
+			continue
+		}
+
+		s.finishRun(ctx, schedule.ID, now, task.ID, err)
+	}
+}
+
+// finishRun 记录一次执行并推进下一次执行时间。无法计算下一次执行时间时暂停计划任务；
+// 保存失败时仍更新内存中的状态并记录错误，避免同一次执行被反复分配
+func (s *Scheduler) finishRun(ctx context.Context, scheduleID string, now time.Time, taskID string, assignErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.schedules[scheduleID]
+	if !ok {
+		return
+	}
+
+	schedule := *current
+	schedule.Runs++
+	schedule.LastRun = now
+	schedule.LastTask = taskID
+	schedule.LastError = ""
+	if assignErr != nil {
+		schedule.LastError = assignErr.Error()
+	}
+
+	// 只补执行一次错过的任务，下一次执行时间从当前时间起算
+	next, err := nextRun(schedule, now)
+	if err != nil {
+		schedule.Paused = true
+		schedule.LastError = fmt.Sprintf("paused: %v", err)
+	} else {
+		schedule.NextRun = next
+	}
+
+	if err := s.store.Save(ctx, schedule); err != nil {
+		schedule.LastError = fmt.Sprintf("failed to save schedule: %v", err)
+	}
+
+	s.schedules[scheduleID] = &schedule
+	s.signal()
+}
+
+// assignDue 分配到期的任务。收集到期任务之后计划任务可能已被删除、暂停或修改，
+// 分配前在锁内重新检查，并在分配完成前阻止其他修改。计划任务已变化时不分配并返回false
+func (s *Scheduler) assignDue(ctx context.Context, due Schedule, task types.Task) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.schedules[due.ID]
+	if !ok || current.Paused || !current.NextRun.Equal(due.NextRun) {
+		return false, nil
+	}
+	return true, s.manager.AssignTask(ctx, due.AgentID, task)
+}
+
+// signal 唤醒调度循环重新计算执行时间
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextRun 计算after之后的下一次执行时间
+func nextRun(schedule Schedule, after time.Time) (time.Time, error) {
+	if schedule.Interval > 0 {
+		return after.Add(schedule.Interval), nil
+	}
+
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := cron.next(after)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: cron expression %q never matches", ErrInvalidSchedule, schedule.Cron)
+	}
+	return next, nil
+}
+
+// MemoryScheduleStore 是基于内存的计划任务存储
+type MemoryScheduleStore struct {
+	mu        sync.RWMutex
+	schedules map[string]Schedule
+}
+
+// NewMemoryScheduleStore 创建一个新的内存计划任务存储
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{
+		schedules: make(map[string]Schedule),
+	}
+}
+
+// Save 保存计划任务
+func (s *MemoryScheduleStore) Save(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+// Delete 删除计划任务
+func (s *MemoryScheduleStore) Delete(ctx context.Context, scheduleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.schedules, scheduleID)
+	return nil
+}
+
+// List 返回所有计划任务
+func (s *MemoryScheduleStore) List(ctx context.Context) ([]Schedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		list = append(list, schedule)
+	}
+	return list, nil
+}
+
+// FileScheduleStore 将计划任务以JSON文件保存，每次修改整体重写文件
+type FileScheduleStore struct {
+	mu    sync.Mutex
+	path  string
+	cache *MemoryScheduleStore
+}
+
+// NewFileScheduleStore 打开或创建指定路径的计划任务存储
+func NewFileScheduleStore(path string) (*FileScheduleStore, error) {
+	s := &FileScheduleStore{
+		path:  path,
+		cache: NewMemoryScheduleStore(),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to decode schedules: %w", err)
+	}
+	for _, schedule := range schedules {
+		s.cache.schedules[schedule.ID] = schedule
+	}
+
+	return s, nil
+}
+
+// Save 保存计划任务
+func (s *FileScheduleStore) Save(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, _ := s.cache.List(ctx)
+	replaced := false
+	for i := range schedules {
+		if schedules[i].ID == schedule.ID {
+			schedules[i] = schedule
+			replaced = true
+		}
+	}
+	if !replaced {
+		schedules = append(schedules, schedule)
+	}
+
+	// 写入文件成功后才更新缓存，写入失败时缓存与文件保持一致
+	if err := s.flush(schedules); err != nil {
+		return err
+	}
+	return s.cache.Save(ctx, schedule)
+}
+
+// Delete 删除计划任务
+func (s *FileScheduleStore) Delete(ctx context.Context, scheduleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, _ := s.cache.List(ctx)
+	kept := schedules[:0]
+	for _, schedule := range schedules {
+		if schedule.ID != scheduleID {
+			kept = append(kept, schedule)
+		}
+	}
+
+	if err := s.flush(kept); err != nil {
+		return err
+	}
+	return s.cache.Delete(ctx, scheduleID)
+}
+
+// List 返回所有计划任务
+func (s *FileScheduleStore) List(ctx context.Context) ([]Schedule, error) {
+	return s.cache.List(ctx)
+}
+
+// flush 将计划任务写入文件，先写临时文件再替换以免写入中途崩溃损坏文件
+func (s *FileScheduleStore) flush(schedules []Schedule) error {
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedules: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedules: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace schedules: %w", err)
+	}
+	return nil
+}
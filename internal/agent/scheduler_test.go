@@ -0,0 +1,328 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// fakeClock 是可手动推进的时钟
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance 推进时钟并触发到期的定时器
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC) // 星期三
+
+	testCases := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "@hourly", want: time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{expr: "0 2 * * *", want: time.Date(2024, 2, 1, 2, 0, 0, 0, time.UTC)},
+		{expr: "0 9 * * 1-5", want: time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1,15 * *", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			cron, err := parseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("解析cron表达式失败: %v", err)
+			}
+			if got := cron.next(base); !got.Equal(tc.want) {
+				t.Errorf("期望下一次执行时间为 %v，实际为 %v", tc.want, got)
+			}
+		})
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("表达式 %q 期望解析失败，实际得到 %v", expr, err)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong", "pong"))
+	agentID := createTestAgent(t, mgr)
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("打开计划存储失败: %v", err)
+	}
+
+	scheduler := NewScheduler(mgr, store, clock)
+	id, err := scheduler.Add(ctx, Schedule{
+		ID:       "consolidate",
+		AgentID:  agentID,
+		Task:     types.Task{Type: "conversation", Parameters: map[string]interface{}{"input": "consolidate"}},
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("添加计划任务失败: %v", err)
+	}
+	if err := scheduler.Start(ctx); err != nil {
+		t.Fatalf("启动调度器失败: %v", err)
+	}
+	defer scheduler.Stop()
+
+	// 到达执行时间后分配任务
+	clock.Advance(time.Hour)
+	waitFor(t, func() bool {
+		_, err := mgr.GetTaskStatus(ctx, "consolidate-1")
+		return err == nil
+	})
+	if status, err := mgr.WaitTask(ctx, "consolidate-1"); err != nil || status.Status != "completed" {
+		t.Errorf("期望计划任务完成，实际状态 %s，错误 %v", status.Status, err)
+	}
+
+	waitFor(t, func() bool {
+		schedule, _ := scheduler.Get(id)
+		return schedule.Runs == 1
+	})
+	schedule, _ := scheduler.Get(id)
+	if want := clock.Now().Add(time.Hour); !schedule.NextRun.Equal(want) {
+		t.Errorf("期望下一次执行时间为 %v，实际为 %v", want, schedule.NextRun)
+	}
+
+	// 计划任务应已持久化
+	reopened, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("重新打开计划存储失败: %v", err)
+	}
+	if saved, _ := reopened.List(ctx); len(saved) != 1 || saved[0].Runs != 1 {
+		t.Errorf("持久化的计划任务不正确: %+v", saved)
+	}
+
+	// 暂停后不再分配任务，恢复后从当前时间重新计算
+	if err := scheduler.Pause(ctx, id); err != nil {
+		t.Fatalf("暂停计划任务失败: %v", err)
+	}
+	clock.Advance(3 * time.Hour)
+	if err := scheduler.Resume(ctx, id); err != nil {
+		t.Fatalf("恢复计划任务失败: %v", err)
+	}
+	schedule, _ = scheduler.Get(id)
+	if schedule.Runs != 1 || !schedule.NextRun.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("恢复后的计划任务不正确: %+v", schedule)
+	}
+
+	if err := scheduler.Delete(ctx, id); err != nil {
+		t.Fatalf("删除计划任务失败: %v", err)
+	}
+	if _, err := scheduler.Get(id); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("期望计划任务已删除，实际得到 %v", err)
+	}
+}
+
+func TestFileScheduleStoreWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("打开计划存储失败: %v", err)
+	}
+	if err := store.Save(ctx, Schedule{ID: "kept", Interval: time.Hour}); err != nil {
+		t.Fatalf("保存计划任务失败: %v", err)
+	}
+
+	// 临时文件路径被目录占用，写入失败
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := store.Save(ctx, Schedule{ID: "lost", Interval: time.Hour}); err == nil {
+		t.Fatal("期望写入失败")
+	}
+	if err := store.Delete(ctx, "kept"); err == nil {
+		t.Fatal("期望写入失败")
+	}
+
+	// 写入失败的修改不进入缓存
+	if schedules, _ := store.List(ctx); len(schedules) != 1 || schedules[0].ID != "kept" {
+		t.Errorf("缓存与文件不一致: %+v", schedules)
+	}
+}
+
+func TestSchedulerSkipsRemovedSchedule(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong"))
+	agentID := createTestAgent(t, mgr)
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	scheduler := NewScheduler(mgr, nil, clock)
+	id, err := scheduler.Add(ctx, Schedule{
+		ID:       "report",
+		AgentID:  agentID,
+		Task:     types.Task{ID: "report", Type: "conversation", Parameters: map[string]interface{}{"input": "report"}},
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("添加计划任务失败: %v", err)
+	}
+	due, _ := scheduler.Get(id)
+
+	// 收集到期任务之后计划任务被删除，不再分配
+	if err := scheduler.Delete(ctx, id); err != nil {
+		t.Fatalf("删除计划任务失败: %v", err)
+	}
+	if ok, err := scheduler.assignDue(ctx, due, due.Task); ok || err != nil {
+		t.Errorf("期望跳过已删除的计划任务，实际为 %v，错误 %v", ok, err)
+	}
+	if _, err := mgr.GetTaskStatus(ctx, "report"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("期望未分配任务，实际得到 %v", err)
+	}
+}
+
+// failingScheduleStore 在fail为true时拒绝保存
+type failingScheduleStore struct {
+	*MemoryScheduleStore
+	mu   sync.Mutex
+	fail bool
+}
+
+func (s *failingScheduleStore) Save(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryScheduleStore.Save(ctx, schedule)
+}
+
+func TestSchedulerInvalidCron(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong"))
+	agentID := createTestAgent(t, mgr)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	// 指定首次执行时间时同样校验cron表达式
+	scheduler := NewScheduler(mgr, nil, clock)
+	_, err := scheduler.Add(ctx, Schedule{
+		AgentID: agentID,
+		Task:    types.Task{Type: "conversation"},
+		Cron:    "every morning",
+		StartAt: clock.Now().Add(time.Minute),
+	})
+	if !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("期望拒绝无效的cron表达式，实际得到 %v", err)
+	}
+
+	// 存储中已有的无效计划任务执行一次后暂停，不会反复分配
+	store := NewMemoryScheduleStore()
+	store.Save(ctx, Schedule{
+		ID:      "broken",
+		AgentID: agentID,
+		Task:    types.Task{Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}},
+		Cron:    "every morning",
+		NextRun: clock.Now(),
+	})
+	scheduler = NewScheduler(mgr, store, clock)
+	if err := scheduler.Start(ctx); err != nil {
+		t.Fatalf("启动调度器失败: %v", err)
+	}
+	defer scheduler.Stop()
+
+	waitFor(t, func() bool {
+		schedule, _ := scheduler.Get("broken")
+		return schedule.Paused
+	})
+	schedule, _ := scheduler.Get("broken")
+	if schedule.Runs != 1 || !strings.Contains(schedule.LastError, "paused") {
+		t.Errorf("期望执行一次后暂停，实际为 %+v", schedule)
+	}
+	if _, err := mgr.GetTaskStatus(ctx, "broken-2"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("期望不再分配任务，实际得到 %v", err)
+	}
+}
+
+func TestSchedulerSaveFailure(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("pong", "pong"))
+	agentID := createTestAgent(t, mgr)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	store := &failingScheduleStore{MemoryScheduleStore: NewMemoryScheduleStore()}
+	scheduler := NewScheduler(mgr, store, clock)
+	id, err := scheduler.Add(ctx, Schedule{
+		ID:       "report",
+		AgentID:  agentID,
+		Task:     types.Task{Type: "conversation", Parameters: map[string]interface{}{"input": "report"}},
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("添加计划任务失败: %v", err)
+	}
+	store.mu.Lock()
+	store.fail = true
+	store.mu.Unlock()
+
+	// 保存失败时仍推进下一次执行时间并记录错误
+	clock.Advance(time.Hour)
+	scheduler.runDue()
+	scheduler.runDue()
+
+	schedule, _ := scheduler.Get(id)
+	if schedule.Runs != 1 || !schedule.NextRun.Equal(clock.Now().Add(time.Hour)) || !strings.Contains(schedule.LastError, "disk full") {
+		t.Errorf("保存失败后的计划任务不正确: %+v", schedule)
+	}
+	if _, err := mgr.GetTaskStatus(ctx, "report-2"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("期望同一次执行只分配一次，实际得到 %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// snapshotVersion 是当前快照格式的版本，格式不兼容地变化时递增
+const snapshotVersion = 1
+
+// AgentSnapshot 是Agent状态的可移植快照，以JSON格式读写
+type AgentSnapshot struct {
+	Version   int                    `json:"version"`
+	CreatedAt time.Time              `json:"created_at"`
+	Config    AgentConfig            `json:"config"`            // 包含知识上下文配置和当前生效的预算
+	Context   map[string]interface{} `json:"context,omitempty"` // 运行时上下文
+	Memories  []types.Memory         `json:"memories,omitempty"`
+	Tasks     []types.Task           `json:"tasks,omitempty"` // 尚未结束的任务，按分配顺序排列
+}
+
+// RestoreOptions 定义了从快照恢复Agent时的选项
+type RestoreOptions struct {
+	// AgentID 为恢复出的Agent指定新ID，为空时沿用快照中的ID。
+	// 使用新ID时视为克隆：任务分配新的ID，记忆中的Agent ID替换为新ID
+	AgentID   string
+	SkipTasks bool // 不恢复快照中尚未结束的任务
+}
+
+// SnapshotAgent 将Agent的配置、运行时上下文、记忆和尚未结束的任务写入w。
+// 正在执行的任务也会写入快照，恢复后重新执行
+func (m *manager) SnapshotAgent(ctx context.Context, agentID string, w io.Writer) error {
+	agentI, ok := m.agents.Load(agentID)
+	if !ok {
+		return ErrAgentNotFound
+	}
+	agent := agentI.(*baseAgent)
+
+	snapshot := AgentSnapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		Config:    agent.config,
+	}
+
+	if runtime := agent.runtime; runtime != nil {
+		snapshot.Config.Budget = runtime.meter.currentBudget()
+		snapshot.Context = runtime.contextValues()
+		if err := checkContextValues(snapshot.Context); err != nil {
+			return err
+		}
+
+		memories, err := exportMemories(ctx, runtime.memory)
+		if err != nil {
+			return fmt.Errorf("failed to export memories: %w", err)
+		}
+		snapshot.Memories = memories
+	}
+
+	records, err := m.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	for _, record := range records {
+		if record.AgentID == agentID && !isTerminalStatus(record.Status) {
+			snapshot.Tasks = append(snapshot.Tasks, record.Task)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// RestoreAgent 从r读取快照并创建Agent，导入记忆和运行时上下文后重新分配尚未结束的任务。
+// 任一步骤失败时取消已分配的任务并销毁Agent，不会留下恢复了一部分的Agent。
+// 同ID的Agent已存在时返回ErrInvalidConfig，当前进程中仍在处理的同ID任务不会重复分配
+func (m *manager) RestoreAgent(ctx context.Context, r io.Reader, opts RestoreOptions) (types.Agent, error) {
+	var snapshot AgentSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, snapshot.Version)
+	}
+
+	config := snapshot.Config
+	if config.ID == "" {
+		return nil, fmt.Errorf("%w: agent id missing", ErrInvalidSnapshot)
+	}
+	sourceID := config.ID
+	if opts.AgentID != "" {
+		config.ID = opts.AgentID
+	}
+	clone := config.ID != sourceID
+
+	if _, ok := m.agents.Load(config.ID); ok {
+		return nil, fmt.Errorf("%w: agent %s already exists", ErrInvalidConfig, config.ID)
+	}
+
+	agent, err := m.CreateAgent(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	runtime := agent.(*baseAgent).runtime
+
+	if runtime.memory != nil {
+		for _, mem := range snapshot.Memories {
+			if clone {
+				mem = retargetMemory(mem, sourceID, config.ID)
+			}
+			if err := runtime.memory.Store(ctx, mem); err != nil {
+				m.abortRestore(ctx, config.ID, nil)
+				return nil, fmt.Errorf("failed to restore memory %s: %w", mem.ID, err)
+			}
+		}
+	}
+	runtime.restoreContext(snapshot.Context)
+
+	var restored []string
+	if !opts.SkipTasks {
+		for _, task := range snapshot.Tasks {
+			if clone {
+				task.ID = uuid.New().String()
+			} else if statusI, ok := m.tasks.Load(task.ID); ok && !isTerminalStatus(statusI.(types.TaskStatus).Status) {
+				continue
+			}
+			if err := m.AssignTask(ctx, config.ID, task); err != nil {
+				m.abortRestore(ctx, config.ID, restored)
+				return nil, fmt.Errorf("failed to restore task %s: %w", task.ID, err)
+			}
+			restored = append(restored, task.ID)
+		}
+	}
+
+	m.emitEvent(config.ID, Event{
+		ID:   uuid.New().String(),
+		Type: "agent_restored",
+		Data: map[string]interface{}{
+			"source_id":  sourceID,
+			"created_at": snapshot.CreatedAt,
+			"memories":   len(snapshot.Memories),
+			"tasks":      len(restored),
+		},
+		Timestamp: time.Now(),
+	})
+
+	return agent, nil
+}
+
+// abortRestore 撤销未完成的恢复：取消已重新分配的任务并销毁恢复出的Agent
+func (m *manager) abortRestore(ctx context.Context, agentID string, taskIDs []string) {
+	for _, taskID := range taskIDs {
+		m.CancelTask(ctx, taskID)
+	}
+	m.DestroyAgent(ctx, agentID)
+}
+
+// checkContextValues 检查运行时上下文能否编码为JSON，不能编码时报告对应的键
+func checkContextValues(values map[string]interface{}) error {
+	for _, key := range sortedKeys(values) {
+		if _, err := json.Marshal(values[key]); err != nil {
+			return fmt.Errorf("context value %q cannot be written to snapshot: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// exportMemories 导出记忆存储中的所有记忆
+func exportMemories(ctx context.Context, store types.Store) ([]types.Memory, error) {
+	if store == nil {
+		return nil, nil
+	}
+	if exporter, ok := store.(types.Exporter); ok {
+		return exporter.Export(ctx)
+	}
+
+	// 不支持导出的存储按统计的总数检索全部记忆
+	stats, err := store.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stats.TotalItems == 0 {
+		return nil, nil
+	}
+	return store.Recall(ctx, types.MemoryQuery{Limit: stats.TotalItems})
+}
+
+// retargetMemory 将记忆上下文中的Agent ID替换为克隆出的Agent ID
+func retargetMemory(mem types.Memory, from, to string) types.Memory {
+	if mem.Context["agent_id"] != from {
+		return mem
+	}
+
+	values := make(map[string]interface{}, len(mem.Context))
+	for k, v := range mem.Context {
+		values[k] = v
+	}
+	values["agent_id"] = to
+	mem.Context = values
+	return mem
+}
+
+// contextValues 返回运行时上下文的副本
+func (r *Runtime) contextValues() map[string]interface{} {
+	r.contextMu.Lock()
+	defer r.contextMu.Unlock()
+
+	if len(r.context) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(r.context))
+	for k, v := range r.context {
+		values[k] = v
+	}
+	return values
+}
+
+// restoreContext 将快照中的值写入运行时上下文
+func (r *Runtime) restoreContext(values map[string]interface{}) {
+	r.contextMu.Lock()
+	defer r.contextMu.Unlock()
+
+	for k, v := range values {
+		r.context[k] = v
+	}
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	provider := newFakeProvider("Paris", "Berlin")
+	mgr := newTestManager(t, provider)
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		ID:    "original",
+		Name:  "Original",
+		Model: ModelConfig{Type: "fake-model"},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agent.(*baseAgent).runtime.restoreContext(map[string]interface{}{"project": "geo"})
+
+	// 完成一轮对话，然后暂停Agent使下一个任务留在队列中
+	if status := runConversation(t, mgr, "original", types.Task{ID: "turn-1"}); status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际为 %s %v", status.Status, status.Error)
+	}
+	if err := mgr.PauseAgent(ctx, "original"); err != nil {
+		t.Fatalf("暂停Agent失败: %v", err)
+	}
+	pending := types.Task{ID: "turn-2", Type: "conversation", Parameters: map[string]interface{}{"input": "and Germany?"}}
+	if err := mgr.AssignTask(ctx, "original", pending); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := mgr.SnapshotAgent(ctx, "original", &buf); err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+
+	// 同ID的Agent仍存在时不能恢复
+	if _, err := mgr.RestoreAgent(ctx, bytes.NewReader(buf.Bytes()), RestoreOptions{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("期望拒绝覆盖已存在的Agent，实际得到 %v", err)
+	}
+
+	// 克隆出的Agent带有原Agent的记忆和上下文，并执行原Agent排队中的任务
+	clone, err := mgr.RestoreAgent(ctx, bytes.NewReader(buf.Bytes()), RestoreOptions{AgentID: "clone"})
+	if err != nil {
+		t.Fatalf("恢复Agent失败: %v", err)
+	}
+	runtime := clone.(*baseAgent).runtime
+	if runtime.contextValues()["project"] != "geo" {
+		t.Errorf("运行时上下文未恢复: %v", runtime.contextValues())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(provider.history()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("克隆出的Agent未执行排队中的任务")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var history []string
+	for _, msg := range provider.history()[1].Messages {
+		history = append(history, msg.Content)
+	}
+	if joined := strings.Join(history, "|"); !strings.Contains(joined, "hello|Paris|and Germany?") {
+		t.Errorf("克隆出的Agent未带有对话历史: %s", joined)
+	}
+	if status, _ := mgr.GetTaskStatus(ctx, pending.ID); isTerminalStatus(status.Status) {
+		t.Errorf("原Agent的任务不应受克隆影响，实际为 %s", status.Status)
+	}
+
+	if _, err := mgr.RestoreAgent(ctx, strings.NewReader(`{"version": 99}`), RestoreOptions{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("期望拒绝不支持的快照版本，实际得到 %v", err)
+	}
+}
+
+func TestSnapshotUnencodableContext(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+	agentID := createTestAgent(t, mgr)
+	agent, _ := mgr.(*manager).agents.Load(agentID)
+	agent.(*baseAgent).runtime.restoreContext(map[string]interface{}{"project": "geo", "callback": func() {}})
+
+	// 错误指出无法编码的上下文键
+	var buf bytes.Buffer
+	err := mgr.SnapshotAgent(ctx, agentID, &buf)
+	if err == nil || !strings.Contains(err.Error(), `"callback"`) {
+		t.Errorf("期望错误指出上下文键callback，实际得到 %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("失败时不应写入不完整的快照")
+	}
+}
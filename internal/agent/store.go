@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// TaskRecord 是持久化的任务及其状态
+type TaskRecord struct {
+	Task      types.Task          `json:"task"`
+	AgentID   string              `json:"agent_id"`
+	Status    string              `json:"status"`
+	Progress  float64             `json:"progress"`
+	Result    interface{}         `json:"result,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Attempts  int                 `json:"attempts"`
+	Resources types.ResourceStats `json:"resources"`
+	StartTime time.Time           `json:"start_time"`
+	EndTime   time.Time           `json:"end_time"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// newTaskRecord 根据任务状态创建任务记录
+func newTaskRecord(task types.Task, agentID string, status types.TaskStatus) TaskRecord {
+	record := TaskRecord{
+		Task:      task,
+		AgentID:   agentID,
+		Status:    status.Status,
+		Progress:  status.Progress,
+		Result:    status.Result,
+		Attempts:  status.Attempts,
+		Resources: status.Resources,
+		StartTime: status.StartTime,
+		EndTime:   status.EndTime,
+		UpdatedAt: time.Now(),
+	}
+	if status.Error != nil {
+		record.Error = status.Error.Error()
+	}
+	return record
+}
+
+// TaskStatus 将任务记录转换为任务状态
+func (r TaskRecord) TaskStatus() types.TaskStatus {
+	status := types.TaskStatus{
+		ID:         r.Task.ID,
+		Status:     r.Status,
+		Progress:   r.Progress,
+		Result:     r.Result,
+		Attempts:   r.Attempts,
+		Delegation: r.Task.Delegation,
+		Resources:  r.Resources,
+		StartTime:  r.StartTime,
+		EndTime:    r.EndTime,
+	}
+	if r.Error != "" {
+		status.Error = errors.New(r.Error)
+	}
+	return status
+}
+
+// TaskStore 接口定义了任务状态的持久化存储
+type TaskStore interface {
+	// Save 保存任务记录，已存在时覆盖
+	Save(ctx context.Context, record TaskRecord) error
+	// Get 获取任务记录，不存在时返回ErrTaskNotFound
+	Get(ctx context.Context, taskID string) (TaskRecord, error)
+	// List 按开始时间返回所有任务记录
+	List(ctx context.Context) ([]TaskRecord, error)
+	// Delete 删除任务记录
+	Delete(ctx context.Context, taskID string) error
+}
+
+// BatchTaskStore 是任务存储可选实现的接口，一次写入多条记录
+type BatchTaskStore interface {
+	TaskStore
+
+	// SaveBatch 保存多条任务记录，已存在时覆盖
+	SaveBatch(ctx context.Context, records []TaskRecord) error
+}
+
+// taskPersister 在任务状态锁之外将任务记录写入存储。
+// 写入串行执行，等待写入期间到达的记录合并为下一批，每个任务只写入最新的记录
+type taskPersister struct {
+	store   TaskStore
+	onError func(taskIDs []string, err error) // 写入失败时调用，失败的记录在下一批重试
+
+	flushMu sync.Mutex // 保证各批按顺序写入
+	mu      sync.Mutex
+	pending map[string]TaskRecord
+}
+
+func newTaskPersister(store TaskStore, onError func(taskIDs []string, err error)) *taskPersister {
+	return &taskPersister{
+		store:   store,
+		onError: onError,
+		pending: make(map[string]TaskRecord),
+	}
+}
+
+// enqueue 加入待写入的记录，覆盖同一任务尚未写入的记录。
+// 调用方需持有任务状态锁，使记录按状态变化的顺序入队
+func (p *taskPersister) enqueue(record TaskRecord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[record.Task.ID] = record
+}
+
+// flush 写入所有待写入的记录，返回时此前入队的记录已经写入或已报告失败
+func (p *taskPersister) flush() {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	batch := p.pending
+	p.pending = make(map[string]TaskRecord)
+	p.mu.Unlock()
+	if len(batch) == 0 {
+		// 记录已由其他调用方的批次写入
+		return
+	}
+
+	records := sortedRecords(batch)
+	var err error
+	if bs, ok := p.store.(BatchTaskStore); ok {
+		err = bs.SaveBatch(context.Background(), records)
+	} else {
+		for _, record := range records {
+			if err = p.store.Save(context.Background(), record); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		return
+	}
+
+	// 未被更新的记录放回队列，随下一批重试
+	taskIDs := make([]string, 0, len(records))
+	p.mu.Lock()
+	for _, record := range records {
+		taskIDs = append(taskIDs, record.Task.ID)
+		if _, ok := p.pending[record.Task.ID]; !ok {
+			p.pending[record.Task.ID] = record
+		}
+	}
+	p.mu.Unlock()
+	if p.onError != nil {
+		p.onError(taskIDs, err)
+	}
+}
+
+// delete 丢弃任务尚未写入的记录并从存储中删除，与各批写入按顺序执行
+func (p *taskPersister) delete(taskID string) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	delete(p.pending, taskID)
+	p.mu.Unlock()
+	return p.store.Delete(context.Background(), taskID)
+}
+
+// MemoryTaskStore 是基于内存的任务存储，进程退出后数据丢失
+type MemoryTaskStore struct {
+	mu      sync.RWMutex
+	records map[string]TaskRecord
+}
+
+// NewMemoryTaskStore 创建一个新的内存任务存储
+func NewMemoryTaskStore() *MemoryTaskStore {
+	return &MemoryTaskStore{
+		records: make(map[string]TaskRecord),
+	}
+}
+
+// Save 保存任务记录
+func (s *MemoryTaskStore) Save(ctx context.Context, record TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Task.ID] = record
+	return nil
+}
+
+// Get 获取任务记录
+func (s *MemoryTaskStore) Get(ctx context.Context, taskID string) (TaskRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[taskID]
+	if !ok {
+		return TaskRecord{}, ErrTaskNotFound
+	}
+	return record, nil
+}
+
+// List 返回所有任务记录
+func (s *MemoryTaskStore) List(ctx context.Context) ([]TaskRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedRecords(s.records), nil
+}
+
+// Delete 删除任务记录
+func (s *MemoryTaskStore) Delete(ctx context.Context, taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, taskID)
+	return nil
+}
+
+// sortedRecords 按开始时间排序任务记录
+func sortedRecords(records map[string]TaskRecord) []TaskRecord {
+	list := make([]TaskRecord, 0, len(records))
+	for _, record := range records {
+		list = append(list, record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].StartTime.Equal(list[j].StartTime) {
+			return list[i].Task.ID < list[j].Task.ID
+		}
+		return list[i].StartTime.Before(list[j].StartTime)
+	})
+	return list
+}
@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/memory"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// newStoreManager 创建一个使用给定任务存储的Agent管理器，并创建固定ID的Agent
+func newStoreManager(t *testing.T, provider types.Provider, store TaskStore, recovery RecoveryPolicy) Manager {
+	t.Helper()
+
+	service := llm.NewService()
+	if err := service.RegisterProvider(provider); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+
+	mgr := NewManager(tool.NewManager(), memory.NewManager(), nil, service, store, nil)
+	if _, err := mgr.CreateAgent(context.Background(), AgentConfig{
+		ID:       "agent-1",
+		Name:     "TestAgent",
+		Model:    ModelConfig{Type: "fake-model"},
+		Recovery: recovery,
+	}); err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	return mgr
+}
+
+func TestFileTaskStoreRecovery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.log")
+
+	store, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatalf("打开任务存储失败: %v", err)
+	}
+
+	// 第一个进程：一个任务完成，另一个任务执行中被中断
+	provider := &blockingProvider{started: make(chan string, 1)}
+	first := newStoreManager(t, provider, store, RecoverRequeue)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		first.DestroyAgent(stopCtx, "agent-1")
+	}()
+
+	store.Save(ctx, TaskRecord{Task: types.Task{ID: "done"}, AgentID: "agent-1", Status: "completed"})
+	task := types.Task{ID: "interrupted", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}
+	if err := first.AssignTask(ctx, "agent-1", task); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	<-provider.started
+
+	// 第二个进程：重放日志后恢复未完成的任务
+	reopened, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatalf("重新打开任务存储失败: %v", err)
+	}
+	defer reopened.Close()
+
+	record, err := reopened.Get(ctx, "interrupted")
+	if err != nil || record.Status != "running" {
+		t.Fatalf("期望恢复执行中的任务记录，实际得到 %+v，错误 %v", record, err)
+	}
+
+	second := newStoreManager(t, newFakeProvider("pong"), reopened, RecoverRequeue)
+	status, err := second.WaitTask(ctx, "interrupted")
+	if err != nil || status.Status != "completed" {
+		t.Fatalf("期望恢复的任务完成，实际状态 %s，错误 %v", status.Status, err)
+	}
+
+	// 已结束的任务可以直接查询
+	if status, err := second.GetTaskStatus(ctx, "done"); err != nil || status.Status != "completed" {
+		t.Errorf("期望查询到已完成的任务，实际状态 %s，错误 %v", status.Status, err)
+	}
+}
+
+func TestRecoverFailPolicy(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTaskStore()
+	store.Save(ctx, TaskRecord{Task: types.Task{ID: "queued", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}, AgentID: "agent-1", Status: "pending"})
+	store.Save(ctx, TaskRecord{Task: types.Task{ID: "running", Type: "conversation"}, AgentID: "agent-1", Status: "running"})
+
+	mgr := newStoreManager(t, newFakeProvider("pong"), store, RecoverFail)
+
+	if status, err := mgr.WaitTask(ctx, "queued"); err != nil || status.Status != "completed" {
+		t.Errorf("期望未开始的任务重新执行，实际状态 %s，错误 %v", status.Status, err)
+	}
+	if status, err := mgr.WaitTask(ctx, "running"); err != nil || status.Status != "failed" {
+		t.Errorf("期望中断的任务标记为失败，实际状态 %s，错误 %v", status.Status, err)
+	}
+}
+
+// unlistableTaskStore 无法列出任务记录
+type unlistableTaskStore struct {
+	*MemoryTaskStore
+}
+
+func (s unlistableTaskStore) List(ctx context.Context) ([]TaskRecord, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestRecoverFailureEvent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	service := llm.NewService()
+	service.RegisterProvider(newFakeProvider())
+	mgr := NewManager(tool.NewManager(), memory.NewManager(), nil, service, unlistableTaskStore{NewMemoryTaskStore()}, nil)
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{Types: []string{"task_recover_failed"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	if _, err := mgr.CreateAgent(ctx, AgentConfig{ID: "agent-1", Name: "TestAgent", Model: ModelConfig{Type: "fake-model"}}); err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+
+	// 无法读取任务存储时以事件报告，Agent照常创建
+	select {
+	case event := <-sub.Events():
+		if event.AgentID != "agent-1" || event.Data != "permission denied" {
+			t.Errorf("恢复失败事件不正确: %+v", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("等待恢复失败事件超时")
+	}
+}
+
+// failingTaskStore 在fail为true时拒绝写入
+type failingTaskStore struct {
+	*MemoryTaskStore
+	mu   sync.Mutex
+	fail bool
+}
+
+func (s *failingTaskStore) Save(ctx context.Context, record TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryTaskStore.Save(ctx, record)
+}
+
+func (s *failingTaskStore) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func TestTaskPersistFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	store := &failingTaskStore{MemoryTaskStore: NewMemoryTaskStore(), fail: true}
+	mgr := newStoreManager(t, newFakeProvider("pong"), store, RecoverRequeue)
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: "agent-1", Types: []string{"task_persist_failed"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	if err := mgr.AssignTask(ctx, "agent-1", types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}}); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+
+	// 写入失败以事件报告，任务照常执行
+	select {
+	case event := <-sub.Events():
+		if event.TaskID != "task-1" || event.Data != "disk full" {
+			t.Errorf("写入失败事件不正确: %+v", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("等待写入失败事件超时")
+	}
+	if status, err := mgr.WaitTask(ctx, "task-1"); err != nil || status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际状态 %s，错误 %v", status.Status, err)
+	}
+
+	// 存储恢复后，下一次写入带上失败的记录
+	store.setFail(false)
+	mgr.AssignTask(ctx, "agent-1", types.Task{ID: "task-2", Type: "conversation", Parameters: map[string]interface{}{"input": "ping"}})
+	mgr.WaitTask(ctx, "task-2")
+	if record, err := store.Get(ctx, "task-1"); err != nil || record.Status != "completed" {
+		t.Errorf("期望失败的记录在之后写入，实际得到 %+v，错误 %v", record, err)
+	}
+}
+
+func TestFileTaskStoreAutoCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.log")
+
+	store, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatalf("打开任务存储失败: %v", err)
+	}
+	defer store.Close()
+
+	record := TaskRecord{Task: types.Task{ID: "busy"}, AgentID: "agent-1", Status: "running"}
+	for i := 0; i < 3*compactMinEntries; i++ {
+		record.Progress = float64(i) / (3 * compactMinEntries)
+		if err := store.Save(ctx, record); err != nil {
+			t.Fatalf("保存任务记录失败: %v", err)
+		}
+	}
+	if err := store.SaveBatch(ctx, []TaskRecord{record, {Task: types.Task{ID: "other"}, Status: "pending"}}); err != nil {
+		t.Fatalf("批量保存任务记录失败: %v", err)
+	}
+
+	// 运行中自动压缩，日志不会随修改次数无限增长
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取日志失败: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines > compactMinEntries+2 {
+		t.Errorf("期望日志被自动压缩，实际有 %d 行", lines)
+	}
+
+	reopened, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatalf("重新打开任务存储失败: %v", err)
+	}
+	defer reopened.Close()
+	if records, _ := reopened.List(ctx); len(records) != 2 {
+		t.Errorf("期望压缩后保留2条记录，实际为 %d 条", len(records))
+	}
+}
+
+func TestFileTaskStoreCorruptLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	valid := `{"op":"save","record":{"task":{"id":"kept"},"agent_id":"agent-1","status":"completed"}}` + "\n"
+
+	// 崩溃时写了一半的最后一行被跳过并在打开时清除
+	torn := filepath.Join(dir, "torn.log")
+	os.WriteFile(torn, []byte(valid+`{"op":"save","rec`), 0644)
+	store, err := NewFileTaskStore(torn)
+	if err != nil {
+		t.Fatalf("期望容忍不完整的最后一行，实际得到 %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Get(ctx, "kept"); err != nil {
+		t.Errorf("期望保留完整的记录，实际得到 %v", err)
+	}
+	if data, _ := os.ReadFile(torn); strings.Count(string(data), "\n") != 1 || !strings.HasSuffix(string(data), "\n") {
+		t.Errorf("打开后不完整的最后一行应被清除: %q", data)
+	}
+
+	// 中间无法解析的行说明日志已损坏
+	corrupt := filepath.Join(dir, "corrupt.log")
+	os.WriteFile(corrupt, []byte("not json\n"+valid), 0644)
+	if _, err := NewFileTaskStore(corrupt); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("期望日志损坏错误，实际得到 %v", err)
+	}
+}
+
+func TestFileTaskStoreCompactError(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.log")
+
+	store, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatalf("打开任务存储失败: %v", err)
+	}
+	defer store.Close()
+	var compactErrs []error
+	store.OnCompactError = func(err error) { compactErrs = append(compactErrs, err) }
+
+	// 临时文件路径被目录占用，自动压缩无法创建临时文件
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	record := TaskRecord{Task: types.Task{ID: "busy"}, AgentID: "agent-1", Status: "running"}
+	for i := 0; i < 3*compactMinEntries; i++ {
+		if err := store.Save(ctx, record); err != nil {
+			t.Fatalf("写入成功后不应返回压缩错误: %v", err)
+		}
+	}
+	if len(compactErrs) == 0 {
+		t.Fatal("期望通过OnCompactError报告压缩失败")
+	}
+	if got, err := store.Get(ctx, "busy"); err != nil || got.Status != "running" {
+		t.Errorf("压缩失败不应影响已保存的记录，实际得到 %+v，错误 %v", got, err)
+	}
+}
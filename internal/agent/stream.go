@@ -0,0 +1,287 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// ChunkKind 定义了任务增量输出的类型
+type ChunkKind string
+
+// 预定义增量输出类型
+const (
+	ChunkToken       ChunkKind = "token"       // 模型生成的一段文本
+	ChunkObservation ChunkKind = "observation" // 工具调用的观察结果
+	ChunkProgress    ChunkKind = "progress"    // 进度更新，同时反映在TaskStatus.Progress中
+)
+
+// TaskChunk 是运行中任务发布的一段增量输出
+type TaskChunk struct {
+	TaskID    string    `json:"task_id"`
+	Kind      ChunkKind `json:"kind"`
+	Content   string    `json:"content,omitempty"`
+	ToolID    string    `json:"tool_id,omitempty"`  // 仅observation
+	Progress  float64   `json:"progress,omitempty"` // 仅progress，取值0到1
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// runtimeKey 是任务上下文中运行时的键
+type runtimeKey struct{}
+
+// ReportProgress 报告任务的执行进度，供自定义任务处理器使用。
+// ctx须为处理器收到的任务上下文，progress取值0到1，message可为空
+func ReportProgress(ctx context.Context, progress float64, message string) {
+	r, ok := ctx.Value(runtimeKey{}).(*Runtime)
+	if !ok {
+		return
+	}
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	r.publishChunk(ctx, TaskChunk{Kind: ChunkProgress, Content: message, Progress: progress})
+}
+
+// publishChunk 经中间件处理后发布任务的增量输出。
+// 分片作为task_output事件分发给订阅者，但不写入事件日志
+func (r *Runtime) publishChunk(ctx context.Context, chunk TaskChunk) {
+	taskID, ok := ctx.Value("task_id").(string)
+	if !ok {
+		return
+	}
+	chunk.TaskID = taskID
+	chunk.Timestamp = time.Now()
+
+	for _, mw := range r.middlewares() {
+		if mw.OnChunk == nil {
+			continue
+		}
+		if err := mw.OnChunk(ctx, &chunk); err != nil {
+			r.recordEvent(ctx, "middleware_aborted", map[string]interface{}{
+				"stage":      string(StageChunk),
+				"middleware": mw.Name,
+				"error":      err.Error(),
+			})
+			return
+		}
+	}
+
+	if r.onChunk != nil {
+		r.onChunk(chunk)
+	}
+	if r.events != nil {
+		event := NewEvent(uuid.New().String(), "task_output", chunk)
+		event.AgentID = r.agent.id
+		event.TaskID = taskID
+		r.events.broadcast(*event)
+	}
+}
+
+// tokenMode 决定模型生成的文本中哪些部分作为任务输出发布
+type tokenMode int
+
+const (
+	tokensAll         tokenMode = iota // 发布全部文本
+	tokensFinalAnswer                  // 只发布ReAct回复中最终答案的文本
+)
+
+// tokenStream 将一次模型调用生成的文本作为任务输出发布
+type tokenStream struct {
+	r         *Runtime
+	ctx       context.Context
+	mode      tokenMode
+	buffered  bool // 有中间件需要在AfterModel中检查回复，通过后一次发布
+	text      strings.Builder
+	sent      int // 已发布的位置，只发布最终答案时在找到标记前为-1
+	published bool
+}
+
+// newTokenStream 创建模型调用的文本输出
+func (r *Runtime) newTokenStream(ctx context.Context, mode tokenMode, mws []Middleware) *tokenStream {
+	s := &tokenStream{r: r, ctx: ctx, mode: mode}
+	if mode == tokensFinalAnswer {
+		s.sent = -1
+	}
+	for _, mw := range mws {
+		if mw.AfterModel != nil {
+			s.buffered = true
+		}
+	}
+	return s
+}
+
+// write 接收流式生成的一段文本，不需要缓存时立即发布
+func (s *tokenStream) write(delta string) error {
+	if s.buffered {
+		return nil
+	}
+	s.text.WriteString(delta)
+	text := s.text.String()
+
+	if s.sent < 0 {
+		idx := strings.Index(text, finalAnswerMarker)
+		if idx < 0 {
+			return nil
+		}
+		s.sent = idx + len(finalAnswerMarker)
+	}
+	// 跳过最终答案开头的空白
+	if !s.published {
+		s.sent += len(text[s.sent:]) - len(strings.TrimLeft(text[s.sent:], " \t\r\n"))
+	}
+	if s.sent < len(text) {
+		s.publish(text[s.sent:])
+		s.sent = len(text)
+	}
+	return nil
+}
+
+// flush 在回复通过中间件后调用。缓存的回复和未按格式输出标记的最终答案在此发布
+func (s *tokenStream) flush(content string) {
+	if s.published {
+		return
+	}
+	if s.mode == tokensFinalAnswer {
+		reply := parseReActReply(content)
+		if !reply.isFinal {
+			return
+		}
+		content = reply.finalAnswer
+	}
+	if content != "" {
+		s.publish(content)
+	}
+}
+
+func (s *tokenStream) publish(content string) {
+	s.published = true
+	s.r.publishChunk(s.ctx, TaskChunk{Kind: ChunkToken, Content: content})
+}
+
+// taskStream 缓存一个任务的全部增量输出，使晚到的读取方也能从头读取
+type taskStream struct {
+	mu      sync.Mutex
+	chunks  []TaskChunk
+	closed  bool
+	updated chan struct{} // 有新分片或输出结束时关闭并替换
+}
+
+func newTaskStream() *taskStream {
+	return &taskStream{updated: make(chan struct{})}
+}
+
+// append 添加分片并唤醒读取方
+func (s *taskStream) append(chunk TaskChunk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.chunks = append(s.chunks, chunk)
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
+
+// close 结束输出，可重复调用
+func (s *taskStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.updated)
+	}
+}
+
+// read 返回从from开始的分片、输出是否已结束，以及下次更新的通知通道
+func (s *taskStream) read(from int) ([]TaskChunk, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chunks[from:], s.closed, s.updated
+}
+
+// subscribe 返回从头开始依次接收分片的通道，输出结束或ctx结束时关闭
+func (s *taskStream) subscribe(ctx context.Context) <-chan TaskChunk {
+	ch := make(chan TaskChunk, defaultEventBuffer)
+
+	go func() {
+		defer close(ch)
+
+		next := 0
+		for {
+			chunks, closed, updated := s.read(next)
+			for _, chunk := range chunks {
+				select {
+				case ch <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+			next += len(chunks)
+			if closed {
+				return
+			}
+
+			select {
+			case <-updated:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// StreamTask 返回任务的增量输出通道，从任务开始时的第一段输出读起，
+// 任务结束或ctx结束时关闭。任务已经结束时返回已关闭的通道
+func (m *manager) StreamTask(ctx context.Context, taskID string) (<-chan TaskChunk, error) {
+	if _, ok := m.tasks.Load(taskID); !ok {
+		return nil, ErrTaskNotFound
+	}
+
+	streamI, ok := m.streams.Load(taskID)
+	if !ok {
+		ch := make(chan TaskChunk)
+		close(ch)
+		return ch, nil
+	}
+	return streamI.(*taskStream).subscribe(ctx), nil
+}
+
+// recordTaskChunk 缓存任务的增量输出，并将进度更新写入任务状态
+// 进度先写入任务状态，读取方收到进度分片时任务状态已经更新
+func (m *manager) recordTaskChunk(chunk TaskChunk) {
+	if chunk.Kind == ChunkProgress {
+		m.setProgress(chunk.TaskID, chunk.Progress)
+	}
+
+	if streamI, ok := m.streams.Load(chunk.TaskID); ok {
+		streamI.(*taskStream).append(chunk)
+	}
+}
+
+// setProgress 只在内存中更新任务进度，不写入任务存储。
+// 处理器可能频繁报告进度，进度随任务的下一次状态变化一起持久化
+func (m *manager) setProgress(taskID string, progress float64) {
+	m.tasksMu.Lock()
+	defer m.tasksMu.Unlock()
+
+	taskI, ok := m.tasks.Load(taskID)
+	if !ok {
+		return
+	}
+	status := taskI.(types.TaskStatus)
+	if isTerminalStatus(status.Status) {
+		return
+	}
+	status.Progress = progress
+	m.tasks.Store(taskID, status)
+}
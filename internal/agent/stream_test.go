@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/llm"
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// streamingProvider 按单词逐段返回脚本化回复的提供者
+type streamingProvider struct {
+	*fakeProvider
+}
+
+func (p *streamingProvider) ChatStream(ctx context.Context, modelID string, request types.ChatRequest, onDelta func(delta string) error) (types.ChatResponse, error) {
+	response, err := p.Chat(ctx, modelID, request)
+	if err != nil || onDelta == nil {
+		return response, err
+	}
+	for _, word := range strings.SplitAfter(response.Message.Content, " ") {
+		if err := onDelta(word); err != nil {
+			return types.ChatResponse{}, err
+		}
+	}
+	return response, nil
+}
+
+func TestStreamTaskTokens(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mgr := newTestManager(t, &streamingProvider{newFakeProvider("Hello there, Alice.")})
+	agentID := createTestAgent(t, mgr)
+	sub, err := mgr.Subscribe(ctx, SubscribeOptions{AgentID: agentID, Types: []string{"task_output"}})
+	if err != nil {
+		t.Fatalf("订阅事件失败: %v", err)
+	}
+
+	status := runConversation(t, mgr, agentID, types.Task{ID: "streamed"})
+	if status.Status != "completed" {
+		t.Fatalf("期望任务完成，实际为 %s %v", status.Status, status.Error)
+	}
+
+	// 任务结束后不再保留输出，读取时得到已关闭的通道
+	chunks, err := mgr.StreamTask(ctx, "streamed")
+	if err != nil {
+		t.Fatalf("读取任务输出失败: %v", err)
+	}
+	var tokens []string
+	for chunk := range chunks {
+		tokens = append(tokens, chunk.Content)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("期望已结束任务的输出通道已关闭，实际收到 %v", tokens)
+	}
+
+	// 每段输出也作为task_output事件发布
+	for len(tokens) < 3 {
+		select {
+		case event := <-sub.Events():
+			chunk := event.Data.(TaskChunk)
+			if chunk.Kind != ChunkToken || event.TaskID != "streamed" {
+				t.Fatalf("输出事件不正确: %+v", event)
+			}
+			tokens = append(tokens, chunk.Content)
+		case <-ctx.Done():
+			t.Fatalf("等待输出事件超时，已收到 %v", tokens)
+		}
+	}
+	if strings.Join(tokens, "") != "Hello there, Alice." {
+		t.Errorf("逐段输出与完整回复不一致: %q", tokens)
+	}
+}
+
+// newStreamingRuntime 创建使用逐段输出提供者的运行时，返回收集到的模型输出
+func newStreamingRuntime(t *testing.T, provider *fakeProvider, tools []tool.Tool) (*Runtime, *[]string) {
+	t.Helper()
+
+	runtime := newTestRuntime(t, provider, tools, nil)
+	runtime.llm = llm.NewService()
+	if err := runtime.llm.RegisterProvider(&streamingProvider{provider}); err != nil {
+		t.Fatalf("注册提供者失败: %v", err)
+	}
+
+	var tokens []string
+	runtime.onChunk = func(chunk TaskChunk) {
+		if chunk.Kind == ChunkToken {
+			tokens = append(tokens, chunk.Content)
+		}
+	}
+	return runtime, &tokens
+}
+
+func TestStreamReActFinalAnswer(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "task_id", "task-1")
+	provider := newFakeProvider(
+		"Thought: I should repeat it\nAction: repeat\nAction Input: {\"word\": \"hi\", \"times\": 2}",
+		"Thought: I know the answer\nFinal Answer: the word is hihi",
+	)
+	runtime, tokens := newStreamingRuntime(t, provider, []tool.Tool{&fakeTool{id: "repeat"}})
+
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "repeat hi"}}
+	if _, err := runtime.interceptTask(ctx, task); err != nil {
+		t.Fatalf("任务执行失败: %v", err)
+	}
+
+	// 思考和工具调用不作为输出发布，最终答案逐段发布
+	if len(*tokens) < 2 || strings.Join(*tokens, "") != "the word is hihi" {
+		t.Errorf("期望只发布最终答案，实际为 %q", *tokens)
+	}
+}
+
+func TestStreamAfterModelRedaction(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "task_id", "task-1")
+	runtime, tokens := newStreamingRuntime(t, newFakeProvider("my card is 4111 1111"), nil)
+	runtime.Use(Middleware{
+		Name: "redact",
+		AfterModel: func(ctx context.Context, request types.ChatRequest, response *types.ChatResponse) error {
+			response.Message.Content = strings.ReplaceAll(response.Message.Content, "4111", "****")
+			return nil
+		},
+	})
+
+	task := types.Task{ID: "task-1", Type: "conversation", Parameters: map[string]interface{}{"input": "hello"}}
+	if _, err := runtime.interceptTask(ctx, task); err != nil {
+		t.Fatalf("任务执行失败: %v", err)
+	}
+
+	// 输出在AfterModel通过后按修改后的回复发布
+	if strings.Join(*tokens, "") != "my card is **** 1111" {
+		t.Errorf("发布的输出未经过AfterModel: %q", *tokens)
+	}
+}
+
+func TestStreamTaskProgress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mgr := newTestManager(t, newFakeProvider())
+	release := make(chan struct{})
+	agentID := createRoleAgent(t, mgr, "worker", map[string]HandlerFunc{
+		"import": func(ctx context.Context, task types.Task) (types.Result, error) {
+			ReportProgress(ctx, 0.5, "half of the rows imported")
+			<-release
+			ReportProgress(ctx, 2, "")
+			return types.Result{Data: "imported"}, nil
+		},
+	})
+
+	if err := mgr.AssignTask(ctx, agentID, types.Task{ID: "import-1", Type: "import"}); err != nil {
+		t.Fatalf("分配任务失败: %v", err)
+	}
+	chunks, err := mgr.StreamTask(ctx, "import-1")
+	if err != nil {
+		t.Fatalf("读取任务输出失败: %v", err)
+	}
+
+	first := <-chunks
+	if first.Kind != ChunkProgress || first.Progress != 0.5 || first.Content != "half of the rows imported" {
+		t.Fatalf("进度输出不正确: %+v", first)
+	}
+	if status, _ := mgr.GetTaskStatus(ctx, "import-1"); status.Progress != 0.5 || status.Status != "running" {
+		t.Errorf("任务状态未反映进度: %s %v", status.Status, status.Progress)
+	}
+	// 进度只保存在内存中，不在每次报告时写入任务存储
+	if record, _ := mgr.(*manager).store.Get(ctx, "import-1"); record.Progress != 0 {
+		t.Errorf("进度报告不应写入任务存储，实际为 %v", record.Progress)
+	}
+
+	close(release)
+	if last := <-chunks; last.Progress != 1 {
+		t.Errorf("进度应限制在0到1之间，实际为 %v", last.Progress)
+	}
+	if _, ok := <-chunks; ok {
+		t.Errorf("任务结束后输出通道应关闭")
+	}
+
+	if _, err := mgr.StreamTask(ctx, "missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("期望任务不存在错误，实际得到 %v", err)
+	}
+}
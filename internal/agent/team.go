@@ -0,0 +1,463 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+const (
+	defaultTeamRounds = 3
+	maxPlanRetries    = 2 // 主管的回复无法解析时，每轮最多要求其重新回复的次数
+)
+
+// errMalformedPlan 表示主管的回复不是所要求格式的计划
+var errMalformedPlan = errors.New("malformed plan")
+
+// TeamConfig 定义了由一个主管Agent和若干工作者Agent组成的团队
+type TeamConfig struct {
+	ID          string
+	Name        string
+	Supervisor  AgentConfig   // 主管负责分解目标、评估结果并决定何时完成
+	Workers     []AgentConfig // 工作者按Capabilities领取子任务
+	Concurrency int           // 同时执行的子任务数上限，默认等于工作者数量
+	MaxRounds   int           // 分解、执行、评估的最大轮数，默认为3。最后一轮执行后主管再做一次最终评估
+}
+
+// TeamTask 是主管分解出的一个子任务
+type TeamTask struct {
+	ID          string
+	Round       int
+	Capability  string
+	Description string
+	AgentID     string // 执行子任务的工作者
+	Status      string // pending, running, completed, failed
+	Result      string
+	Error       string
+}
+
+// TeamStatus 是团队的整体状态
+type TeamStatus struct {
+	ID     string
+	Status string // idle, running, completed, failed
+	Goal   string
+	Round  int
+	Answer string
+	Error  error
+	Tasks  []TeamTask
+	Agents map[string]types.AgentStatus // 主管和工作者的状态
+}
+
+// teamPlan 是主管每一轮的输出
+type teamPlan struct {
+	Done   bool   `json:"done"`
+	Answer string `json:"answer"`
+	Tasks  []struct {
+		Capability  string `json:"capability"`
+		Description string `json:"description"`
+	} `json:"tasks"`
+}
+
+// teamWorker 是团队中的一个工作者
+type teamWorker struct {
+	id           string
+	capabilities []string
+	inflight     int
+}
+
+// Team 以主管/工作者模式协作完成目标：主管用LLM将目标分解为子任务，
+// 按能力分配给工作者并行执行，汇总结果后决定完成或继续下一轮
+type Team struct {
+	mu         sync.Mutex
+	manager    Manager
+	config     TeamConfig
+	supervisor string
+	workers    []*teamWorker
+	slots      chan struct{}
+	status     TeamStatus
+	runs       int
+}
+
+// NewTeam 按配置在管理器中创建主管和工作者Agent并组成团队
+func NewTeam(ctx context.Context, manager Manager, config TeamConfig) (*Team, error) {
+	if config.ID == "" {
+		config.ID = uuid.New().String()
+	}
+	if len(config.Workers) == 0 {
+		return nil, fmt.Errorf("%w: team %s has no workers", ErrInvalidConfig, config.ID)
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = len(config.Workers)
+	}
+	if config.MaxRounds <= 0 {
+		config.MaxRounds = defaultTeamRounds
+	}
+
+	t := &Team{
+		manager: manager,
+		config:  config,
+		slots:   make(chan struct{}, config.Concurrency),
+		status:  TeamStatus{ID: config.ID, Status: "idle"},
+	}
+
+	supervisor, err := t.createAgent(ctx, config.Supervisor, "supervisor")
+	if err != nil {
+		return nil, err
+	}
+	t.supervisor = supervisor
+
+	for i, workerConfig := range config.Workers {
+		id, err := t.createAgent(ctx, workerConfig, fmt.Sprintf("worker-%d", i+1))
+		if err != nil {
+			t.Destroy(ctx)
+			return nil, err
+		}
+		t.workers = append(t.workers, &teamWorker{id: id, capabilities: workerConfig.Capabilities})
+	}
+
+	return t, nil
+}
+
+// createAgent 创建团队成员，未指定ID和名称时以团队ID为前缀生成
+func (t *Team) createAgent(ctx context.Context, config AgentConfig, member string) (string, error) {
+	if config.ID == "" {
+		config.ID = fmt.Sprintf("%s.%s", t.config.ID, member)
+	}
+	if config.Name == "" {
+		config.Name = config.ID
+	}
+
+	agent, err := t.manager.CreateAgent(ctx, config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create team %s %s: %w", t.config.ID, member, err)
+	}
+	return agent.Status().ID, nil
+}
+
+// ID 返回团队ID
+func (t *Team) ID() string {
+	return t.config.ID
+}
+
+// Run 执行一个目标直到主管判断完成，返回主管给出的最终答案。
+// 同一时间只能执行一个目标，超过最大轮数仍未完成时返回ErrTeamIncomplete
+func (t *Team) Run(ctx context.Context, goal string) (string, error) {
+	t.mu.Lock()
+	if t.status.Status == "running" {
+		t.mu.Unlock()
+		return "", ErrTeamBusy
+	}
+	t.runs++
+	runID := fmt.Sprintf("%s.run-%d", t.config.ID, t.runs)
+	t.status = TeamStatus{ID: t.config.ID, Status: "running", Goal: goal}
+	t.mu.Unlock()
+
+	answer, err := t.run(ctx, runID, goal)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.status.Status = "failed"
+		t.status.Error = err
+	} else {
+		t.status.Status = "completed"
+		t.status.Answer = answer
+	}
+	return answer, err
+}
+
+// run 循环执行：主管制定计划，工作者执行子任务，结果反馈给主管
+func (t *Team) run(ctx context.Context, runID, goal string) (string, error) {
+	var feedback string
+	for round := 1; round <= t.config.MaxRounds; round++ {
+		t.mu.Lock()
+		t.status.Round = round
+		t.mu.Unlock()
+
+		plan, planTaskID, err := t.planRound(ctx, fmt.Sprintf("%s.plan-%d", runID, round), goal, feedback)
+		if err != nil {
+			return "", err
+		}
+		if plan.Done {
+			return plan.Answer, nil
+		}
+
+		tasks := make([]TeamTask, len(plan.Tasks))
+		for i, p := range plan.Tasks {
+			tasks[i] = TeamTask{
+				ID:          fmt.Sprintf("%s.task-%d-%d", runID, round, i+1),
+				Round:       round,
+				Capability:  p.Capability,
+				Description: p.Description,
+				Status:      "pending",
+			}
+		}
+		t.mu.Lock()
+		offset := len(t.status.Tasks)
+		t.status.Tasks = append(t.status.Tasks, tasks...)
+		t.mu.Unlock()
+
+		var wg sync.WaitGroup
+		for i := range tasks {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				t.execute(ctx, offset+index, goal, planTaskID)
+			}(i)
+		}
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		t.mu.Lock()
+		feedback = buildTeamFeedback(t.status.Tasks[offset:])
+		t.mu.Unlock()
+	}
+
+	// 最后一轮的结果交给主管做最终评估，不再分派新的子任务
+	feedback += "\n\nThis was the last round and no more sub-tasks can be run. " +
+		"Set done to true and give the best answer the results allow."
+	plan, _, err := t.planRound(ctx, runID+".final", goal, feedback)
+	if err != nil {
+		return "", err
+	}
+	if plan.Done {
+		return plan.Answer, nil
+	}
+	return "", fmt.Errorf("%w: no answer after %d rounds", ErrTeamIncomplete, t.config.MaxRounds)
+}
+
+// planRound 让主管制定计划，返回计划和制定它的任务ID，taskID为首次请求的任务ID。
+// 无法解析的回复不计入轮数：解析错误附加在本轮的反馈之后，要求主管重新回复，最多重试maxPlanRetries次
+func (t *Team) planRound(ctx context.Context, taskID, goal, feedback string) (*teamPlan, string, error) {
+	prompt := feedback
+	for attempt := 0; ; attempt++ {
+		attemptID := taskID
+		if attempt > 0 {
+			attemptID = fmt.Sprintf("%s.retry-%d", taskID, attempt)
+		}
+
+		plan, err := t.plan(ctx, attemptID, goal, prompt)
+		if err == nil {
+			return plan, attemptID, nil
+		}
+		if !errors.Is(err, errMalformedPlan) {
+			return nil, "", err
+		}
+		if attempt >= maxPlanRetries {
+			return nil, "", fmt.Errorf("%w: supervisor did not reply with a valid plan after %d attempts: %v", ErrTeamIncomplete, attempt+1, err)
+		}
+
+		retry := fmt.Sprintf("Your previous reply could not be parsed (%v). Reply again with JSON only, in the required format.", err)
+		prompt = strings.TrimSpace(feedback + "\n\n" + retry)
+	}
+}
+
+// plan 让主管根据目标和上一轮的结果制定计划，输出无法解析时返回errMalformedPlan
+func (t *Team) plan(ctx context.Context, taskID, goal, feedback string) (*teamPlan, error) {
+	response, err := t.converse(ctx, t.supervisor, types.Task{
+		ID:         taskID,
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": t.buildPlanPrompt(goal, feedback)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("supervisor failed to plan: %w", err)
+	}
+
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("%w: no JSON object in reply", errMalformedPlan)
+	}
+	var plan teamPlan
+	if err := json.Unmarshal([]byte(response[start:end+1]), &plan); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedPlan, err)
+	}
+	if !plan.Done && len(plan.Tasks) == 0 {
+		return nil, fmt.Errorf("%w: done is false but no tasks are given", errMalformedPlan)
+	}
+	return &plan, nil
+}
+
+// execute 将子任务分配给具备所需能力且负载最低的工作者，受团队并发上限约束
+func (t *Team) execute(ctx context.Context, index int, goal, planTaskID string) {
+	t.mu.Lock()
+	task := t.status.Tasks[index]
+	worker := t.pickWorker(task.Capability)
+	if worker == nil {
+		t.status.Tasks[index].Status = "failed"
+		t.status.Tasks[index].Error = fmt.Sprintf("%v: %s", ErrNoCapableAgent, task.Capability)
+		t.mu.Unlock()
+		return
+	}
+	worker.inflight++
+	t.status.Tasks[index].AgentID = worker.id
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		worker.inflight--
+		t.mu.Unlock()
+	}()
+
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	case <-ctx.Done():
+		t.finishTask(index, "", ctx.Err())
+		return
+	}
+
+	t.mu.Lock()
+	t.status.Tasks[index].Status = "running"
+	t.mu.Unlock()
+
+	input := fmt.Sprintf("Overall goal: %s\n\nYour task: %s", goal, task.Description)
+	result, err := t.converse(ctx, worker.id, types.Task{
+		ID:         task.ID,
+		Type:       "conversation",
+		Parameters: map[string]interface{}{"input": input},
+		Delegation: []types.DelegationHop{{AgentID: t.supervisor, TaskID: planTaskID}},
+	})
+	t.finishTask(index, result, err)
+}
+
+// pickWorker 选择具备指定能力且进行中子任务最少的工作者，调用方需持有锁
+func (t *Team) pickWorker(capability string) *teamWorker {
+	var best *teamWorker
+	for _, worker := range t.workers {
+		if !containsString(worker.capabilities, capability) {
+			continue
+		}
+		if best == nil || worker.inflight < best.inflight {
+			best = worker
+		}
+	}
+	return best
+}
+
+// finishTask 记录子任务结果
+func (t *Team) finishTask(index int, result string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		t.status.Tasks[index].Status = "failed"
+		t.status.Tasks[index].Error = err.Error()
+		return
+	}
+	t.status.Tasks[index].Status = "completed"
+	t.status.Tasks[index].Result = result
+}
+
+// converse 将对话任务分配给团队成员并等待回复，ctx结束时取消任务。
+// 每个任务使用独立的对话ID，提示中已包含所需的全部上下文
+func (t *Team) converse(ctx context.Context, agentID string, task types.Task) (string, error) {
+	task.Parameters["conversation_id"] = task.ID
+	if err := t.manager.AssignTask(ctx, agentID, task); err != nil {
+		return "", err
+	}
+
+	status, err := t.manager.WaitTask(ctx, task.ID)
+	if err != nil {
+		t.manager.CancelTask(context.Background(), task.ID)
+		return "", err
+	}
+	if status.Status != "completed" {
+		return "", fmt.Errorf("task %s %s: %v", task.ID, status.Status, status.Error)
+	}
+
+	result, _ := status.Result.(types.Result)
+	if data, ok := result.Data.(map[string]interface{}); ok {
+		if response, ok := data["response"].(string); ok {
+			return response, nil
+		}
+	}
+	return fmt.Sprintf("%v", result.Data), nil
+}
+
+// buildPlanPrompt 构建主管的计划提示，包含可用能力、目标和上一轮的结果
+func (t *Team) buildPlanPrompt(goal, feedback string) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are the supervisor of a team of agents. Break the goal down into sub-tasks ")
+	sb.WriteString("and assign each one to a capability. Available workers:\n")
+	for _, worker := range t.workers {
+		sb.WriteString(fmt.Sprintf("\n- %s: %s", worker.id, strings.Join(worker.capabilities, ", ")))
+	}
+
+	sb.WriteString("\n\nGoal: ")
+	sb.WriteString(goal)
+
+	if feedback != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(feedback)
+	}
+
+	sb.WriteString("\n\nReply with JSON only, in this format:\n")
+	sb.WriteString(`{"done": false, "answer": "", "tasks": [{"capability": "<capability>", "description": "<what to do>"}]}`)
+	sb.WriteString("\nWhen the results are sufficient, set done to true and put the final answer in answer.")
+
+	return sb.String()
+}
+
+// buildTeamFeedback 将一轮子任务的结果整理为主管下一轮的输入
+func buildTeamFeedback(tasks []TeamTask) string {
+	var sb strings.Builder
+	sb.WriteString("Results of the previous round:")
+	for _, task := range tasks {
+		sb.WriteString(fmt.Sprintf("\n\n[%s] %s (%s)\n", task.Capability, task.Description, task.Status))
+		if task.Error != "" {
+			sb.WriteString("Error: " + task.Error)
+		} else {
+			sb.WriteString(task.Result)
+		}
+	}
+	return sb.String()
+}
+
+// Status 返回团队的整体状态，包括每个子任务和每个成员的状态
+func (t *Team) Status(ctx context.Context) TeamStatus {
+	t.mu.Lock()
+	status := t.status
+	status.Tasks = append([]TeamTask(nil), t.status.Tasks...)
+	members := []string{t.supervisor}
+	for _, worker := range t.workers {
+		members = append(members, worker.id)
+	}
+	t.mu.Unlock()
+
+	status.Agents = make(map[string]types.AgentStatus, len(members))
+	for _, id := range members {
+		if agentStatus, err := t.manager.GetAgentStatus(ctx, id); err == nil {
+			status.Agents[id] = agentStatus
+		}
+	}
+	return status
+}
+
+// Destroy 销毁团队的所有成员
+func (t *Team) Destroy(ctx context.Context) error {
+	members := []string{t.supervisor}
+	for _, worker := range t.workers {
+		members = append(members, worker.id)
+	}
+
+	var firstErr error
+	for _, id := range members {
+		if id == "" {
+			continue
+		}
+		if err := t.manager.DestroyAgent(ctx, id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTeamRun(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeProvider(
+		`{"done": false, "tasks": [{"capability": "search", "description": "find sources"}, {"capability": "write", "description": "draft summary"}, {"capability": "paint", "description": "draw a chart"}]}`,
+		"worker result",
+		"worker result",
+		`Here is my decision: {"done": true, "answer": "final report"}`,
+	)
+	mgr := newTestManager(t, provider)
+
+	team, err := NewTeam(ctx, mgr, TeamConfig{
+		ID:         "research",
+		Supervisor: AgentConfig{Model: ModelConfig{Type: "fake-model"}},
+		Workers: []AgentConfig{
+			{Capabilities: []string{"search"}, Model: ModelConfig{Type: "fake-model"}},
+			{Capabilities: []string{"write", "search"}, Model: ModelConfig{Type: "fake-model"}},
+		},
+		Concurrency: 1,
+	})
+	if err != nil {
+		t.Fatalf("创建团队失败: %v", err)
+	}
+	defer team.Destroy(ctx)
+
+	answer, err := team.Run(ctx, "summarize recent work on agents")
+	if err != nil {
+		t.Fatalf("团队执行失败: %v", err)
+	}
+	if answer != "final report" {
+		t.Errorf("期望最终答案为final report，实际为 %q", answer)
+	}
+
+	status := team.Status(ctx)
+	if status.Status != "completed" || status.Round != 2 || len(status.Tasks) != 3 {
+		t.Fatalf("团队状态不正确: %+v", status)
+	}
+	if len(status.Agents) != 3 {
+		t.Errorf("期望团队状态包含3个成员，实际为 %d 个", len(status.Agents))
+	}
+
+	// 子任务按能力分配，没有对应能力的子任务失败
+	want := map[string]string{"search": "research.worker-1", "write": "research.worker-2"}
+	for _, task := range status.Tasks {
+		if task.Capability == "paint" {
+			if task.Status != "failed" || !strings.Contains(task.Error, ErrNoCapableAgent.Error()) {
+				t.Errorf("期望没有对应能力的子任务失败，实际为 %+v", task)
+			}
+			continue
+		}
+		if task.AgentID != want[task.Capability] || task.Status != "completed" || task.Result != "worker result" {
+			t.Errorf("子任务执行不正确: %+v", task)
+		}
+	}
+
+	// 子任务记录了来自主管的委托，主管在下一轮收到了全部结果
+	taskStatus, _ := mgr.GetTaskStatus(ctx, status.Tasks[0].ID)
+	if len(taskStatus.Delegation) != 1 || taskStatus.Delegation[0].AgentID != "research.supervisor" {
+		t.Errorf("子任务缺少委托链: %+v", taskStatus.Delegation)
+	}
+	prompt := provider.lastRequest().Messages[1].Content
+	if !strings.Contains(prompt, "draft summary (completed)") || !strings.Contains(prompt, "no agent with required capability") {
+		t.Errorf("主管未收到上一轮的结果: %s", prompt)
+	}
+}
+
+func TestTeamIncomplete(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider("not json", "still not json", `{"done": fals`))
+
+	team, err := NewTeam(ctx, mgr, TeamConfig{
+		Supervisor: AgentConfig{Model: ModelConfig{Type: "fake-model"}},
+		Workers:    []AgentConfig{{Capabilities: []string{"search"}, Model: ModelConfig{Type: "fake-model"}}},
+		MaxRounds:  2,
+	})
+	if err != nil {
+		t.Fatalf("创建团队失败: %v", err)
+	}
+	defer team.Destroy(ctx)
+
+	// 无法解析的回复不计入轮数，单独限制重试次数
+	if _, err := team.Run(ctx, "goal"); !errors.Is(err, ErrTeamIncomplete) || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("期望团队未完成错误，实际得到 %v", err)
+	}
+	if status := team.Status(ctx); status.Status != "failed" || status.Round != 1 {
+		t.Errorf("团队状态不正确: %+v", status)
+	}
+
+	if _, err := NewTeam(ctx, mgr, TeamConfig{Supervisor: AgentConfig{Model: ModelConfig{Type: "fake-model"}}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("期望没有工作者时创建失败，实际得到 %v", err)
+	}
+}
+
+func TestTeamMalformedPlan(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeProvider(
+		`{"done": false, "tasks": [{"capability": "search", "description": "find sources"}]}`,
+		"worker result",
+		"I think we are done.",
+		`{"done": true, "answer": "final report"}`,
+	)
+	mgr := newTestManager(t, provider)
+
+	team, err := NewTeam(ctx, mgr, TeamConfig{
+		Supervisor: AgentConfig{Model: ModelConfig{Type: "fake-model"}},
+		Workers:    []AgentConfig{{Capabilities: []string{"search"}, Model: ModelConfig{Type: "fake-model"}}},
+		MaxRounds:  2,
+	})
+	if err != nil {
+		t.Fatalf("创建团队失败: %v", err)
+	}
+	defer team.Destroy(ctx)
+
+	answer, err := team.Run(ctx, "goal")
+	if err != nil || answer != "final report" {
+		t.Fatalf("期望重新回复后完成，实际得到 %q，错误 %v", answer, err)
+	}
+	if status := team.Status(ctx); status.Round != 2 {
+		t.Errorf("无法解析的回复不应计入轮数: %+v", status)
+	}
+
+	// 重新回复的提示保留上一轮的结果，并附上解析错误
+	prompt := provider.lastRequest().Messages[1].Content
+	if !strings.Contains(prompt, "find sources (completed)") || !strings.Contains(prompt, "no JSON object in reply") {
+		t.Errorf("重新回复的提示不正确: %s", prompt)
+	}
+}
+
+func TestTeamFinalEvaluation(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeProvider(
+		`{"done": false, "tasks": []}`,
+		`{"done": false, "tasks": [{"capability": "search", "description": "find sources"}]}`,
+		"worker result",
+		`{"done": true, "answer": "final report"}`,
+	)
+	mgr := newTestManager(t, provider)
+
+	team, err := NewTeam(ctx, mgr, TeamConfig{
+		Supervisor: AgentConfig{Model: ModelConfig{Type: "fake-model"}},
+		Workers:    []AgentConfig{{Capabilities: []string{"search"}, Model: ModelConfig{Type: "fake-model"}}},
+		MaxRounds:  1,
+	})
+	if err != nil {
+		t.Fatalf("创建团队失败: %v", err)
+	}
+	defer team.Destroy(ctx)
+
+	// 没有子任务却未完成的计划视为无法解析，要求主管重新回复
+	// 最后一轮的结果交给主管做最终评估
+	answer, err := team.Run(ctx, "goal")
+	if err != nil || answer != "final report" {
+		t.Fatalf("期望最终评估得出答案，实际得到 %q，错误 %v", answer, err)
+	}
+	history := provider.history()
+	if !strings.Contains(history[1].Messages[1].Content, "no tasks are given") {
+		t.Errorf("重新回复的提示缺少解析错误: %s", history[1].Messages[1].Content)
+	}
+	if prompt := provider.lastRequest().Messages[1].Content; !strings.Contains(prompt, "find sources (completed)") || !strings.Contains(prompt, "last round") {
+		t.Errorf("最终评估的提示不正确: %s", prompt)
+	}
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/hewenyu/Aegis/internal/types"
@@ -14,23 +15,75 @@ type AgentConfig struct {
 	Name         string
 	Description  string
 	Capabilities []string
+	Role         string // Agent的角色，消息和任务委托可以按角色选择接收方
 	Model        ModelConfig
 	Tools        []ToolConfig
 	Memory       types.MemoryConfig
 	Knowledge    KnowledgeConfig
+	MaxSteps     int // 工具调用推理循环的最大步数，默认为5
+	Pause        PauseConfig
+	Queue        QueueConfig
+	Retry        types.RetryPolicy // 任务默认的重试策略
+	Recovery     RecoveryPolicy    // 重启后如何处理中断的任务
+	Budget       BudgetConfig
+	Approval     ApprovalConfig // 需要审批的工具调用如何等待决定
+}
+
+// RecoveryPolicy 定义了进程重启后如何处理执行中被中断的任务。
+// 尚未开始执行的任务总是重新入队
+type RecoveryPolicy string
+
+// 预定义恢复策略
+const (
+	RecoverRequeue RecoveryPolicy = "requeue" // 重新执行中断的任务（默认）
+	RecoverFail    RecoveryPolicy = "fail"    // 将中断的任务标记为失败
+)
+
+// BudgetConfig 定义了Agent模型调用的资源预算
+type BudgetConfig struct {
+	Total      types.Budget // Agent累计可用的资源
+	Task       types.Budget // 每个任务默认可用的资源，可被Task.Budget覆盖
+	OnExceeded BudgetAction // 超出Agent累计预算时的处理方式，超出任务预算的任务总是失败
+}
+
+// BudgetAction 定义了超出预算时如何处理任务
+type BudgetAction string
+
+// 预定义预算处理方式
+const (
+	BudgetFail  BudgetAction = "fail"  // 任务以ErrBudgetExceeded失败（默认）
+	BudgetPause BudgetAction = "pause" // 暂停Agent并将任务放回队列，调整预算后恢复执行
+)
+
+// QueueConfig 定义了Agent任务队列的配置
+type QueueConfig struct {
+	Capacity      int    // 队列容量，默认为10
+	BlockWhenFull bool   // 队列已满时阻塞等待空位，默认直接返回ErrQueueFull
+	Concurrency   int    // 并发执行任务的工作协程数，默认为1
+	Ordering      string // 任务排序方式，默认为"priority"，可用RegisterTaskOrdering注册自定义排序
+}
+
+// PauseConfig 定义了Agent暂停时的行为
+type PauseConfig struct {
+	RejectTasks bool // 暂停期间拒绝分配新任务，默认排队等待恢复
+	Checkpoint  bool // 暂停时中断正在执行的任务，恢复后重新执行；默认等待其执行完毕
 }
 
 // ModelConfig 定义了AI模型的配置
 type ModelConfig struct {
-	Type        string
-	Temperature float64
-	MaxTokens   int
+	Provider     string // LLM提供者名称，为空时使用唯一注册的提供者
+	Type         string // 模型名称
+	Temperature  float64
+	MaxTokens    int
+	SystemPrompt string
+	NativeTools  bool // 使用模型原生的工具调用能力，而不是ReAct文本协议
 }
 
 // ToolConfig 定义了Agent要使用的工具配置
 type ToolConfig struct {
-	ID     string
-	Config map[string]interface{}
+	ID              string
+	Config          map[string]interface{} // Agent专属配置，仅实现了tool.Configurable的工具可以接受
+	RequireApproval bool                   // 调用前需要人工审批，工具元数据中声明了需要审批时总是需要
 }
 
 // KnowledgeConfig 定义了Agent知识库的配置
@@ -46,23 +99,57 @@ type Manager interface {
 	DestroyAgent(ctx context.Context, agentID string) error
 	PauseAgent(ctx context.Context, agentID string) error
 	ResumeAgent(ctx context.Context, agentID string) error
+	SnapshotAgent(ctx context.Context, agentID string, w io.Writer) error
+	RestoreAgent(ctx context.Context, r io.Reader, opts RestoreOptions) (types.Agent, error)
+
+	// 任务处理器
+	RegisterTaskHandler(ctx context.Context, agentID string, taskType string, handler TaskHandler) error
+
+	// 中间件
+	RegisterMiddleware(ctx context.Context, agentID string, mw Middleware) error
 
 	// 任务管理
 	AssignTask(ctx context.Context, agentID string, task types.Task) error
 	CancelTask(ctx context.Context, taskID string) error
 	GetTaskStatus(ctx context.Context, taskID string) (types.TaskStatus, error)
+	WaitTask(ctx context.Context, taskID string) (types.TaskStatus, error)
+	StreamTask(ctx context.Context, taskID string) (<-chan TaskChunk, error)
+
+	// 工作流管理
+	SubmitWorkflow(ctx context.Context, workflow Workflow) (string, error)
+	GetWorkflowStatus(ctx context.Context, workflowID string) (WorkflowStatus, error)
+	WaitWorkflow(ctx context.Context, workflowID string) (WorkflowStatus, error)
+
+	// 协作
+	SendMessage(ctx context.Context, msg Message) (string, error)
+	ReceiveMessage(ctx context.Context, agentID string) (Message, error)
+	RequestMessage(ctx context.Context, msg Message) (Message, error)
+	ReplyMessage(ctx context.Context, request Message, msgType string, payload interface{}) error
+	DelegateTask(ctx context.Context, delegation Delegation) (types.TaskStatus, error)
 
 	// 状态监控
 	GetAgentStatus(ctx context.Context, agentID string) (types.AgentStatus, error)
 	SubscribeToEvents(ctx context.Context, agentID string) (<-chan Event, error)
+	Subscribe(ctx context.Context, opts SubscribeOptions) (*Subscription, error)
+	ReplayEvents(ctx context.Context, query EventQuery) ([]Event, error)
+
+	// 资源预算
+	SetBudget(ctx context.Context, agentID string, budget BudgetConfig) error
+
+	// 工具调用审批
+	PendingApprovals(ctx context.Context, agentID string) ([]ApprovalRequest, error)
+	ResolveApproval(ctx context.Context, approvalID string, decision ApprovalDecision) error
 }
 
 // Event 代表Agent产生的事件
 type Event struct {
-	ID        string
-	Type      string
-	Data      interface{}
-	Timestamp time.Time
+	ID        string      `json:"id"`
+	Seq       uint64      `json:"seq"` // 事件总线分配的递增序号
+	AgentID   string      `json:"agent_id,omitempty"`
+	TaskID    string      `json:"task_id,omitempty"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
 }
 
 func NewEvent(id string, t string, data interface{}) *Event {
@@ -76,8 +163,36 @@ func NewEvent(id string, t string, data interface{}) *Event {
 
 // 错误定义
 var (
-	ErrAgentNotFound = errors.New("agent not found")
-	ErrTaskNotFound  = errors.New("task not found")
-	ErrInvalidConfig = errors.New("invalid configuration")
-	ErrTaskFailed    = errors.New("task execution failed")
+	ErrAgentNotFound       = errors.New("agent not found")
+	ErrTaskNotFound        = errors.New("task not found")
+	ErrInvalidConfig       = errors.New("invalid configuration")
+	ErrTaskFailed          = errors.New("task execution failed")
+	ErrMaxSteps            = errors.New("reasoning step limit reached")
+	ErrQueueFull           = errors.New("task queue is full")
+	ErrRuntimeStopped      = errors.New("agent runtime stopped")
+	ErrTaskAbandoned       = errors.New("task abandoned during shutdown")
+	ErrAgentPaused         = errors.New("agent is paused")
+	ErrUnknownTaskType     = errors.New("unknown task type")
+	ErrHandlerExists       = errors.New("task handler already registered")
+	ErrTaskInterrupted     = errors.New("task interrupted by restart")
+	ErrInvalidWorkflow     = errors.New("invalid workflow")
+	ErrWorkflowNotFound    = errors.New("workflow not found")
+	ErrWorkflowNodeSkipped = errors.New("workflow node skipped")
+	ErrInvalidSchedule     = errors.New("invalid schedule")
+	ErrScheduleNotFound    = errors.New("schedule not found")
+	ErrJournalDisabled     = errors.New("event journal not configured")
+	ErrNoAgentForRole      = errors.New("no agent with requested role")
+	ErrDelegationTooDeep   = errors.New("delegation chain too deep")
+	ErrDelegationCycle     = errors.New("delegation cycle")
+	ErrNoCapableAgent      = errors.New("no agent with required capability")
+	ErrTeamBusy            = errors.New("team is already running a goal")
+	ErrTeamIncomplete      = errors.New("team did not reach the goal")
+	ErrBudgetExceeded      = errors.New("resource budget exceeded")
+	ErrApprovalNotFound    = errors.New("approval request not found")
+	ErrApprovalRejected    = errors.New("tool call rejected")
+	ErrApprovalTimeout     = errors.New("tool call approval timed out")
+	ErrInvalidSnapshot     = errors.New("invalid agent snapshot")
+	ErrCassetteMismatch    = errors.New("no recorded interaction matches the request")
+	ErrMiddlewareExists    = errors.New("middleware already registered")
+	ErrAborted             = errors.New("aborted by middleware")
 )
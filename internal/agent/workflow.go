@@ -0,0 +1,435 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// Workflow 是由存在依赖关系的任务组成的有向无环图
+type Workflow struct {
+	ID             string
+	Nodes          []WorkflowNode
+	AbortOnFailure bool // 任一节点失败时取消所有未完成的节点，默认只跳过失败节点的下游节点
+}
+
+// WorkflowNode 是工作流中的一个任务节点
+type WorkflowNode struct {
+	ID        string     // 节点ID，在工作流内唯一，不能包含"."
+	AgentID   string     // 执行任务的Agent
+	Task      types.Task // 任务ID为空时使用"工作流ID.节点ID"
+	DependsOn []string   // 上游节点ID
+	// Inputs 将上游节点的输出映射为任务参数，键为参数名，
+	// 值为"节点ID"（整个结果数据）或"节点ID.字段"（结果数据中的字段）
+	Inputs map[string]string
+}
+
+// WorkflowStatus 代表工作流的当前状态
+type WorkflowStatus struct {
+	ID        string
+	Status    string  // running、completed或failed
+	Progress  float64 // 已结束节点所占比例
+	Nodes     map[string]types.TaskStatus
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// dependenciesParam 是下游任务中存放所有上游节点输出的参数名
+const dependenciesParam = "dependencies"
+
+// workflowRun 是正在执行的工作流
+type workflowRun struct {
+	workflow   Workflow
+	nodes      map[string]*WorkflowNode
+	dependents map[string][]string // 节点ID -> 下游节点ID
+	mu         sync.Mutex
+	status     WorkflowStatus
+	outputs    map[string]interface{} // 节点ID -> 结果数据
+	done       chan struct{}
+}
+
+// nodeResult 是节点执行结束的通知
+type nodeResult struct {
+	nodeID string
+	status types.TaskStatus
+}
+
+// SubmitWorkflow 提交工作流，依赖满足的节点并行执行，返回工作流ID
+func (m *manager) SubmitWorkflow(ctx context.Context, workflow Workflow) (string, error) {
+	if workflow.ID == "" {
+		workflow.ID = uuid.New().String()
+	}
+
+	run, err := m.newWorkflowRun(workflow)
+	if err != nil {
+		return "", err
+	}
+
+	if _, loaded := m.workflows.LoadOrStore(workflow.ID, run); loaded {
+		return "", fmt.Errorf("%w: workflow %s already exists", ErrInvalidWorkflow, workflow.ID)
+	}
+
+	go m.runWorkflow(context.WithoutCancel(ctx), run)
+
+	return workflow.ID, nil
+}
+
+// GetWorkflowStatus 获取工作流状态
+func (m *manager) GetWorkflowStatus(ctx context.Context, workflowID string) (WorkflowStatus, error) {
+	runI, ok := m.workflows.Load(workflowID)
+	if !ok {
+		return WorkflowStatus{}, ErrWorkflowNotFound
+	}
+	return runI.(*workflowRun).snapshot(), nil
+}
+
+// WaitWorkflow 等待工作流结束并返回最终状态
+func (m *manager) WaitWorkflow(ctx context.Context, workflowID string) (WorkflowStatus, error) {
+	runI, ok := m.workflows.Load(workflowID)
+	if !ok {
+		return WorkflowStatus{}, ErrWorkflowNotFound
+	}
+
+	run := runI.(*workflowRun)
+	select {
+	case <-run.done:
+		return run.snapshot(), nil
+	case <-ctx.Done():
+		return WorkflowStatus{}, ctx.Err()
+	}
+}
+
+// newWorkflowRun 校验工作流并创建执行状态
+func (m *manager) newWorkflowRun(workflow Workflow) (*workflowRun, error) {
+	if len(workflow.Nodes) == 0 {
+		return nil, fmt.Errorf("%w: workflow has no nodes", ErrInvalidWorkflow)
+	}
+
+	run := &workflowRun{
+		workflow:   workflow,
+		nodes:      make(map[string]*WorkflowNode, len(workflow.Nodes)),
+		dependents: make(map[string][]string),
+		outputs:    make(map[string]interface{}),
+		done:       make(chan struct{}),
+		status: WorkflowStatus{
+			ID:        workflow.ID,
+			Status:    "running",
+			Nodes:     make(map[string]types.TaskStatus, len(workflow.Nodes)),
+			StartTime: time.Now(),
+		},
+	}
+
+	for i := range workflow.Nodes {
+		node := &workflow.Nodes[i]
+		if node.ID == "" {
+			return nil, fmt.Errorf("%w: node %d has no id", ErrInvalidWorkflow, i)
+		}
+		if strings.Contains(node.ID, ".") {
+			// Inputs以"节点ID.字段"引用上游结果，节点ID中的"."会使引用产生歧义
+			return nil, fmt.Errorf("%w: node id %q must not contain '.'", ErrInvalidWorkflow, node.ID)
+		}
+		if _, ok := run.nodes[node.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate node %s", ErrInvalidWorkflow, node.ID)
+		}
+		if _, ok := m.agents.Load(node.AgentID); !ok {
+			return nil, fmt.Errorf("%w: node %s: %v", ErrInvalidWorkflow, node.ID, ErrAgentNotFound)
+		}
+		if node.Task.ID == "" {
+			node.Task.ID = workflow.ID + "." + node.ID
+		}
+		run.nodes[node.ID] = node
+		run.status.Nodes[node.ID] = types.TaskStatus{ID: node.Task.ID, Status: "pending"}
+	}
+
+	for _, node := range run.nodes {
+		for _, dep := range node.DependsOn {
+			if _, ok := run.nodes[dep]; !ok {
+				return nil, fmt.Errorf("%w: node %s depends on unknown node %s", ErrInvalidWorkflow, node.ID, dep)
+			}
+			run.dependents[dep] = append(run.dependents[dep], node.ID)
+		}
+		for param, ref := range node.Inputs {
+			source, _, _ := strings.Cut(ref, ".")
+			if !containsString(node.DependsOn, source) {
+				return nil, fmt.Errorf("%w: input %s of node %s must reference an upstream node", ErrInvalidWorkflow, param, node.ID)
+			}
+		}
+	}
+
+	if err := checkAcyclic(run.nodes); err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// checkAcyclic 使用拓扑排序检查工作流中是否存在环
+func checkAcyclic(nodes map[string]*WorkflowNode) error {
+	indegree := make(map[string]int, len(nodes))
+	dependents := make(map[string][]string)
+	for id, node := range nodes {
+		indegree[id] = len(node.DependsOn)
+		for _, dep := range node.DependsOn {
+			dependents[dep] = append(dependents[dep], id)
+		}
+	}
+
+	var queue []string
+	for id, n := range indegree {
+		if n == 0 {
+			queue = append(queue, id)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, next := range dependents[id] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if visited != len(nodes) {
+		return fmt.Errorf("%w: dependency cycle detected", ErrInvalidWorkflow)
+	}
+	return nil
+}
+
+// runWorkflow 按依赖关系调度工作流节点，直到所有节点结束
+func (m *manager) runWorkflow(ctx context.Context, run *workflowRun) {
+	defer close(run.done)
+
+	remaining := make(map[string]int, len(run.nodes))
+	for id, node := range run.nodes {
+		remaining[id] = len(node.DependsOn)
+	}
+
+	results := make(chan nodeResult, len(run.nodes))
+	running := make(map[string]bool)
+	finished := 0
+
+	start := func(id string) {
+		node := run.nodes[id]
+		task := run.prepareTask(node)
+
+		if err := m.AssignTask(ctx, node.AgentID, task); err != nil {
+			results <- nodeResult{nodeID: id, status: types.TaskStatus{ID: task.ID, Status: "failed", Error: err, EndTime: time.Now()}}
+			running[id] = true
+			return
+		}
+
+		running[id] = true
+		run.setNode(id, types.TaskStatus{ID: task.ID, Status: "running", StartTime: time.Now()})
+
+		go func() {
+			status, err := m.WaitTask(ctx, task.ID)
+			if err != nil {
+				status = types.TaskStatus{ID: task.ID, Status: "failed", Error: err, EndTime: time.Now()}
+			}
+			results <- nodeResult{nodeID: id, status: status}
+		}()
+	}
+
+	for id, n := range remaining {
+		if n == 0 {
+			start(id)
+		}
+	}
+
+	for finished < len(run.nodes) {
+		if len(running) == 0 {
+			break // 剩余节点均已跳过
+		}
+
+		result := <-results
+		delete(running, result.nodeID)
+		finished++
+		run.setNode(result.nodeID, result.status)
+
+		if result.status.Status == "completed" {
+			if data, ok := result.status.Result.(types.Result); ok {
+				run.setOutput(result.nodeID, data.Data)
+			} else {
+				run.setOutput(result.nodeID, result.status.Result)
+			}
+
+			for _, next := range run.dependents[result.nodeID] {
+				remaining[next]--
+				if remaining[next] == 0 && !run.isSkipped(next) {
+					start(next)
+				}
+			}
+			continue
+		}
+
+		// 节点失败时跳过所有下游节点，配置了AbortOnFailure时取消整个工作流
+		if run.workflow.AbortOnFailure {
+			for id := range running {
+				m.CancelTask(ctx, run.nodes[id].Task.ID)
+			}
+			finished += run.skipPending(result.nodeID, running)
+		} else {
+			finished += run.skipDependents(result.nodeID)
+		}
+	}
+
+	run.finish()
+}
+
+// prepareTask 将上游节点的输出注入任务参数
+func (run *workflowRun) prepareTask(node *WorkflowNode) types.Task {
+	task := node.Task
+	if len(node.DependsOn) == 0 {
+		return task
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	params := make(map[string]interface{}, len(task.Parameters)+len(node.Inputs)+1)
+	for k, v := range task.Parameters {
+		params[k] = v
+	}
+
+	dependencies := make(map[string]interface{}, len(node.DependsOn))
+	for _, dep := range node.DependsOn {
+		dependencies[dep] = run.outputs[dep]
+	}
+	params[dependenciesParam] = dependencies
+
+	for param, ref := range node.Inputs {
+		source, field, hasField := strings.Cut(ref, ".")
+		value := run.outputs[source]
+		if hasField {
+			data, _ := value.(map[string]interface{})
+			value = data[field]
+		}
+		params[param] = value
+	}
+
+	task.Parameters = params
+	return task
+}
+
+// skipDependents 将失败节点的所有下游节点标记为跳过，返回新跳过的节点数
+func (run *workflowRun) skipDependents(nodeID string) int {
+	skipped := 0
+	queue := append([]string(nil), run.dependents[nodeID]...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if run.isSkipped(id) {
+			continue
+		}
+		run.skip(id, nodeID)
+		skipped++
+		queue = append(queue, run.dependents[id]...)
+	}
+	return skipped
+}
+
+// skipPending 将所有尚未开始的节点标记为跳过，返回新跳过的节点数
+func (run *workflowRun) skipPending(nodeID string, running map[string]bool) int {
+	skipped := 0
+	for id := range run.nodes {
+		if running[id] || run.nodeStatus(id) != "pending" {
+			continue
+		}
+		run.skip(id, nodeID)
+		skipped++
+	}
+	return skipped
+}
+
+// skip 将节点标记为跳过
+func (run *workflowRun) skip(id, cause string) {
+	run.setNode(id, types.TaskStatus{
+		ID:      run.nodes[id].Task.ID,
+		Status:  "skipped",
+		Error:   fmt.Errorf("%w: upstream node %s did not complete", ErrWorkflowNodeSkipped, cause),
+		EndTime: time.Now(),
+	})
+}
+
+// isSkipped 判断节点是否已被跳过
+func (run *workflowRun) isSkipped(id string) bool {
+	return run.nodeStatus(id) == "skipped"
+}
+
+// nodeStatus 返回节点状态
+func (run *workflowRun) nodeStatus(id string) string {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.status.Nodes[id].Status
+}
+
+// setNode 更新节点状态和工作流进度
+func (run *workflowRun) setNode(id string, status types.TaskStatus) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	run.status.Nodes[id] = status
+
+	finished := 0
+	for _, node := range run.status.Nodes {
+		if isTerminalStatus(node.Status) || node.Status == "skipped" {
+			finished++
+		}
+	}
+	run.status.Progress = float64(finished) / float64(len(run.status.Nodes))
+}
+
+// setOutput 记录节点的输出
+func (run *workflowRun) setOutput(id string, output interface{}) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.outputs[id] = output
+}
+
+// finish 根据节点状态设置工作流的最终状态
+func (run *workflowRun) finish() {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	run.status.Status = "completed"
+	for _, node := range run.status.Nodes {
+		if node.Status != "completed" {
+			run.status.Status = "failed"
+			break
+		}
+	}
+	run.status.EndTime = time.Now()
+}
+
+// snapshot 返回工作流状态的副本
+func (run *workflowRun) snapshot() WorkflowStatus {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	status := run.status
+	status.Nodes = make(map[string]types.TaskStatus, len(run.status.Nodes))
+	for id, node := range run.status.Nodes {
+		status.Nodes[id] = node
+	}
+	return status
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
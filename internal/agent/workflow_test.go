@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// newWorkflowAgent 创建一个可并发执行任务并注册了给定处理器的Agent
+func newWorkflowAgent(t *testing.T, mgr Manager, handlers map[string]HandlerFunc) string {
+	t.Helper()
+
+	ctx := context.Background()
+	agent, err := mgr.CreateAgent(ctx, AgentConfig{
+		Name:  "WorkflowAgent",
+		Model: ModelConfig{Type: "fake-model"},
+		Queue: QueueConfig{Concurrency: 4},
+	})
+	if err != nil {
+		t.Fatalf("创建Agent失败: %v", err)
+	}
+	agentID := agent.Status().ID
+
+	for taskType, fn := range handlers {
+		if err := mgr.RegisterTaskHandler(ctx, agentID, taskType, NewTaskHandler(nil, fn)); err != nil {
+			t.Fatalf("注册处理器失败: %v", err)
+		}
+	}
+	return agentID
+}
+
+func TestWorkflowDependencies(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	agentID := newWorkflowAgent(t, mgr, map[string]HandlerFunc{
+		"ingest": func(ctx context.Context, task types.Task) (types.Result, error) {
+			return types.Result{Data: map[string]interface{}{"text": "raw text"}}, nil
+		},
+		"transform": func(ctx context.Context, task types.Task) (types.Result, error) {
+			// 两个转换节点应并行执行
+			started <- task.ID
+			<-release
+			return types.Result{Data: map[string]interface{}{"text": fmt.Sprintf("%s(%v)", task.Parameters["op"], task.Parameters["input"])}}, nil
+		},
+		"index": func(ctx context.Context, task types.Task) (types.Result, error) {
+			deps := task.Parameters[dependenciesParam].(map[string]interface{})
+			return types.Result{Data: fmt.Sprintf("%v|%v", task.Parameters["summary"], len(deps))}, nil
+		},
+	})
+
+	workflowID, err := mgr.SubmitWorkflow(ctx, Workflow{
+		ID: "pipeline",
+		Nodes: []WorkflowNode{
+			{ID: "ingest", AgentID: agentID, Task: types.Task{Type: "ingest"}},
+			{ID: "summarize", AgentID: agentID, Task: types.Task{Type: "transform", Parameters: map[string]interface{}{"op": "summarize"}},
+				DependsOn: []string{"ingest"}, Inputs: map[string]string{"input": "ingest.text"}},
+			{ID: "translate", AgentID: agentID, Task: types.Task{Type: "transform", Parameters: map[string]interface{}{"op": "translate"}},
+				DependsOn: []string{"ingest"}, Inputs: map[string]string{"input": "ingest.text"}},
+			{ID: "index", AgentID: agentID, Task: types.Task{Type: "index"},
+				DependsOn: []string{"summarize", "translate"}, Inputs: map[string]string{"summary": "summarize.text"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("提交工作流失败: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("依赖满足的节点没有并行执行")
+		}
+	}
+	if status, _ := mgr.GetWorkflowStatus(ctx, workflowID); status.Status != "running" || status.Progress != 0.25 {
+		t.Errorf("期望工作流执行中且进度为0.25，实际状态 %s，进度 %v", status.Status, status.Progress)
+	}
+	close(release)
+
+	status, err := mgr.WaitWorkflow(ctx, workflowID)
+	if err != nil {
+		t.Fatalf("等待工作流失败: %v", err)
+	}
+	if status.Status != "completed" || status.Progress != 1 {
+		t.Fatalf("期望工作流完成，实际状态 %s，进度 %v", status.Status, status.Progress)
+	}
+
+	index := status.Nodes["index"]
+	if index.ID != "pipeline.index" {
+		t.Errorf("节点任务ID不正确: %s", index.ID)
+	}
+	if data := index.Result.(types.Result).Data; data != "summarize(raw text)|2" {
+		t.Errorf("下游节点未收到上游输出: %v", data)
+	}
+}
+
+func TestWorkflowFailureSkipsDependents(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+	agentID := newWorkflowAgent(t, mgr, map[string]HandlerFunc{
+		"ok": func(ctx context.Context, task types.Task) (types.Result, error) {
+			return types.Result{Data: task.ID}, nil
+		},
+		"fail": func(ctx context.Context, task types.Task) (types.Result, error) {
+			return types.Result{}, errors.New("boom")
+		},
+	})
+
+	workflowID, err := mgr.SubmitWorkflow(ctx, Workflow{
+		Nodes: []WorkflowNode{
+			{ID: "broken", AgentID: agentID, Task: types.Task{Type: "fail"}},
+			{ID: "child", AgentID: agentID, Task: types.Task{Type: "ok"}, DependsOn: []string{"broken"}},
+			{ID: "grandchild", AgentID: agentID, Task: types.Task{Type: "ok"}, DependsOn: []string{"child"}},
+			{ID: "independent", AgentID: agentID, Task: types.Task{Type: "ok"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("提交工作流失败: %v", err)
+	}
+
+	status, err := mgr.WaitWorkflow(ctx, workflowID)
+	if err != nil {
+		t.Fatalf("等待工作流失败: %v", err)
+	}
+	if status.Status != "failed" {
+		t.Errorf("期望工作流失败，实际状态 %s", status.Status)
+	}
+
+	want := map[string]string{"broken": "failed", "child": "skipped", "grandchild": "skipped", "independent": "completed"}
+	for id, expected := range want {
+		if status.Nodes[id].Status != expected {
+			t.Errorf("节点 %s 期望状态 %s，实际状态 %s", id, expected, status.Nodes[id].Status)
+		}
+	}
+	if !errors.Is(status.Nodes["grandchild"].Error, ErrWorkflowNodeSkipped) {
+		t.Errorf("跳过的节点错误不正确: %v", status.Nodes["grandchild"].Error)
+	}
+}
+
+func TestWorkflowValidation(t *testing.T) {
+	ctx := context.Background()
+	mgr := newTestManager(t, newFakeProvider())
+	agentID := createTestAgent(t, mgr)
+
+	testCases := []struct {
+		name  string
+		nodes []WorkflowNode
+	}{
+		{name: "循环依赖", nodes: []WorkflowNode{
+			{ID: "a", AgentID: agentID, DependsOn: []string{"b"}},
+			{ID: "b", AgentID: agentID, DependsOn: []string{"a"}},
+		}},
+		{name: "未知依赖", nodes: []WorkflowNode{{ID: "a", AgentID: agentID, DependsOn: []string{"missing"}}}},
+		{name: "未知Agent", nodes: []WorkflowNode{{ID: "a", AgentID: "missing"}}},
+		{name: "节点ID包含点", nodes: []WorkflowNode{
+			{ID: "fetch.v2", AgentID: agentID},
+			{ID: "b", AgentID: agentID, DependsOn: []string{"fetch.v2"}, Inputs: map[string]string{"input": "fetch.v2"}},
+		}},
+		{name: "输入引用非上游节点", nodes: []WorkflowNode{
+			{ID: "a", AgentID: agentID},
+			{ID: "b", AgentID: agentID, Inputs: map[string]string{"input": "a.text"}},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := mgr.SubmitWorkflow(ctx, Workflow{Nodes: tc.nodes}); !errors.Is(err, ErrInvalidWorkflow) {
+				t.Errorf("期望无效工作流错误，实际得到 %v", err)
+			}
+		})
+	}
+}
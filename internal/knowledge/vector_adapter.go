@@ -22,6 +22,14 @@ func NewVectorAdapter(store types.VectorStore, collection string) *VectorAdapter
 	}
 }
 
+// Collection 实现 text.CollectionStore 接口，返回写入同一存储中另一集合的适配器
+func (a *VectorAdapter) Collection(name string) (text.VectorStore, error) {
+	if name == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	return NewVectorAdapter(a.store, name), nil
+}
+
 // Store 实现 text.VectorStore 接口
 func (a *VectorAdapter) Store(ctx context.Context, id string, vector []float32, metadata map[string]interface{}) error {
 	doc := types.Document{
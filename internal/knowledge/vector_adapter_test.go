@@ -0,0 +1,50 @@
+package knowledge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+	"github.com/hewenyu/Aegis/internal/tool/text"
+)
+
+// lengthEmbedder 以文本长度作为一维向量
+type lengthEmbedder struct{}
+
+func (lengthEmbedder) Embed(ctx context.Context, content string) ([]float32, error) {
+	return []float32{float32(len(content))}, nil
+}
+
+func TestVectorAdapterCollection(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryVectorStore(NewMockEmbedder(1))
+	shared := text.NewVectorizerTool(lengthEmbedder{}, NewVectorAdapter(store, "default"))
+
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	if err := os.WriteFile(path, []byte("A short document."), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	// 按Agent配置的集合写入同一存储中的另一集合
+	configured, err := tool.Configure(shared, map[string]interface{}{"collection": "agent-docs"})
+	if err != nil {
+		t.Fatalf("配置集合失败: %v", err)
+	}
+	if _, err := configured.Execute(ctx, map[string]interface{}{"file_path": path}); err != nil {
+		t.Fatalf("执行工具失败: %v", err)
+	}
+
+	collections, err := store.ListCollections(ctx)
+	if err != nil {
+		t.Fatalf("列出集合失败: %v", err)
+	}
+	if len(collections) != 1 || collections[0] != "agent-docs" {
+		t.Errorf("期望只写入agent-docs集合，实际为 %v", collections)
+	}
+
+	if _, err := NewVectorAdapter(store, "default").Collection(""); err == nil {
+		t.Error("期望拒绝空的集合名")
+	}
+}
@@ -2,7 +2,9 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -83,6 +85,9 @@ func (p *OllamaProvider) Complete(ctx context.Context, modelID string, request t
 	if len(request.Stop) > 0 {
 		options["stop"] = request.Stop
 	}
+	if request.MaxTokens > 0 {
+		options["num_predict"] = request.MaxTokens
+	}
 
 	generateRequest := api.GenerateRequest{
 		Model:   modelID,
@@ -101,7 +106,7 @@ func (p *OllamaProvider) Complete(ctx context.Context, modelID string, request t
 	})
 
 	if err != nil {
-		return types.CompletionResponse{}, fmt.Errorf("failed to generate completion: %w", err)
+		return types.CompletionResponse{}, fmt.Errorf("failed to generate completion: %w", classifyError(err))
 	}
 
 	return types.CompletionResponse{
@@ -117,11 +122,17 @@ func (p *OllamaProvider) Complete(ctx context.Context, modelID string, request t
 
 // Chat 处理聊天补全
 func (p *OllamaProvider) Chat(ctx context.Context, modelID string, request types.ChatRequest) (types.ChatResponse, error) {
+	return p.ChatStream(ctx, modelID, request, nil)
+}
+
+// ChatStream 处理流式聊天补全，每个流式分片的文本通过onDelta回调
+func (p *OllamaProvider) ChatStream(ctx context.Context, modelID string, request types.ChatRequest, onDelta func(delta string) error) (types.ChatResponse, error) {
 	messages := make([]api.Message, len(request.Messages))
 	for i, msg := range request.Messages {
 		messages[i] = api.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:      msg.Role,
+			Content:   msg.Content,
+			ToolCalls: toOllamaToolCalls(msg.ToolCalls),
 		}
 	}
 
@@ -132,24 +143,40 @@ func (p *OllamaProvider) Chat(ctx context.Context, modelID string, request types
 	if len(request.Stop) > 0 {
 		options["stop"] = request.Stop
 	}
+	if request.MaxTokens > 0 {
+		options["num_predict"] = request.MaxTokens
+	}
 
 	chatRequest := api.ChatRequest{
 		Model:    modelID,
 		Messages: messages,
+		Tools:    toOllamaTools(request.Tools),
 		Options:  options,
 	}
 
 	var finalResponse api.ChatResponse
 	var responseContent strings.Builder
+	var toolCalls []api.ToolCall
 
 	err := p.client.Chat(ctx, &chatRequest, func(response api.ChatResponse) error {
 		responseContent.WriteString(response.Message.Content)
+		// 工具调用可能出现在任意一个流式分片中
+		toolCalls = append(toolCalls, response.Message.ToolCalls...)
 		finalResponse = response
+		if onDelta != nil && response.Message.Content != "" {
+			if err := onDelta(response.Message.Content); err != nil {
+				return &streamAborted{err}
+			}
+		}
 		return nil
 	})
 
+	var aborted *streamAborted
+	if errors.As(err, &aborted) {
+		return types.ChatResponse{}, aborted.err
+	}
 	if err != nil {
-		return types.ChatResponse{}, fmt.Errorf("failed to generate chat response: %w", err)
+		return types.ChatResponse{}, fmt.Errorf("failed to generate chat response: %w", classifyError(err))
 	}
 
 	// 使用累积的响应内容
@@ -159,8 +186,9 @@ func (p *OllamaProvider) Chat(ctx context.Context, modelID string, request types
 
 	return types.ChatResponse{
 		Message: types.Message{
-			Role:    finalResponse.Message.Role,
-			Content: finalResponse.Message.Content,
+			Role:      finalResponse.Message.Role,
+			Content:   finalResponse.Message.Content,
+			ToolCalls: fromOllamaToolCalls(toolCalls),
 		},
 		Usage: types.Usage{
 			PromptTokens:     finalResponse.PromptEvalCount,
@@ -171,6 +199,15 @@ func (p *OllamaProvider) Chat(ctx context.Context, modelID string, request types
 	}, nil
 }
 
+// streamAborted 包装onDelta返回的错误，与请求本身的错误区分
+type streamAborted struct {
+	err error
+}
+
+func (e *streamAborted) Error() string {
+	return e.err.Error()
+}
+
 // Embed 生成文本的嵌入向量
 func (p *OllamaProvider) Embed(ctx context.Context, modelID string, request types.EmbeddingRequest) (types.EmbeddingResponse, error) {
 	embedRequest := api.EmbeddingRequest{
@@ -180,7 +217,7 @@ func (p *OllamaProvider) Embed(ctx context.Context, modelID string, request type
 
 	response, err := p.client.Embeddings(ctx, &embedRequest)
 	if err != nil {
-		return types.EmbeddingResponse{}, fmt.Errorf("failed to generate embeddings: %w", err)
+		return types.EmbeddingResponse{}, fmt.Errorf("failed to generate embeddings: %w", classifyError(err))
 	}
 
 	return types.EmbeddingResponse{
@@ -191,3 +228,118 @@ func (p *OllamaProvider) Embed(ctx context.Context, modelID string, request type
 		},
 	}, nil
 }
+
+// toOllamaTools 将工具定义转换为Ollama格式
+func toOllamaTools(tools []types.ToolDefinition) api.Tools {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	result := make(api.Tools, len(tools))
+	for i, t := range tools {
+		var fn api.ToolFunction
+		fn.Name = t.Function.Name
+		fn.Description = t.Function.Description
+		fn.Parameters.Type = t.Function.Parameters.Type
+		fn.Parameters.Required = t.Function.Parameters.Required
+		fn.Parameters.Properties = make(map[string]struct {
+			Type        string   `json:"type"`
+			Description string   `json:"description"`
+			Enum        []string `json:"enum,omitempty"`
+		}, len(t.Function.Parameters.Properties))
+		for name, prop := range t.Function.Parameters.Properties {
+			fn.Parameters.Properties[name] = struct {
+				Type        string   `json:"type"`
+				Description string   `json:"description"`
+				Enum        []string `json:"enum,omitempty"`
+			}{
+				Type:        prop.Type,
+				Description: prop.Description,
+				Enum:        prop.Enum,
+			}
+		}
+
+		toolType := t.Type
+		if toolType == "" {
+			toolType = "function"
+		}
+		result[i] = api.Tool{Type: toolType, Function: fn}
+	}
+
+	return result
+}
+
+// toOllamaToolCalls 将工具调用转换为Ollama格式
+func toOllamaToolCalls(calls []types.ToolCall) []api.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	result := make([]api.ToolCall, len(calls))
+	for i, call := range calls {
+		result[i] = api.ToolCall{
+			Function: api.ToolCallFunction{
+				Index:     i,
+				Name:      call.Function.Name,
+				Arguments: api.ToolCallFunctionArguments(call.Function.Arguments),
+			},
+		}
+	}
+
+	return result
+}
+
+// fromOllamaToolCalls 将Ollama的工具调用转换为通用格式
+func fromOllamaToolCalls(calls []api.ToolCall) []types.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	// Ollama不返回调用ID，这里按序号生成以便关联工具结果
+	result := make([]types.ToolCall, len(calls))
+	for i, call := range calls {
+		result[i] = types.ToolCall{
+			ID: fmt.Sprintf("call_%d", i),
+			Function: types.ToolCallFunction{
+				Name:      call.Function.Name,
+				Arguments: map[string]interface{}(call.Function.Arguments),
+			},
+		}
+	}
+
+	return result
+}
+
+// classifyError 将Ollama返回的错误归类为types中定义的错误，便于调用方判断是否可以重试
+func classifyError(err error) error {
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %w", types.ErrRateLimited, err)
+		case statusErr.StatusCode == http.StatusRequestTimeout || statusErr.StatusCode == http.StatusGatewayTimeout:
+			return fmt.Errorf("%w: %w", types.ErrRequestTimeout, err)
+		case statusErr.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("%w: %w", types.ErrLLMNotAvailable, err)
+		case statusErr.StatusCode >= http.StatusBadRequest:
+			return fmt.Errorf("%w: %w", types.ErrInvalidRequest, err)
+		}
+		return err
+	}
+
+	// 调用方取消或超时不做归类
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	// 连接失败等网络错误视为服务暂时不可用
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return fmt.Errorf("%w: %w", types.ErrRequestTimeout, err)
+		}
+		return fmt.Errorf("%w: %w", types.ErrLLMNotAvailable, err)
+	}
+
+	return err
+}
@@ -204,3 +204,105 @@ func TestOllamaProviderError(t *testing.T) {
 		}
 	})
 }
+
+// TestToOllamaTools 测试工具定义转换为Ollama格式
+func TestToOllamaTools(t *testing.T) {
+	weather := types.ToolFunction{
+		Name:        "get_weather",
+		Description: "查询城市天气",
+		Parameters: types.ToolParameters{
+			Type: "object",
+			Properties: map[string]types.ToolProperty{
+				"city": {Type: "string", Description: "城市名称"},
+				"unit": {Type: "string", Description: "温度单位", Enum: []string{"celsius", "fahrenheit"}},
+			},
+			Required: []string{"city"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		tools    []types.ToolDefinition
+		wantType string
+	}{
+		{name: "未指定类型时默认为function", tools: []types.ToolDefinition{{Function: weather}}, wantType: "function"},
+		{name: "保留指定的类型", tools: []types.ToolDefinition{{Type: "custom", Function: weather}}, wantType: "custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toOllamaTools(tt.tools)
+			if len(got) != 1 {
+				t.Fatalf("期望1个工具，实际得到 %d 个", len(got))
+			}
+
+			tool := got[0]
+			if tool.Type != tt.wantType {
+				t.Errorf("期望类型 %s，实际得到 %s", tt.wantType, tool.Type)
+			}
+			fn := tool.Function
+			if fn.Name != weather.Name || fn.Description != weather.Description {
+				t.Errorf("函数名称或描述不正确: %s %s", fn.Name, fn.Description)
+			}
+			if fn.Parameters.Type != "object" || !reflect.DeepEqual(fn.Parameters.Required, []string{"city"}) {
+				t.Errorf("参数类型或必填参数不正确: %s %v", fn.Parameters.Type, fn.Parameters.Required)
+			}
+			if len(fn.Parameters.Properties) != len(weather.Parameters.Properties) {
+				t.Fatalf("期望 %d 个参数，实际得到 %d 个", len(weather.Parameters.Properties), len(fn.Parameters.Properties))
+			}
+			for name, want := range weather.Parameters.Properties {
+				prop := fn.Parameters.Properties[name]
+				if prop.Type != want.Type || prop.Description != want.Description || !reflect.DeepEqual(prop.Enum, want.Enum) {
+					t.Errorf("参数 %s 转换不正确: %+v", name, prop)
+				}
+			}
+		})
+	}
+
+	if got := toOllamaTools(nil); got != nil {
+		t.Errorf("没有工具时期望返回nil，实际得到 %v", got)
+	}
+}
+
+// TestOllamaToolCalls 测试工具调用与Ollama格式之间的转换
+func TestOllamaToolCalls(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []types.ToolCall
+	}{
+		{name: "没有工具调用"},
+		{
+			name: "单个工具调用",
+			calls: []types.ToolCall{
+				{ID: "call_0", Function: types.ToolCallFunction{Name: "get_weather", Arguments: map[string]interface{}{"city": "北京"}}},
+			},
+		},
+		{
+			name: "多个工具调用",
+			calls: []types.ToolCall{
+				{ID: "call_0", Function: types.ToolCallFunction{Name: "get_weather", Arguments: map[string]interface{}{"city": "北京", "unit": "celsius"}}},
+				{ID: "call_1", Function: types.ToolCallFunction{Name: "get_time", Arguments: map[string]interface{}{}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ollamaCalls := toOllamaToolCalls(tt.calls)
+			if len(ollamaCalls) != len(tt.calls) {
+				t.Fatalf("期望 %d 个Ollama工具调用，实际得到 %d 个", len(tt.calls), len(ollamaCalls))
+			}
+			for i, call := range ollamaCalls {
+				if call.Function.Index != i || call.Function.Name != tt.calls[i].Function.Name {
+					t.Errorf("第 %d 个工具调用的序号或名称不正确: %+v", i, call.Function)
+				}
+			}
+
+			// Ollama不返回调用ID，转换回来时按序号生成call_%d
+			got := fromOllamaToolCalls(ollamaCalls)
+			if !reflect.DeepEqual(got, tt.calls) {
+				t.Errorf("期望 %+v，实际得到 %+v", tt.calls, got)
+			}
+		})
+	}
+}
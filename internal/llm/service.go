@@ -120,6 +120,27 @@ func (s *service) Chat(ctx context.Context, providerName, modelID string, reques
 	return provider.Chat(ctx, modelID, request)
 }
 
+// ChatStream 执行流式聊天补全
+func (s *service) ChatStream(ctx context.Context, providerName, modelID string, request types.ChatRequest, onDelta func(delta string) error) (types.ChatResponse, error) {
+	provider, err := s.GetProvider(providerName)
+	if err != nil {
+		return types.ChatResponse{}, err
+	}
+
+	if streaming, ok := provider.(types.StreamingProvider); ok {
+		return streaming.ChatStream(ctx, modelID, request, onDelta)
+	}
+
+	response, err := provider.Chat(ctx, modelID, request)
+	if err != nil || onDelta == nil || response.Message.Content == "" {
+		return response, err
+	}
+	if err := onDelta(response.Message.Content); err != nil {
+		return types.ChatResponse{}, err
+	}
+	return response, nil
+}
+
 // Embed 执行文本嵌入
 func (s *service) Embed(ctx context.Context, providerName, modelID string, request types.EmbeddingRequest) (types.EmbeddingResponse, error) {
 	provider, err := s.GetProvider(providerName)
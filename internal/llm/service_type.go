@@ -29,6 +29,9 @@ type Service interface {
 	// 执行聊天补全
 	Chat(ctx context.Context, providerName, modelID string, request types.ChatRequest) (types.ChatResponse, error)
 
+	// 执行流式聊天补全，提供者不支持流式输出时一次性回调完整的回复
+	ChatStream(ctx context.Context, providerName, modelID string, request types.ChatRequest, onDelta func(delta string) error) (types.ChatResponse, error)
+
 	// 执行文本嵌入
 	Embed(ctx context.Context, providerName, modelID string, request types.EmbeddingRequest) (types.EmbeddingResponse, error)
 }
@@ -59,10 +59,11 @@ func (s *inMemoryStore) Store(ctx context.Context, m types.Memory) error {
 	case types.Working:
 		s.stats.WorkingItems++
 	}
+	total := s.stats.TotalItems
 	s.mu.Unlock()
 
 	// 如果超过最大大小，进行整合
-	if s.stats.TotalItems > s.maxSize {
+	if total > s.maxSize {
 		go s.Consolidate(context.Background())
 	}
 
@@ -76,7 +77,6 @@ func (s *inMemoryStore) Recall(ctx context.Context, query types.MemoryQuery) ([]
 	}
 
 	var result []types.Memory
-	count := 0
 
 	// 遍历所有记忆
 	s.memories.Range(func(key, value interface{}) bool {
@@ -106,17 +106,18 @@ func (s *inMemoryStore) Recall(ctx context.Context, query types.MemoryQuery) ([]
 		}
 
 		result = append(result, m)
-		count++
-
-		// 达到限制时停止
-		return count < query.Limit
+		return true
 	})
 
-	// 按时间排序（最新的优先）
+	// 按时间排序（最新的优先），排序后再截断，保证返回的是最近的记忆
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].Timestamp.After(result[j].Timestamp)
 	})
 
+	if len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+
 	return result, nil
 }
 
@@ -237,6 +238,20 @@ func (s *inMemoryStore) Consolidate(ctx context.Context) error {
 	return nil
 }
 
+// Export 按时间先后返回存储中的所有记忆
+func (s *inMemoryStore) Export(ctx context.Context) ([]types.Memory, error) {
+	var result []types.Memory
+	s.memories.Range(func(key, value interface{}) bool {
+		result = append(result, value.(types.Memory))
+		return true
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return result, nil
+}
+
 // GetStats 获取记忆统计信息
 func (s *inMemoryStore) GetStats(ctx context.Context) (types.MemoryStats, error) {
 	s.mu.RLock()
@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Configure 按配置创建工具的Agent专属实例
+// 配置为空时直接返回原工具；配置会先按工具声明的规格校验并补全默认值
+func Configure(t Tool, config map[string]interface{}) (Tool, error) {
+	if len(config) == 0 {
+		return t, nil
+	}
+
+	configurable, ok := t.(Configurable)
+	if !ok {
+		return nil, fmt.Errorf("%w: tool %s does not accept configuration", ErrInvalidConfig, t.ID())
+	}
+
+	resolved, err := resolveConfig(configurable.ConfigSchema(), config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: tool %s: %v", ErrInvalidConfig, t.ID(), err)
+	}
+
+	configured, err := configurable.WithConfig(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("%w: tool %s: %v", ErrInvalidConfig, t.ID(), err)
+	}
+	if configured == nil || configured.ID() != t.ID() {
+		return nil, fmt.Errorf("%w: tool %s returned an invalid configured instance", ErrInvalidTool, t.ID())
+	}
+
+	return configured, nil
+}
+
+// resolveConfig 校验配置项并返回补全了默认值的配置副本
+func resolveConfig(schema []ParameterSpec, config map[string]interface{}) (map[string]interface{}, error) {
+	known := make(map[string]struct{}, len(schema))
+	for _, spec := range schema {
+		known[spec.Name] = struct{}{}
+	}
+
+	var unknown []string
+	for key := range config {
+		if _, ok := known[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown config key(s) %v", unknown)
+	}
+
+	if err := ValidateParams(schema, config); err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]interface{}, len(schema))
+	for _, spec := range schema {
+		if value, ok := config[spec.Name]; ok && value != nil {
+			resolved[spec.Name] = value
+		} else if spec.Default != nil {
+			resolved[spec.Name] = spec.Default
+		}
+	}
+	return resolved, nil
+}
@@ -3,6 +3,8 @@ package tool
 import (
 	"context"
 	"sync"
+
+	"github.com/hewenyu/Aegis/internal/types"
 )
 
 // Registry 提供工具注册和发现功能
@@ -96,6 +98,16 @@ func (r *Registry) GetMetadata(ctx context.Context, toolID string) (ToolMetadata
 	return metadataI.(ToolMetadata), nil
 }
 
+// ToolDefinition 获取已注册工具的LLM工具定义
+func (r *Registry) ToolDefinition(ctx context.Context, toolID string) (types.ToolDefinition, error) {
+	metadata, err := r.GetMetadata(ctx, toolID)
+	if err != nil {
+		return types.ToolDefinition{}, err
+	}
+
+	return ToToolDefinition(metadata), nil
+}
+
 // FindByCategory 按类别查找工具
 func (r *Registry) FindByCategory(ctx context.Context, category ToolCategory) []string {
 	r.mu.RLock()
@@ -0,0 +1,114 @@
+package tool
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/hewenyu/Aegis/internal/types"
+)
+
+// ToToolDefinition 将工具元数据转换为LLM提供者使用的工具定义
+func ToToolDefinition(metadata ToolMetadata) types.ToolDefinition {
+	properties := make(map[string]types.ToolProperty, len(metadata.Parameters))
+	var required []string
+
+	for _, p := range metadata.Parameters {
+		properties[p.Name] = types.ToolProperty{
+			Type:        schemaType(p.Type),
+			Description: p.Description,
+		}
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+
+	description := metadata.Description
+	if description == "" {
+		description = metadata.Name
+	}
+
+	return types.ToolDefinition{
+		Type: "function",
+		Function: types.ToolFunction{
+			Name:        metadata.ID,
+			Description: description,
+			Parameters: types.ToolParameters{
+				Type:       "object",
+				Properties: properties,
+				Required:   required,
+			},
+		},
+	}
+}
+
+// schemaType 将参数类型映射为JSON Schema类型
+func schemaType(paramType string) string {
+	switch paramType {
+	case "int", "integer":
+		return "integer"
+	case "float", "number":
+		return "number"
+	case "bool", "boolean":
+		return "boolean"
+	case "array", "object":
+		return paramType
+	default:
+		return "string"
+	}
+}
+
+// ValidateParams 按参数规格校验参数：必需参数必须存在，已提供的参数类型必须匹配
+func ValidateParams(specs []ParameterSpec, params map[string]interface{}) error {
+	for _, spec := range specs {
+		value, ok := params[spec.Name]
+		if !ok || value == nil {
+			if spec.Required && spec.Default == nil {
+				return fmt.Errorf("%w: %s is required", ErrInvalidParameter, spec.Name)
+			}
+			continue
+		}
+
+		if !matchesType(spec.Type, value) {
+			return fmt.Errorf("%w: %s must be of type %s, got %T", ErrInvalidParameter, spec.Name, spec.Type, value)
+		}
+	}
+
+	return nil
+}
+
+// matchesType 判断参数值是否符合参数类型，未知类型不做限制
+func matchesType(paramType string, value interface{}) bool {
+	v := reflect.ValueOf(value)
+
+	switch paramType {
+	case "string":
+		return v.Kind() == reflect.String
+	case "int", "integer":
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		case reflect.Float32, reflect.Float64:
+			// JSON数字解码为float64，整数值视为合法
+			return v.Float() == math.Trunc(v.Float())
+		}
+		return false
+	case "float", "number":
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case "bool", "boolean":
+		return v.Kind() == reflect.Bool
+	case "array":
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	case "object":
+		return v.Kind() == reflect.Map || v.Kind() == reflect.Struct
+	default:
+		return true
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/hewenyu/Aegis/internal/tool"
 )
 
 // SummarizerTool 实现论文总结工具
@@ -55,6 +57,27 @@ func (t *SummarizerTool) Version() string {
 	return t.version
 }
 
+// Metadata 返回工具元数据
+func (t *SummarizerTool) Metadata() tool.ToolMetadata {
+	return tool.ToolMetadata{
+		ID:          t.id,
+		Name:        t.name,
+		Description: t.description,
+		Version:     t.version,
+		Categories:  []tool.ToolCategory{tool.CategoryAnalysis, tool.CategoryGeneration},
+		Tags:        []string{"pdf", "summary"},
+		Parameters: []tool.ParameterSpec{
+			{Name: "file_path", Type: "string", Description: "Path of the text or PDF file to summarize", Required: true},
+			{Name: "max_length", Type: "integer", Description: "Maximum length of the summary", Default: 2000},
+			{Name: "focus_areas", Type: "array", Description: "Aspects the summary should focus on"},
+			{Name: "language", Type: "string", Description: "Output language", Default: "zh"},
+		},
+		Returns: []tool.ReturnSpec{
+			{Name: "summary", Type: "string", Description: "The merged summary"},
+		},
+	}
+}
+
 // SummarizeParams 定义总结参数
 type SummarizeParams struct {
 	FilePath   string   // 文件路径
@@ -83,6 +106,11 @@ func (t *SummarizerTool) Execute(ctx context.Context, params map[string]interfac
 	// 处理每个块
 	var chunkSummaries []string
 	for i, chunk := range chunks {
+		// 每处理一个块前检查任务是否已被取消
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		summary, err := t.summarizeChunk(ctx, chunk, summarizeParams)
 		if err != nil {
 			return nil, fmt.Errorf("failed to summarize chunk %d: %v", i, err)
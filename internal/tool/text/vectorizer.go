@@ -6,7 +6,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+
+	"github.com/hewenyu/Aegis/internal/tool"
 )
 
 // VectorizerTool 实现文档向量化工具
@@ -18,6 +21,7 @@ type VectorizerTool struct {
 	splitter    *TextSplitter
 	embedder    Embedder
 	vectorStore VectorStore
+	allowedDirs []string // 为空时不限制可读取的目录
 }
 
 // Embedder 定义向量嵌入接口
@@ -31,6 +35,12 @@ type VectorStore interface {
 	Search(ctx context.Context, vector []float32, limit int) ([]SearchResult, error)
 }
 
+// CollectionStore 是向量存储可选实现的接口，用于按集合隔离向量
+type CollectionStore interface {
+	// Collection 返回指定集合的向量存储
+	Collection(name string) (VectorStore, error)
+}
+
 // SearchResult 定义搜索结果
 type SearchResult struct {
 	ID       string
@@ -71,6 +81,86 @@ func (t *VectorizerTool) Version() string {
 	return t.version
 }
 
+// Metadata 返回工具元数据
+func (t *VectorizerTool) Metadata() tool.ToolMetadata {
+	return tool.ToolMetadata{
+		ID:          t.id,
+		Name:        t.name,
+		Description: t.description,
+		Version:     t.version,
+		Categories:  []tool.ToolCategory{tool.CategoryIO},
+		Tags:        []string{"rag", "embedding"},
+		Parameters: []tool.ParameterSpec{
+			{Name: "file_path", Type: "string", Description: "Path of the text or PDF file to vectorize", Required: true},
+			{Name: "metadata", Type: "object", Description: "Extra metadata stored with every chunk"},
+		},
+		Returns: []tool.ReturnSpec{
+			{Name: "chunk_ids", Type: "array", Description: "IDs of the stored chunks"},
+			{Name: "num_chunks", Type: "integer", Description: "Number of stored chunks"},
+		},
+	}
+}
+
+// ConfigSchema 返回工具接受的配置项规格
+func (t *VectorizerTool) ConfigSchema() []tool.ParameterSpec {
+	return []tool.ParameterSpec{
+		{Name: "chunk_size", Type: "integer", Description: "Target chunk size in characters (default 1000)"},
+		{Name: "chunk_overlap", Type: "integer", Description: "Overlap between adjacent chunks in characters (default a fifth of chunk_size)"},
+		{Name: "collection", Type: "string", Description: "Vector store collection to write chunks into"},
+		{Name: "allowed_dirs", Type: "array", Description: "Directories files may be read from; unrestricted when empty"},
+	}
+}
+
+// WithConfig 返回应用了配置的新向量化工具
+func (t *VectorizerTool) WithConfig(config map[string]interface{}) (tool.Tool, error) {
+	configured := *t
+
+	options := t.splitter.options
+	if v, ok := config["chunk_size"]; ok {
+		options.ChunkSize = toInt(v)
+		options.ChunkOverlap = options.ChunkSize / 5
+	}
+	if v, ok := config["chunk_overlap"]; ok {
+		options.ChunkOverlap = toInt(v)
+	}
+	if options.ChunkSize <= 0 {
+		return nil, fmt.Errorf("chunk_size must be positive, got %d", options.ChunkSize)
+	}
+	if options.ChunkOverlap < 0 || options.ChunkOverlap >= options.ChunkSize {
+		return nil, fmt.Errorf("chunk_overlap must be in [0, chunk_size), got %d", options.ChunkOverlap)
+	}
+	configured.splitter = NewTextSplitter(options)
+
+	if name, _ := config["collection"].(string); name != "" {
+		store, ok := t.vectorStore.(CollectionStore)
+		if !ok {
+			return nil, fmt.Errorf("vector store does not support collections")
+		}
+		collection, err := store.Collection(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open collection %s: %w", name, err)
+		}
+		configured.vectorStore = collection
+	}
+
+	if dirs, ok := config["allowed_dirs"]; ok {
+		configured.allowedDirs = nil
+		for _, d := range toSlice(dirs) {
+			dir, ok := d.(string)
+			if !ok || dir == "" {
+				return nil, fmt.Errorf("allowed_dirs must contain non-empty strings")
+			}
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, fmt.Errorf("invalid directory %s: %w", dir, err)
+			}
+			configured.allowedDirs = append(configured.allowedDirs, abs)
+		}
+	}
+
+	return &configured, nil
+}
+
 // VectorizeParams 定义向量化参数
 type VectorizeParams struct {
 	FilePath string                 // 文件路径
@@ -97,6 +187,11 @@ func (t *VectorizerTool) Execute(ctx context.Context, params map[string]interfac
 	// 处理每个块
 	results := make([]string, 0, len(chunks))
 	for i, chunk := range chunks {
+		// 每处理一个块前检查任务是否已被取消
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// 生成块ID
 		chunkID := fmt.Sprintf("%s_chunk_%d", filepath.Base(vectorizeParams.FilePath), i)
 
@@ -146,6 +241,10 @@ func (t *VectorizerTool) parseParams(params map[string]interface{}) (*VectorizeP
 		return nil, fmt.Errorf("file_path is required")
 	}
 
+	if !t.isAllowed(filePath) {
+		return nil, fmt.Errorf("file_path %s is outside the allowed directories", filePath)
+	}
+
 	metadata, _ := params["metadata"].(map[string]interface{})
 	if metadata == nil {
 		metadata = make(map[string]interface{})
@@ -157,6 +256,56 @@ func (t *VectorizerTool) parseParams(params map[string]interface{}) (*VectorizeP
 	}, nil
 }
 
+// isAllowed 判断文件是否位于允许读取的目录内。
+// 比较前解析符号链接，避免允许目录内指向外部的链接绕过限制
+func (t *VectorizerTool) isAllowed(path string) bool {
+	if len(t.allowedDirs) == 0 {
+		return true
+	}
+
+	target, err := resolvePath(path)
+	if err != nil {
+		return false
+	}
+	for _, d := range t.allowedDirs {
+		dir, err := resolvePath(d)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, target)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath 返回解析了符号链接的绝对路径。
+// 路径不存在时解析最近的已存在的上级目录，再拼接其余部分。
+// 不预先清理路径，链接之后的".."按实际文件系统解析
+func resolvePath(path string) (string, error) {
+	abs := path
+	if !filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		abs = wd + string(filepath.Separator) + path
+	}
+
+	var rest []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
 // readFile 读取文件内容
 func (t *VectorizerTool) readFile(path string) (string, error) {
 	// 检查是否是PDF文件
@@ -183,3 +332,30 @@ func (t *VectorizerTool) readFile(path string) (string, error) {
 
 	return string(content), nil
 }
+
+// toInt 将配置中的数值转换为int，JSON解码得到的float64也按整数处理
+func toInt(v interface{}) int {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int(rv.Float())
+	}
+	return 0
+}
+
+// toSlice 将配置中的数组转换为[]interface{}
+func toSlice(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items
+}
@@ -0,0 +1,137 @@
+package text
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hewenyu/Aegis/internal/tool"
+)
+
+// fakeEmbedder 返回固定长度的向量
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return []float32{float32(len(text))}, nil
+}
+
+// fakeVectorStore 记录按集合存储的块ID
+type fakeVectorStore struct {
+	name   string
+	stored map[string][]string
+}
+
+func (s *fakeVectorStore) Store(ctx context.Context, id string, vector []float32, metadata map[string]interface{}) error {
+	s.stored[s.name] = append(s.stored[s.name], id)
+	return nil
+}
+
+func (s *fakeVectorStore) Search(ctx context.Context, vector []float32, limit int) ([]SearchResult, error) {
+	return nil, nil
+}
+
+func (s *fakeVectorStore) Collection(name string) (VectorStore, error) {
+	return &fakeVectorStore{name: name, stored: s.stored}, nil
+}
+
+func TestVectorizerWithConfig(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeVectorStore{stored: make(map[string][]string)}
+	shared := NewVectorizerTool(fakeEmbedder{}, store)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("A short paragraph of about forty chars.\n\n", 20)), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	// JSON解码得到的整数为float64
+	configured, err := tool.Configure(shared, map[string]interface{}{
+		"chunk_size":   float64(100),
+		"collection":   "docs",
+		"allowed_dirs": []interface{}{dir},
+	})
+	if err != nil {
+		t.Fatalf("配置工具失败: %v", err)
+	}
+
+	result, err := configured.Execute(ctx, map[string]interface{}{"file_path": path})
+	if err != nil {
+		t.Fatalf("执行工具失败: %v", err)
+	}
+	if n := result.(map[string]interface{})["num_chunks"].(int); n < 5 {
+		t.Errorf("期望按配置的块大小分割出至少5个块，实际为 %d 个", n)
+	}
+	if len(store.stored["docs"]) == 0 || len(store.stored[""]) != 0 {
+		t.Errorf("期望块写入docs集合，实际为 %v", store.stored)
+	}
+
+	// 共享实例不受影响
+	if shared.splitter.options.ChunkSize != DefaultSplitOptions().ChunkSize || shared.vectorStore != store {
+		t.Error("配置修改了共享的工具实例")
+	}
+
+	if err := configured.Validate(map[string]interface{}{"file_path": "/etc/passwd"}); err == nil {
+		t.Error("期望拒绝允许目录以外的文件")
+	}
+}
+
+func TestVectorizerConfigErrors(t *testing.T) {
+	shared := NewVectorizerTool(fakeEmbedder{}, &fakeVectorStore{stored: make(map[string][]string)})
+
+	if got, err := tool.Configure(shared, nil); err != nil || got != shared {
+		t.Errorf("期望空配置返回共享实例，实际为 %v，错误 %v", got, err)
+	}
+
+	configs := []map[string]interface{}{
+		{"chunk_sise": 100},
+		{"chunk_size": "big"},
+		{"chunk_size": 100, "chunk_overlap": 100},
+		{"allowed_dirs": "/tmp"},
+	}
+	for _, config := range configs {
+		if _, err := tool.Configure(shared, config); !errors.Is(err, tool.ErrInvalidConfig) {
+			t.Errorf("期望配置 %v 校验失败，实际得到 %v", config, err)
+		}
+	}
+
+	if _, err := tool.Configure(NewSummarizerTool(nil), map[string]interface{}{"x": 1}); !errors.Is(err, tool.ErrInvalidConfig) {
+		t.Errorf("期望不支持配置的工具拒绝配置，实际得到 %v", err)
+	}
+}
+
+func TestVectorizerSymlinkEscape(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "link")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+
+	shared := NewVectorizerTool(fakeEmbedder{}, &fakeVectorStore{stored: make(map[string][]string)})
+	configured, err := tool.Configure(shared, map[string]interface{}{"allowed_dirs": []interface{}{allowed}})
+	if err != nil {
+		t.Fatalf("配置工具失败: %v", err)
+	}
+
+	// 指向允许目录以外的链接，以及经链接返回上级的路径都应被拒绝
+	for _, path := range []string{
+		filepath.Join(allowed, "link", "secret.txt"),
+		filepath.Join(allowed, "link", "new.txt"),
+		allowed + "/link/../" + filepath.Base(outside) + "/secret.txt",
+	} {
+		if err := configured.Validate(map[string]interface{}{"file_path": path}); err == nil {
+			t.Errorf("期望拒绝经符号链接逃逸的路径 %s", path)
+		}
+	}
+
+	if err := configured.Validate(map[string]interface{}{"file_path": filepath.Join(allowed, "doc.txt")}); err != nil {
+		t.Errorf("期望允许目录内尚不存在的文件通过校验，实际得到 %v", err)
+	}
+}
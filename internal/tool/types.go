@@ -21,6 +21,20 @@ type Tool interface {
 	Validate(params map[string]interface{}) error
 }
 
+// MetadataProvider 是工具可选实现的接口，用于提供完整的元数据（如参数规格）
+type MetadataProvider interface {
+	// Metadata 返回工具的元数据
+	Metadata() ToolMetadata
+}
+
+// Configurable 是工具可选实现的接口，用于按Agent创建带有独立配置的工具实例
+type Configurable interface {
+	// ConfigSchema 返回工具接受的配置项规格
+	ConfigSchema() []ParameterSpec
+	// WithConfig 返回应用了配置的新工具实例，不影响共享的原实例
+	WithConfig(config map[string]interface{}) (Tool, error)
+}
+
 // Manager 接口定义了工具管理器的操作
 type Manager interface {
 	// RegisterTool 注册一个工具
@@ -71,6 +85,8 @@ type ToolMetadata struct {
 	Tags        []string
 	Parameters  []ParameterSpec
 	Returns     []ReturnSpec
+	// RequiresApproval 表示每次调用前都需要人工审批，适用于写文件、执行命令等敏感操作
+	RequiresApproval bool
 }
 
 // ParameterSpec 定义了工具参数规格
@@ -95,4 +111,5 @@ var (
 	ErrToolAlreadyExists = errors.New("tool already exists")
 	ErrInvalidTool       = errors.New("invalid tool")
 	ErrInvalidParameter  = errors.New("invalid parameter")
+	ErrInvalidConfig     = errors.New("invalid tool config")
 )
@@ -24,6 +24,32 @@ type Task struct {
 	Description string
 	Parameters  map[string]interface{}
 	Deadline    time.Time
+	Priority    int             // 优先级，数值越大越先执行
+	Retry       *RetryPolicy    // 重试策略，为空时使用Agent的默认策略
+	Delegation  []DelegationHop // 委托链，从最初的委托方到直接委托方，为空表示非委托任务
+	Budget      *Budget         // 资源预算，为空时使用Agent的默认任务预算
+}
+
+// DelegationHop 是委托链中的一环，表示某个Agent在执行某个任务时发起了委托
+type DelegationHop struct {
+	AgentID string `json:"agent_id"`
+	TaskID  string `json:"task_id,omitempty"`
+}
+
+// Budget 定义了模型调用的资源预算，各项为零时不限制
+type Budget struct {
+	MaxTokens int     // 可用的token总数
+	MaxCost   float64 // 可用的费用，按模型定价计算
+}
+
+// RetryPolicy 定义了任务失败后的重试策略
+type RetryPolicy struct {
+	MaxAttempts     int           // 最大尝试次数（包含首次执行），小于等于1时不重试
+	InitialBackoff  time.Duration // 第一次重试前的等待时间，默认1秒
+	MaxBackoff      time.Duration // 等待时间上限，默认30秒
+	Multiplier      float64       // 每次重试等待时间的增长倍数，默认2
+	Jitter          float64       // 等待时间的随机抖动比例，取值0到1
+	RetryableErrors []error       `json:"-"` // 可重试的错误，为空时重试限流、超时和服务不可用错误
 }
 
 // Result 代表任务执行结果
@@ -44,19 +70,26 @@ type AgentStatus struct {
 
 // ResourceStats 代表Agent使用的资源统计
 type ResourceStats struct {
-	CPU        float64
-	Memory     int64
-	Tokens     int
-	APILatency time.Duration
+	CPU              float64
+	Memory           int64
+	Tokens           int
+	PromptTokens     int
+	CompletionTokens int
+	LLMCalls         int           // 模型调用次数
+	Cost             float64       // 按模型定价计算的费用
+	APILatency       time.Duration // 模型调用的累计耗时
 }
 
 // TaskStatus 代表任务的当前状态
 type TaskStatus struct {
-	ID        string
-	Status    string
-	Progress  float64
-	Result    interface{}
-	Error     error
-	StartTime time.Time
-	EndTime   time.Time
+	ID         string
+	Status     string
+	Progress   float64
+	Result     interface{}
+	Error      error
+	Attempts   int             // 已执行的次数
+	Delegation []DelegationHop // 任务的委托链
+	Resources  ResourceStats   // 任务的模型调用用量，包含所有重试
+	StartTime  time.Time
+	EndTime    time.Time
 }
@@ -52,6 +52,12 @@ type Store interface {
 	GetStats(ctx context.Context) (MemoryStats, error)
 }
 
+// Exporter 是记忆存储可选实现的接口，用于导出全部记忆
+type Exporter interface {
+	// Export 按时间先后返回存储中的所有记忆
+	Export(ctx context.Context) ([]Memory, error)
+}
+
 // MemoryQuery 定义了记忆查询条件
 type MemoryQuery struct {
 	Type       MemoryType
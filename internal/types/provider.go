@@ -13,12 +13,61 @@ var (
 	ErrRateLimited     = errors.New("llm rate limit exceeded")
 )
 
+// 预定义消息角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool" // 工具执行结果
+)
+
 // Message 表示一条消息
 type Message struct {
-	Role    string                 `json:"role"`
-	Content string                 `json:"content"`
-	Name    string                 `json:"name,omitempty"`
-	Context map[string]interface{} `json:"context,omitempty"`
+	Role       string                 `json:"role"`
+	Content    string                 `json:"content"`
+	Name       string                 `json:"name,omitempty"`
+	Context    map[string]interface{} `json:"context,omitempty"`
+	ToolCalls  []ToolCall             `json:"tool_calls,omitempty"`   // 模型请求的工具调用
+	ToolCallID string                 `json:"tool_call_id,omitempty"` // tool角色消息对应的工具调用ID
+}
+
+// ToolDefinition 表示提供给模型的工具定义
+type ToolDefinition struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction 表示可被模型调用的函数
+type ToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  ToolParameters `json:"parameters"`
+}
+
+// ToolParameters 表示函数参数的JSON Schema
+type ToolParameters struct {
+	Type       string                  `json:"type"`
+	Properties map[string]ToolProperty `json:"properties"`
+	Required   []string                `json:"required,omitempty"`
+}
+
+// ToolProperty 表示单个函数参数
+type ToolProperty struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// ToolCall 表示模型发起的一次工具调用
+type ToolCall struct {
+	ID       string           `json:"id,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction 表示工具调用的函数名和参数
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
 }
 
 // GenerateTextParams 定义生成文本的参数
@@ -63,6 +112,7 @@ type ModelInfo struct {
 	SupportsImageInput    bool    // 是否支持图像输入
 	SupportsAudioInput    bool    // 是否支持音频输入
 	SupportsVisionOutput  bool    // 是否支持视觉输出
+	SupportsToolCalling   bool    // 是否支持原生工具调用
 	PricingPerInputToken  float64 // 输入token的定价
 	PricingPerOutputToken float64 // 输出token的定价
 }
@@ -82,6 +132,7 @@ type CompletionRequest struct {
 // ChatRequest 表示聊天请求
 type ChatRequest struct {
 	Messages         []Message              `json:"messages"`
+	Tools            []ToolDefinition       `json:"tools,omitempty"`
 	MaxTokens        int                    `json:"max_tokens,omitempty"`
 	Temperature      float64                `json:"temperature,omitempty"`
 	TopP             float64                `json:"top_p,omitempty"`
@@ -151,3 +202,12 @@ type Provider interface {
 	// GetEmbedModel 获取嵌入模型
 	GetEmbedModel() string
 }
+
+// StreamingProvider 是支持流式聊天补全的提供者可选实现的接口
+type StreamingProvider interface {
+	Provider
+
+	// ChatStream 执行聊天补全，每生成一段文本调用一次onDelta，返回完整的响应。
+	// onDelta返回错误时停止生成并返回该错误，onDelta为空时等同于Chat
+	ChatStream(ctx context.Context, modelID string, request ChatRequest, onDelta func(delta string) error) (ChatResponse, error)
+}